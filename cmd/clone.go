@@ -21,6 +21,7 @@ var cloneCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		checkOrgAccess(repos)
 		err = parallelize(repos, cloneOneRepo)
 		if err != nil {
 			log.Fatal(err)
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/plan"
+	"github.com/spf13/cobra"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <previous-workdir>",
+	Short: "Compare each repo's planned diff with a previous run's",
+	Long: `Compare each repo's planned diff with a previous run's, e.g. to check a refined
+codemod only changed the repos it was meant to before pushing.
+
+Copy the workdir aside (e.g. 'cp -a mp mp-before') before re-running plan, then
+run 'mp compare mp-before'. Each repo is reported as changed, same, new (only
+planned in this run), or removed (only planned in the previous run).`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		previousDir, err := filepath.Abs(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if previousDir == workDir {
+			log.Fatalf("%s is the current workdir, expected a copy of a previous run's", args[0])
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// repos only the previous run targeted, unless comparing a single repo
+		if singleRepo, _ := cmd.Flags().GetString("repo"); singleRepo == "" {
+			var previousInit initialize.Output
+			if err := loadJSON(path.Join(previousDir, "init.json"), &previousInit); err != nil {
+				log.Fatalf("could not read the previous run's init output: %s", err)
+			}
+			targeted := map[string]bool{}
+			for _, r := range repos {
+				targeted[r.Name] = true
+			}
+			for _, r := range previousInit.Repos {
+				if !targeted[r.Name] {
+					repos = append(repos, r)
+				}
+			}
+		}
+
+		counts := map[string]int{}
+		for _, r := range repos {
+			previous := plannedDiff(path.Join(previousDir, r.Name, "plan", "plan.json"))
+			current := plannedDiff(outputPath(r.Name, "plan"))
+			change := plan.CompareDiffs(previous, current)
+			counts[change]++
+			if change != plan.DiffNone {
+				fmt.Printf("%-40s %s\n", r.Name, change)
+			}
+		}
+		fmt.Printf("\n%d changed, %d same, %d new, %d removed\n",
+			counts[plan.DiffChanged], counts[plan.DiffSame], counts[plan.DiffNew], counts[plan.DiffRemoved])
+	},
+}
+
+// plannedDiff is the diff from a successful plan output, or empty if the repo wasn't planned
+func plannedDiff(planOutputPath string) string {
+	var planOutput plan.Output
+	if loadJSON(planOutputPath, &planOutput) != nil || !planOutput.Success {
+		return ""
+	}
+	return planOutput.GitDiff
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/report"
+	"github.com/spf13/cobra"
+)
+
+// CLI flags
+var exportFlagOutput string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the run's full state as JSON, for other tools to ingest",
+	Long: `Export the run's full state as JSON, for other tools to ingest, e.g. dashboards.
+
+The export has each repo's status and PR, and every step's persisted output and
+when it completed. Its schema is versioned by schema_version. The Github token,
+and any credentials embedded in URLs, are redacted.`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		export := report.Export{
+			SchemaVersion: report.ExportSchemaVersion,
+			Version:       cliVersion,
+			ExportedAt:    time.Now().UTC(),
+			Repos:         []report.ExportRepo{},
+		}
+		for _, r := range repos {
+			repo, err := exportRepo(r)
+			if err != nil {
+				log.Fatal(err)
+			}
+			export.Repos = append(export.Repos, repo)
+		}
+
+		if err := writeJSON(export, exportFlagOutput); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("exported %d repos to %s", len(export.Repos), exportFlagOutput)
+	},
+}
+
+// exportRepo collects a repo's state from the persisted output of each step
+func exportRepo(r initialize.Repo) (report.ExportRepo, error) {
+	status, details := getRepoStatus(r.Name)
+	repo := report.ExportRepo{
+		Owner:   r.Owner,
+		Name:    r.Name,
+		Status:  status,
+		Details: details,
+		Steps:   []report.ExportStep{},
+	}
+
+	for _, step := range []string{"clone", "plan", "push", "merge"} {
+		path := outputPath(r.Name, step)
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return repo, err
+		}
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return repo, err
+		}
+		bs = []byte(report.Redact(string(bs), githubToken))
+
+		var stepOutput struct {
+			Success bool
+			Error   string
+		}
+		if err := json.Unmarshal(bs, &stepOutput); err != nil {
+			return repo, err
+		}
+		repo.Steps = append(repo.Steps, report.ExportStep{
+			Name:        step,
+			Success:     stepOutput.Success,
+			Error:       stepOutput.Error,
+			CompletedAt: info.ModTime().UTC(),
+			Output:      json.RawMessage(bs),
+		})
+
+		switch step {
+		case "push":
+			var pushOutput push.Output
+			if json.Unmarshal(bs, &pushOutput) == nil {
+				repo.CommitSHA = pushOutput.CommitSHA
+				repo.PullRequestNumber = pushOutput.PullRequestNumber
+				repo.PullRequestURL = pushOutput.PullRequestURL
+			}
+		case "merge":
+			var mergeOutput merge.Output
+			if json.Unmarshal(bs, &mergeOutput) == nil {
+				repo.MergeCommitSHA = mergeOutput.MergeCommitSHA
+			}
+		}
+	}
+	return repo, nil
+}
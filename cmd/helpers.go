@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
 	"github.com/facebookgo/errgroup"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/semaphore"
@@ -28,19 +33,81 @@ func writeJSON(obj interface{}, path string) error {
 	return ioutil.WriteFile(path, b, 0644)
 }
 
+// messageOrFile resolves a message flag: "@path" reads the message from a file, "@@..." is a literal
+// message starting with "@", and anything else is the message itself
+func messageOrFile(flag string, value string) (string, error) {
+	if strings.HasPrefix(value, "@@") {
+		return value[1:], nil
+	}
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	return readMessageFile(flag, value[1:])
+}
+
+// readMessageFile reads a message from a file named by a flag, with a clear error if it's missing
+func readMessageFile(flag string, path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("--%s file %s doesn't exist", flag, path)
+	} else if err != nil {
+		return "", fmt.Errorf("could not read --%s file %s: %s", flag, path, err)
+	}
+	message := strings.TrimSpace(string(bs))
+	if message == "" {
+		return "", fmt.Errorf("--%s file %s is empty", flag, path)
+	}
+	return message, nil
+}
+
+// logPacing summarizes how much of the run was spent waiting on rate limits
+func logPacing(start time.Time) {
+	waits := githubPacing.Total()
+	if waits.Total() == 0 {
+		return
+	}
+	log.Printf("waited %s, during a %s run", waits, time.Since(start).Round(time.Second))
+}
+
+// parallelism is how many repos are worked on at once
+const parallelism = 10
+
 // parallelize take a list of repos and applies a function (clone, plan, ...) to them
 func parallelize(repos []initialize.Repo, f func(initialize.Repo, context.Context) error) error {
-	ctx := context.Background()
+	_, err := parallelizeUntil(context.Background(), 0, parallelism, repos, f)
+	return err
+}
+
+// parallelizeUntil is parallelize with workers at once, but stops starting repos once ctx is done, returning the repos
+// it didn't start. Repos already started get grace to finish before their context is canceled too.
+func parallelizeUntil(ctx context.Context, grace time.Duration, workers int, repos []initialize.Repo, f func(initialize.Repo, context.Context) error) ([]initialize.Repo, error) {
+	workCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-time.After(grace):
+				cancel()
+			case <-workCtx.Done():
+			}
+		case <-workCtx.Done():
+		}
+	}()
+
 	var eg errgroup.Group
-	parallelLimit := semaphore.NewWeighted(10)
-	for _, r := range repos {
+	parallelLimit := semaphore.NewWeighted(int64(workers))
+	for i, r := range repos {
+		// acquire before starting, so repos start in order
+		if ctx.Err() != nil || parallelLimit.Acquire(ctx, 1) != nil {
+			return repos[i:], eg.Wait()
+		}
 		eg.Add(1)
 		go func(repo initialize.Repo) {
-			parallelLimit.Acquire(ctx, 1)
 			defer parallelLimit.Release(1)
 			defer eg.Done()
 
-			err := f(repo, ctx)
+			err := f(repo, workCtx)
 			if err != nil {
 				eg.Error(err)
 				return
@@ -48,7 +115,7 @@ func parallelize(repos []initialize.Repo, f func(initialize.Repo, context.Contex
 		}(r)
 	}
 
-	return eg.Wait()
+	return nil, eg.Wait()
 }
 
 // whichRepos determines which repos are relevant to the current command.
@@ -66,7 +133,7 @@ func whichRepos(cmd *cobra.Command) ([]initialize.Repo, error) {
 
 	// All repos
 	if singleRepo == "" {
-		return initOutput.Repos, nil
+		return orderRepos(context.Background(), initOutput.Repos, rootFlagRepoOrder)
 	}
 
 	// Single repo
@@ -78,3 +145,24 @@ func whichRepos(cmd *cobra.Command) ([]initialize.Repo, error) {
 	// TODO: showing valid repo names would be helpful
 	return []initialize.Repo{}, fmt.Errorf("%s not a targeted repo name", singleRepo)
 }
+
+// checkOrgAccess checks the Github token can access one repo of each owner, per --org-access-check.
+// Github reports repos the token can't access as not found, so without this a bad token fails every repo with a 404.
+func checkOrgAccess(repos []initialize.Repo) {
+	if rootFlagOrgAccessCheck == "off" {
+		return
+	}
+	checked := map[string]bool{}
+	for _, r := range repos {
+		if checked[r.Owner] {
+			continue
+		}
+		checked[r.Owner] = true
+		err := push.CheckAccess(context.Background(), r.Owner, r.Name, githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter)
+		if _, ok := err.(*push.AccessError); ok && rootFlagOrgAccessCheck == "fail" {
+			log.Fatal(err)
+		} else if err != nil {
+			log.Printf("warning: could not check access to %s: %s", r.Owner, err.Error())
+		}
+	}
+}
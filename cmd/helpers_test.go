@@ -3,10 +3,18 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/ratelimit"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +49,159 @@ func TestParallelize(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, len(repos), total)
 }
+
+func TestOrderRepos(t *testing.T) {
+	repos := []initialize.Repo{
+		initialize.Repo{Owner: "Clever", Name: "microplane"},
+		initialize.Repo{Owner: "Clever", Name: "kayvee"},
+		initialize.Repo{Owner: "Clever", Name: "launch"},
+	}
+
+	ordered, err := orderRepos(context.Background(), repos, "as-listed")
+	assert.NoError(t, err)
+	assert.Equal(t, repos, ordered)
+
+	ordered, err = orderRepos(context.Background(), repos, "alphabetical")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kayvee", "launch", "microplane"}, []string{ordered[0].Name, ordered[1].Name, ordered[2].Name})
+	// the input isn't reordered
+	assert.Equal(t, "microplane", repos[0].Name)
+
+	ordered, err = orderRepos(context.Background(), repos, "random")
+	assert.NoError(t, err)
+	assert.Len(t, ordered, 3)
+
+	_, err = orderRepos(context.Background(), repos, "largest-first")
+	assert.Error(t, err)
+}
+
+func TestOrderReposBySize(t *testing.T) {
+	sizes := map[string]int{"/repos/Clever/microplane": 2, "/repos/Clever/kayvee": 3, "/repos/Clever/launch": 1}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, ok := sizes[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"size": %d}`, size)
+	}))
+	defer server.Close()
+	defer func(baseURL string, limiter ratelimit.Limiter) {
+		rootFlagGithubBaseURL, githubLimiter = baseURL, limiter
+	}(rootFlagGithubBaseURL, githubLimiter)
+	rootFlagGithubBaseURL, githubLimiter = server.URL+"/", ratelimit.NewTicker(time.Millisecond)
+
+	repos := []initialize.Repo{
+		initialize.Repo{Owner: "Clever", Name: "microplane"},
+		initialize.Repo{Owner: "Clever", Name: "kayvee"},
+		initialize.Repo{Owner: "Clever", Name: "launch"},
+	}
+	ordered, err := orderRepos(context.Background(), repos, "size-asc")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"launch", "microplane", "kayvee"}, []string{ordered[0].Name, ordered[1].Name, ordered[2].Name})
+}
+
+func TestPRBudget(t *testing.T) {
+	interval := prBudgetInterval(20)
+	assert.Equal(t, 3*time.Minute, interval)
+	assert.Equal(t, 57*time.Minute, estimatePushDuration(20, interval))
+	assert.Equal(t, time.Duration(0), estimatePushDuration(1, interval))
+}
+
+func TestPushConfigHash(t *testing.T) {
+	planOutput := plan.Output{GitDiff: "+team: eng", CommitMessage: "Update team", BranchName: "team"}
+	input := push.Input{CommitMessage: "Update team", BranchName: "team", BaseBranches: []string{"master"}}
+
+	hash, err := pushConfigHash(planOutput, input)
+	assert.NoError(t, err)
+	again, err := pushConfigHash(planOutput, input)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, again)
+	assert.Len(t, hash, 12)
+
+	input.BaseBranches = []string{"main"}
+	changed, err := pushConfigHash(planOutput, input)
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+}
+
+func TestMessageOrFile(t *testing.T) {
+	message, err := messageOrFile("message", "Update team name\n\nFor the eng reorg")
+	assert.NoError(t, err)
+	assert.Equal(t, "Update team name\n\nFor the eng reorg", message)
+
+	message, err = messageOrFile("message", "@@mentions are escaped")
+	assert.NoError(t, err)
+	assert.Equal(t, "@mentions are escaped", message)
+
+	f, err := ioutil.TempFile("", "message")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("Update team name\n")
+	f.Close()
+	message, err = messageOrFile("message", "@"+f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "Update team name", message)
+
+	_, err = messageOrFile("message", "@/does/not/exist")
+	assert.EqualError(t, err, "--message file /does/not/exist doesn't exist")
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	w, err := parseWindow("09:00", "17:00", "UTC", []string{"mon", "tue", "wed", "thu", "fri"})
+	assert.NoError(t, err)
+
+	monday := time.Date(2018, 6, 4, 0, 0, 0, 0, time.UTC)
+	assert.True(t, w.contains(monday.Add(9*time.Hour)))
+	assert.True(t, w.contains(monday.Add(16*time.Hour+59*time.Minute)))
+	assert.False(t, w.contains(monday.Add(17*time.Hour)))
+	assert.False(t, w.contains(monday.Add(5*24*time.Hour+12*time.Hour)), "saturday")
+	assert.Equal(t, monday.Add(24*time.Hour+9*time.Hour), w.next(monday.Add(18*time.Hour)))
+	assert.Equal(t, monday.Add(7*24*time.Hour+9*time.Hour), w.next(monday.Add(4*24*time.Hour+18*time.Hour)), "friday evening")
+
+	// spanning midnight
+	overnight, err := parseWindow("22:00", "02:00", "UTC", nil)
+	assert.NoError(t, err)
+	assert.True(t, overnight.contains(monday.Add(23*time.Hour)))
+	assert.True(t, overnight.contains(monday.Add(25*time.Hour)))
+	assert.False(t, overnight.contains(monday.Add(27*time.Hour)))
+
+	_, err = parseWindow("9am", "17:00", "UTC", nil)
+	assert.Error(t, err)
+	_, err = parseWindow("09:00", "17:00", "UTC", []string{"someday"})
+	assert.Error(t, err)
+}
+
+func TestParallelizeUntil(t *testing.T) {
+	repos := []initialize.Repo{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started := 0
+	unstarted, err := parallelizeUntil(ctx, time.Minute, parallelism, repos, func(r initialize.Repo, ctx context.Context) error {
+		started++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, started)
+	assert.Equal(t, repos, unstarted, "nothing starts once the timeout has passed")
+
+	unstarted, err = parallelizeUntil(context.Background(), time.Minute, parallelism, repos, func(r initialize.Repo, ctx context.Context) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, unstarted)
+}
+
+func TestTeamReviewersFor(t *testing.T) {
+	mapping := map[string][]string{
+		"Clever/api":  {"api-owners"},
+		"web":         {"frontend"},
+		"Clever/docs": {},
+	}
+	fallback := []string{"platform"}
+	assert.Equal(t, []string{"api-owners"}, teamReviewersFor(initialize.Repo{Owner: "Clever", Name: "api"}, mapping, fallback))
+	assert.Equal(t, []string{"frontend"}, teamReviewersFor(initialize.Repo{Owner: "Clever", Name: "web"}, mapping, fallback))
+	assert.Equal(t, []string{}, teamReviewersFor(initialize.Repo{Owner: "Clever", Name: "docs"}, mapping, fallback), "an empty mapping opts the repo out of the fallback")
+	assert.Equal(t, fallback, teamReviewersFor(initialize.Repo{Owner: "Clever", Name: "other"}, mapping, fallback))
+	assert.Equal(t, fallback, teamReviewersFor(initialize.Repo{Owner: "Clever", Name: "other"}, nil, fallback))
+}
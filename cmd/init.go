@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var initFlagSearch string
+
 var initCmd = &cobra.Command{
 	Use:   "init [query]",
 	Short: "Initialize a microplane workflow",
@@ -16,16 +18,27 @@ var initCmd = &cobra.Command{
 
 $ mp init "org:Clever filename:circle.yml"
 
-would target all Clever repos with a circle.yml file.
+would target all Clever repos with a circle.yml file. With --search repo, the query is a Github
+Repository Search instead, for example
+
+$ mp init --search repo "org:Clever topic:go archived:false"
 
-See https://help.github.com/articles/searching-code/ for more details about the syntax.`,
+See https://help.github.com/articles/searching-code/ and https://help.github.com/articles/searching-repositories/
+for more details about the syntax.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		query := args[0]
+		if initFlagSearch != initialize.SearchCode && initFlagSearch != initialize.SearchRepositories {
+			log.Fatalf("Error parsing --search flag: expected %s or %s, got %s", initialize.SearchCode, initialize.SearchRepositories, initFlagSearch)
+		}
 		output, err := initialize.Initialize(initialize.Input{
-			Query:   query,
-			WorkDir: workDir,
-			Version: cliVersion,
+			Query:         query,
+			Search:        initFlagSearch,
+			WorkDir:       workDir,
+			Version:       cliVersion,
+			UserAgent:     userAgent,
+			GithubToken:   githubToken,
+			GithubBaseURL: rootFlagGithubBaseURL,
 		})
 		if err != nil {
 			log.Fatal(err)
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/push"
@@ -19,15 +20,42 @@ import (
 var mergeFlagThrottle string
 var mergeFlagIgnoreReviewApproval bool
 var mergeFlagIgnoreBuildStatus bool
+var mergeFlagMinApprovals int
+var mergeFlagBaseModifiedRetries int
+var mergeFlagBaseModifiedRetryInterval string
+var mergeFlagUpdateBehind bool
+var mergeFlagTag string
+var mergeFlagTagMessage string
+var mergeFlagSignTag bool
+var mergeFlagUpdatePolls int
+var mergeFlagUpdatePollInterval string
+
+// how long to wait between checks on a PR being updated with its base
+var mergeUpdatePollInterval time.Duration
+
+// how long to wait before retrying a merge whose base branch was modified
+var mergeBaseModifiedRetryInterval time.Duration
+
+// postMergeHook runs after each merge, if a command was given
+var postMergeHook *merge.Command
 
 // rate limits the # of PR merges. used to prevent load on CI system
 var mergeThrottle *time.Ticker
 
 var mergeCmd = &cobra.Command{
-	Use:   "merge",
+	Use:   "merge [post-merge cmd] [args...]",
 	Short: "Merge pushed changes",
-	Args:  cobra.ExactArgs(0),
+	Long: `Merge pushed changes
+
+If a command is given, it runs after each successful merge. Its arguments are templates,
+with {{.Org}}, {{.Repo}}, {{.PRNumber}}, and {{.MergeCommitSHA}} available.`,
+	Example: `mp merge -- ./deploy.sh '{{.Repo}}' '{{.MergeCommitSHA}}'`,
+	Args:    cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 0 {
+			postMergeHook = &merge.Command{Path: args[0], Args: args[1:]}
+		}
+
 		repos, err := whichRepos(cmd)
 		if err != nil {
 			log.Fatal(err)
@@ -46,7 +74,22 @@ var mergeCmd = &cobra.Command{
 			mergeThrottle = time.NewTicker(dur)
 		}
 
+		mergeBaseModifiedRetryInterval, err = time.ParseDuration(mergeFlagBaseModifiedRetryInterval)
+		if err != nil {
+			log.Fatalf("Error parsing --base-modified-retry-interval flag: %s", err.Error())
+		}
+
+		mergeUpdatePollInterval, err = time.ParseDuration(mergeFlagUpdatePollInterval)
+		if err != nil {
+			log.Fatalf("Error parsing --update-poll-interval flag: %s", err.Error())
+		}
+
+		checkOrgAccess(repos)
+		openTrackingIssue(context.Background())
+		start := time.Now()
 		err = parallelize(repos, mergeOneRepo)
+		logPacing(start)
+		summarizeTracking(context.Background(), repos)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -72,6 +115,26 @@ func mergeOneRepo(r initialize.Repo, ctx context.Context) error {
 		log.Printf("%s/%s - skipping, must successfully push first", r.Owner, r.Name)
 		return nil
 	}
+	if pushOutput.NoChanges {
+		log.Printf("%s/%s - skipping, no PR was opened: %s", r.Owner, r.Name, pushOutput.NoChangesReason)
+		return nil
+	}
+	if pushOutput.OptedOut {
+		log.Printf("%s/%s - skipping, repo opted out: %s", r.Owner, r.Name, pushOutput.OptedOutReason)
+		return nil
+	}
+	if pushOutput.PRDisabled {
+		log.Printf("%s/%s - skipping, PRs are disabled: %s", r.Owner, r.Name, pushOutput.PRDisabledReason)
+		return nil
+	}
+	if pushOutput.ReadOnly {
+		log.Printf("%s/%s - skipping, the token is read-only: %s", r.Owner, r.Name, pushOutput.ReadOnlyReason)
+		return nil
+	}
+	if pushOutput.ValidationFailed {
+		log.Printf("%s/%s - skipping, validation %s: %s", r.Owner, r.Name, pushOutput.ValidationConclusion, pushOutput.ValidationURL)
+		return nil
+	}
 	segments := strings.Split(pushOutput.PullRequestURL, "/")
 	prNumber, err := strconv.Atoi(strings.TrimSpace(segments[len(segments)-1]))
 	if err != nil {
@@ -85,16 +148,45 @@ func mergeOneRepo(r initialize.Repo, ctx context.Context) error {
 		return err
 	}
 
+	// Signing a tag needs the local clone
+	var cloneOutput clone.Output
+	if mergeFlagSignTag {
+		loadJSON(outputPath(r.Name, "clone"), &cloneOutput)
+	}
+
 	// Execute
 	input := merge.Input{
-		Org:                   r.Owner,
-		Repo:                  r.Name,
-		PRNumber:              prNumber,
-		CommitSHA:             pushOutput.CommitSHA,
-		RequireReviewApproval: !mergeFlagIgnoreReviewApproval,
-		RequireBuildSuccess:   !mergeFlagIgnoreBuildStatus,
-	}
-	output, err := merge.Merge(ctx, input, githubLimiter, mergeThrottle)
+		Org:                       r.Owner,
+		Repo:                      r.Name,
+		PRNumber:                  prNumber,
+		CommitSHA:                 pushOutput.CommitSHA,
+		UserAgent:                 userAgent,
+		GithubToken:               githubToken,
+		GithubBaseURL:             rootFlagGithubBaseURL,
+		ExpectedBase:              pushOutput.BaseBranch,
+		RequireReviewApproval:     !mergeFlagIgnoreReviewApproval,
+		RequireBuildSuccess:       !mergeFlagIgnoreBuildStatus,
+		MinApprovals:              mergeFlagMinApprovals,
+		BaseModifiedRetries:       mergeFlagBaseModifiedRetries,
+		BaseModifiedRetryInterval: mergeBaseModifiedRetryInterval,
+		UpdateBehind:              mergeFlagUpdateBehind,
+		UpdateBranchPolls:         mergeFlagUpdatePolls,
+		UpdateBranchPollInterval:  mergeUpdatePollInterval,
+		PostMerge:                 postMergeHook,
+		Tag: merge.TagOnMerge{
+			Name:    mergeFlagTag,
+			Message: mergeFlagTagMessage,
+			Sign:    mergeFlagSignTag,
+			RepoDir: cloneOutput.ClonedIntoDir,
+		},
+	}
+	limiter := githubPacing.Track(githubLimiter)
+	output, err := merge.Merge(ctx, input, limiter, mergeThrottle)
+	output.Pacing = limiter.Waits()
+	if output.Pacing.RetryAfter > 0 {
+		log.Printf("%s/%s - waited %s", r.Owner, r.Name, output.Pacing)
+	}
+	sendWebhook(ctx, r, "merge", output, err)
 	if err != nil {
 		log.Printf("%s/%s - merge error: %s", r.Owner, r.Name, err.Error())
 		o := struct {
@@ -104,6 +196,24 @@ func mergeOneRepo(r initialize.Repo, ctx context.Context) error {
 		writeJSON(o, mergeOutputPath)
 		return err
 	}
+	if output.Retries > 0 {
+		log.Printf("%s/%s - merged after %d retries, base branch was modified", r.Owner, r.Name, output.Retries)
+	}
+	if output.BranchUpdated {
+		log.Printf("%s/%s - merged after updating the PR with its base", r.Owner, r.Name)
+	}
+	if output.BranchKept != "" {
+		log.Printf("%s/%s - kept the PR's branch: %s", r.Owner, r.Name, output.BranchKept)
+	}
+	if output.TagError != "" {
+		log.Printf("%s/%s - could not tag the merge commit: %s", r.Owner, r.Name, output.TagError)
+	} else if output.Tag != "" {
+		log.Printf("%s/%s - tagged the merge commit %s", r.Owner, r.Name, output.Tag)
+	}
+	if output.PostMergeError != "" {
+		log.Printf("%s/%s - post-merge command failed: %s\n%s", r.Owner, r.Name, output.PostMergeError, output.PostMergeOutput)
+	}
+	trackPR(ctx, r, prNumber, pushOutput.PullRequestURL, true)
 	writeJSON(output, mergeOutputPath)
 	return nil
 }
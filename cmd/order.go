@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/initialize"
+)
+
+// repo orderings for --repo-order
+const (
+	repoOrderAsListed     = "as-listed"
+	repoOrderAlphabetical = "alphabetical"
+	repoOrderSizeAsc      = "size-asc"
+	repoOrderRandom       = "random"
+)
+
+// orderRepos sorts the repos by strategy, e.g. smallest first so config errors show up early.
+// size-asc costs one Github API request per repo.
+func orderRepos(ctx context.Context, repos []initialize.Repo, strategy string) ([]initialize.Repo, error) {
+	ordered := make([]initialize.Repo, len(repos))
+	copy(ordered, repos)
+
+	switch strategy {
+	case repoOrderAsListed, "":
+	case repoOrderAlphabetical:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].Owner+"/"+ordered[i].Name < ordered[j].Owner+"/"+ordered[j].Name
+		})
+	case repoOrderRandom:
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		r.Shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+	case repoOrderSizeAsc:
+		sizes, err := repoSizes(ctx, ordered)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return sizes[ordered[i].Owner+"/"+ordered[i].Name] < sizes[ordered[j].Owner+"/"+ordered[j].Name]
+		})
+	default:
+		return nil, fmt.Errorf("unknown repo order %q, expected one of %s, %s, %s, or %s",
+			strategy, repoOrderAsListed, repoOrderAlphabetical, repoOrderSizeAsc, repoOrderRandom)
+	}
+	return ordered, nil
+}
+
+// repoSizes looks up each repo's size in KB, keyed by "owner/name"
+func repoSizes(ctx context.Context, repos []initialize.Repo) (map[string]int, error) {
+	// Create Github Client
+	client, err := githubclient.New(ctx, githubToken, rootFlagGithubBaseURL, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := map[string]int{}
+	for _, r := range repos {
+		githubLimiter.Wait()
+		repo, resp, err := client.Repositories.Get(ctx, r.Owner, r.Name)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		sizes[r.Owner+"/"+r.Name] = repo.GetSize()
+	}
+	return sizes, nil
+}
@@ -17,6 +17,8 @@ import (
 
 var planFlagBranch string
 var planFlagMessage string
+var planFlagManifest string
+var planFlagSubmodules string
 
 // TODO: Pass these *not* via globals
 // these variables are set when the cmd starts running
@@ -25,23 +27,36 @@ var (
 	commitMessage string
 	changeCmd     string
 	changeCmdArgs []string
+	manifestFiles []plan.File
 	isSingleRepo  bool
 )
 
 var planCmd = &cobra.Command{
 	Use:   "plan [cmd] [args...]",
-	Args:  cobra.MinimumNArgs(1),
+	Args:  cobra.ArbitraryArgs,
 	Short: "Plan changes by running a command against cloned repos",
 	Example: `mp plan -b microplaning -m 'microplane fun' -r app-service -- sh -c /absolute/path/to/script
-mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/path/to/script`,
+mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/path/to/script
+mp plan -b microplaning -m 'microplane fun' --manifest /absolute/path/to/manifest.json`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 
-		changeCmd = args[0]
-		if len(args) > 1 {
+		if len(args) > 0 {
+			changeCmd = args[0]
 			changeCmdArgs = args[1:]
 		}
 
+		if planFlagManifest != "" {
+			manifest, err := plan.LoadManifest(planFlagManifest)
+			if err != nil {
+				log.Fatal(err)
+			}
+			manifestFiles = manifest.Files
+		}
+		if changeCmd == "" && len(manifestFiles) == 0 {
+			log.Fatal("a command or --manifest is required")
+		}
+
 		branchName, err = cmd.Flags().GetString("branch")
 		if err != nil {
 			log.Fatal(err)
@@ -57,6 +72,16 @@ mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/p
 		if commitMessage == "" {
 			log.Fatal("--message is required")
 		}
+		commitMessage, err = messageOrFile("message", commitMessage)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		switch planFlagSubmodules {
+		case plan.SubmoduleWarn, plan.SubmoduleInclude, plan.SubmoduleIgnore:
+		default:
+			log.Fatalf("Error parsing --submodules flag: expected warn, include, or ignore, got %s", planFlagSubmodules)
+		}
 
 		repos, err := whichRepos(cmd)
 		if err != nil {
@@ -101,11 +126,14 @@ func planOneRepo(r initialize.Repo, ctx context.Context) error {
 	// Execute
 	input := plan.Input{
 		RepoName:      r.Name,
+		RepoOwner:     r.Owner,
 		RepoDir:       cloneOutput.ClonedIntoDir,
 		WorkDir:       planWorkDir,
 		Command:       plan.Command{Path: changeCmd, Args: changeCmdArgs},
+		Files:         manifestFiles,
 		CommitMessage: commitMessage,
 		BranchName:    branchName,
+		SubmoduleMode: planFlagSubmodules,
 	}
 	output, err := plan.Plan(ctx, input)
 	if err != nil {
@@ -117,6 +145,14 @@ func planOneRepo(r initialize.Repo, ctx context.Context) error {
 		return fmt.Errorf("%s/%s error: %+v", r.Owner, r.Name, err)
 	}
 	writeJSON(output, planOutputPath)
+	if len(output.SubmoduleChanges) > 0 {
+		switch planFlagSubmodules {
+		case plan.SubmoduleWarn:
+			log.Printf("warning: %s/%s - the change moves submodules %s. Use --submodules include if that's expected, or ignore to leave them out", r.Owner, r.Name, strings.Join(output.SubmoduleChanges, ", "))
+		case plan.SubmoduleIgnore:
+			log.Printf("%s/%s - left submodule changes out of the commit: %s", r.Owner, r.Name, strings.Join(output.SubmoduleChanges, ", "))
+		}
+	}
 	if isSingleRepo {
 		fmt.Println(output.GitDiff)
 	}
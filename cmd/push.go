@@ -2,29 +2,162 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/progress"
 	"github.com/Clever/microplane/push"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/semaphore"
 )
 
 // CLI flags
-var pushFlagAssignee string
+var pushFlagAssignees []string
 var pushFlagThrottle string
 var pushFlagBodyFile string
+var pushFlagBodyTemplate string
+var pushFlagBaseBranches []string
+var pushFlagIgnoreContexts []string
+var pushFlagBuildURLAllowHosts []string
+var pushFlagBuildURLDenyHosts []string
+var pushFlagFetchBase bool
+var pushFlagBaseFromTopics bool
+var pushFlagLive bool
+var pushFlagPreferDefaultBranch bool
+var pushFlagSignOff bool
+var pushFlagSanitizeBranch bool
+var pushFlagHandoffMentions []string
+var pushFlagAuthorName string
+var pushFlagAuthorEmail string
+var pushFlagCommitterName string
+var pushFlagCommitterEmail string
+var pushFlagMentionTeams []string
+var pushFlagMentionTemplate string
+var pushFlagReviewers []string
+var pushFlagReconcileReviewers bool
+var pushFlagTeamReviewers []string
+var pushFlagTeamReviewersFile string
+var pushFlagMaxFileSizeKB int64
+var pushFlagWarnBinary bool
+var pushFlagStrictFileCheck bool
+var pushFlagChangedFiles string
+var pushFlagFallbackAssignee string
+var pushFlagStrictAssignee bool
+var pushFlagAssignToCommitter bool
+var pushFlagLabels []string
+var pushFlagMilestone string
+var pushFlagDraft bool
+var pushFlagDryRun bool
+var pushFlagCIContext string
+var pushFlagCheckRuns bool
+var pushFlagStatusAggregation string
+
+// pushTeamReviewers maps repos to team slugs, from --team-reviewers-file
+var pushTeamReviewers map[string][]string
+var pushFlagLockTTL string
+var pushFlagDiffBase string
+var pushFlagMaxTitleLength int
+var pushFlagRunID string
+var pushFlagPlanName string
+var pushFlagRenamedBranch string
+var pushFlagStrictMarkers bool
+var pushFlagBodyFooter bool
+var pushFlagBodyFooterTemplate string
+var pushFlagBodyFooterHidden bool
+var pushFlagSourceBranch string
+var pushFlagSkipPRDisabled bool
+var pushFlagSkipReadOnly bool
+var pushFlagIgnoreWhitespace bool
+var pushFlagAutoMerge bool
+var pushFlagMergeMethod string
+var pushFlagRetryWithMinimalBody bool
+var pushFlagForcePush bool
+var pushFlagForcePushFallback bool
+var pushFlagGitConcurrency int
+var pushFlagAPIConcurrency int
+
+// bound the pushes running `git push`, and opening PRs, at once, see push.Input.GitSlots
+var pushGitSlots *semaphore.Weighted
+var pushAPISlots *semaphore.Weighted
+var pushFlagMergeablePolls int
+var pushFlagGitTimeout string
+var pushFlagMergeablePollInterval string
+var pushFlagRemote string
+var pushFlagHeadOwner string
+var pushFlagOptOutFile string
+var pushFlagConfigHash bool
+var pushFlagSkipUpToDate bool
+var pushFlagSquash bool
+var pushFlagWindowStart string
+var pushFlagWindowEnd string
+var pushFlagWindowTimezone string
+var pushFlagWindowDays []string
+var pushFlagWindowWait bool
+var pushFlagForce bool
+
+// pushWindow restricts pushes to a maintenance window, if one was given
+var pushWindow *maintenanceWindow
+var pushFlagSkipUnchanged bool
+var pushFlagLockConversation bool
+var pushFlagLockReason string
+var pushFlagUpdateTitle string
+var pushFlagUpdateBodyFile string
+var pushFlagDispatchWorkflow string
+var pushFlagDispatchInputs []string
+var pushFlagDispatchPRInput string
+var pushFlagValidateWorkflow string
+var pushFlagValidateInputs []string
+var pushFlagValidateTimeout string
+
+// inputs for the workflow dispatched after each PR is opened, parsed from key=value flags
+var pushDispatchInputs = map[string]string{}
+
+// inputs for the validation workflow, parsed from key=value flags
+var pushValidateInputs = map[string]string{}
+var pushValidateTimeout time.Duration
+
+// how long another operator's branch lock is honored, zero to not lock
+var pushLockTTL time.Duration
+var pushFlagMaxAttempts int
+var pushFlagPRsPerHour int
+var pushFlagPRBudgetAction string
+var pushFlagRetryBackoff string
+var pushFlagAPIMaxAttempts int
+var pushFlagAPIRetryBackoff string
+var pushFlagTimeout string
+var pushFlagTimeoutGrace string
+
+// wait before retrying a push which failed with a transient error
+var pushRetryBackoff time.Duration
+
+// wait before retrying a Github API call which failed with a 5xx response
+var pushAPIRetryBackoff time.Duration
+
+// wait between reads of a PR while Github works out whether it can be merged
+var pushMergeablePollInterval time.Duration
+
+// how long each git command may take, zero for no limit
+var pushGitTimeout time.Duration
+
+// pushReporter shows each repo's progress, when --live is set
+var pushReporter progress.Reporter
 
 // rate limits the # of git pushes. used to prevent load on CI system
 var pushThrottle *time.Ticker
 
-var prAssignee string
+var prAssignees []string
 var prBody string
+var prUpdateBody string
 
 var pushCmd = &cobra.Command{
 	Use:   "push",
@@ -32,12 +165,12 @@ var pushCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
-		prAssignee, err = cmd.Flags().GetString("assignee")
+		prAssignees, err = cmd.Flags().GetStringSlice("assignee")
 		if err != nil {
 			log.Fatal(err)
 		}
-		if prAssignee == "" {
-			log.Fatal("--assignee is required")
+		if len(prAssignees) == 0 && !pushFlagAssignToCommitter {
+			log.Fatal("--assignee is required, unless --assign-to-committer is set")
 		}
 
 		prBodyFile, err := cmd.Flags().GetString("body-file")
@@ -45,24 +178,118 @@ var pushCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 		if prBodyFile != "" {
-			prBodyBytes, err := ioutil.ReadFile(prBodyFile)
+			prBody, err = readMessageFile("body-file", prBodyFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if pushFlagBodyTemplate != "" {
+			if _, err := push.LoadPRBodyTemplate(pushFlagBodyTemplate); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if pushFlagUpdateBodyFile != "" {
+			prUpdateBody, err = readMessageFile("update-body-file", pushFlagUpdateBodyFile)
 			if err != nil {
 				log.Fatal(err)
 			}
-			prBody = string(prBodyBytes)
+		}
+		switch pushFlagStatusAggregation {
+		case push.StatusAggregationGithub, push.StatusAggregationStrict, push.StatusAggregationLenient:
+		default:
+			log.Fatalf("Error parsing --status-aggregation flag: expected github, strict, or lenient, got %s", pushFlagStatusAggregation)
+		}
+		switch pushFlagChangedFiles {
+		case "", push.ChangedFilesLocal, push.ChangedFilesAPI:
+		default:
+			log.Fatalf("Error parsing --changed-files flag: expected %s or %s, got %s", push.ChangedFilesLocal, push.ChangedFilesAPI, pushFlagChangedFiles)
+		}
+		switch pushFlagRenamedBranch {
+		case push.RenamedBranchAdopt, push.RenamedBranchWarn:
+		default:
+			log.Fatalf("Error parsing --renamed-branch flag: expected adopt or warn, got %s", pushFlagRenamedBranch)
+		}
+		if pushFlagStrictMarkers && pushFlagRunID == "" && pushFlagPlanName == "" && !pushFlagConfigHash && !pushFlagSkipUnchanged {
+			log.Fatalf("Error parsing --strict-markers flag: it needs --run-id, --plan-name, or --config-hash to recognize its PRs")
+		}
+		switch pushFlagMergeMethod {
+		case push.MergeMethodMerge, push.MergeMethodSquash, push.MergeMethodRebase:
+		default:
+			log.Fatalf("Error parsing --merge-method flag: expected merge, squash, or rebase, got %s", pushFlagMergeMethod)
+		}
+		if pushFlagTeamReviewersFile != "" {
+			if err := loadJSON(pushFlagTeamReviewersFile, &pushTeamReviewers); err != nil {
+				log.Fatalf("Error reading --team-reviewers-file: %s", err.Error())
+			}
 		}
 
 		throttle, err := cmd.Flags().GetString("throttle")
 		if err != nil {
 			log.Fatal(err)
 		}
+		var throttleDur time.Duration
 		if throttle != "" {
 			// Try parsing it and updating the limiter
-			dur, err := time.ParseDuration(throttle)
+			throttleDur, err = time.ParseDuration(throttle)
 			if err != nil {
 				log.Fatalf("Error parsing --throttle flag: %s", err.Error())
 			}
-			pushThrottle = time.NewTicker(dur)
+			pushThrottle = time.NewTicker(throttleDur)
+		}
+
+		pushRetryBackoff, err = time.ParseDuration(pushFlagRetryBackoff)
+		if err != nil {
+			log.Fatalf("Error parsing --retry-backoff flag: %s", err.Error())
+		}
+		pushAPIRetryBackoff, err = time.ParseDuration(pushFlagAPIRetryBackoff)
+		if err != nil {
+			log.Fatalf("Error parsing --api-retry-backoff flag: %s", err.Error())
+		}
+		if pushFlagGitConcurrency < 1 || pushFlagAPIConcurrency < 1 {
+			log.Fatalf("Error parsing --git-concurrency and --api-concurrency flags: expected at least 1, got %d and %d", pushFlagGitConcurrency, pushFlagAPIConcurrency)
+		}
+		pushGitSlots = semaphore.NewWeighted(int64(pushFlagGitConcurrency))
+		pushAPISlots = semaphore.NewWeighted(int64(pushFlagAPIConcurrency))
+
+		if pushFlagGitTimeout != "" {
+			pushGitTimeout, err = time.ParseDuration(pushFlagGitTimeout)
+			if err != nil {
+				log.Fatalf("Error parsing --git-timeout flag: %s", err.Error())
+			}
+		}
+
+		pushMergeablePollInterval, err = time.ParseDuration(pushFlagMergeablePollInterval)
+		if err != nil {
+			log.Fatalf("Error parsing --mergeable-poll-interval flag: %s", err.Error())
+		}
+
+		if pushFlagLockTTL != "" {
+			pushLockTTL, err = time.ParseDuration(pushFlagLockTTL)
+			if err != nil {
+				log.Fatalf("Error parsing --lock-ttl flag: %s", err.Error())
+			}
+		}
+
+		for _, kv := range pushFlagDispatchInputs {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Error parsing --dispatch-input flag: %s is not key=value", kv)
+			}
+			pushDispatchInputs[parts[0]] = parts[1]
+		}
+
+		if pushFlagValidateWorkflow != "" {
+			pushValidateTimeout, err = time.ParseDuration(pushFlagValidateTimeout)
+			if err != nil {
+				log.Fatalf("Error parsing --validate-timeout flag: %s", err.Error())
+			}
+		}
+		for _, kv := range pushFlagValidateInputs {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Error parsing --validate-input flag: %s is not key=value", kv)
+			}
+			pushValidateInputs[parts[0]] = parts[1]
 		}
 
 		repos, err := whichRepos(cmd)
@@ -70,7 +297,80 @@ var pushCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		err = parallelize(repos, pushOneRepo)
+		if pushFlagWindowStart != "" || pushFlagWindowEnd != "" {
+			pushWindow, err = parseWindow(pushFlagWindowStart, pushFlagWindowEnd, pushFlagWindowTimezone, pushFlagWindowDays)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := checkPushWindow(time.Now()); err != nil {
+			log.Fatal(err)
+		}
+
+		if pushFlagPRsPerHour > 0 {
+			budgetInterval := prBudgetInterval(pushFlagPRsPerHour)
+			switch pushFlagPRBudgetAction {
+			case "pace":
+				if budgetInterval > throttleDur {
+					throttleDur = budgetInterval
+					// the --throttle ticker is replaced by the slower budget's
+					if pushThrottle != nil {
+						pushThrottle.Stop()
+					}
+					pushThrottle = time.NewTicker(throttleDur)
+				}
+			case "warn":
+				if throttleDur < budgetInterval && len(repos) > pushFlagPRsPerHour {
+					log.Printf("warning: pushing %d repos would open more than %d PRs per hour, Github may throttle PR creation", len(repos), pushFlagPRsPerHour)
+				}
+			default:
+				log.Fatalf("Error parsing --pr-budget-action flag: expected pace or warn, got %s", pushFlagPRBudgetAction)
+			}
+			log.Printf("opening PRs in %d repos, one per %s, will take at least %s", len(repos), throttleDur, estimatePushDuration(len(repos), throttleDur))
+		}
+		if pushThrottle != nil {
+			defer pushThrottle.Stop()
+		}
+
+		if pushFlagLive {
+			pushReporter = progress.New()
+			// log lines would scroll a live table off the screen
+			if _, ok := pushReporter.(*progress.Table); ok {
+				log.SetOutput(ioutil.Discard)
+			}
+		}
+		ctx := context.Background()
+		var grace time.Duration
+		if pushFlagTimeout != "" {
+			timeout, err := time.ParseDuration(pushFlagTimeout)
+			if err != nil {
+				log.Fatalf("Error parsing --timeout flag: %s", err.Error())
+			}
+			grace, err = time.ParseDuration(pushFlagTimeoutGrace)
+			if err != nil {
+				log.Fatalf("Error parsing --timeout-grace flag: %s", err.Error())
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		checkOrgAccess(repos)
+		if !pushFlagDryRun {
+			openTrackingIssue(context.Background())
+		}
+		start := time.Now()
+		// each push holds a git slot, then an API slot, so enough workers to fill both keeps them busy
+		unstarted, err := parallelizeUntil(ctx, grace, pushFlagGitConcurrency+pushFlagAPIConcurrency, repos, pushOneRepo)
+		log.SetOutput(os.Stderr)
+		logPacing(start)
+		summarizeTracking(context.Background(), repos)
+		if len(unstarted) > 0 {
+			names := []string{}
+			for _, r := range unstarted {
+				names = append(names, r.Name)
+			}
+			log.Printf("--timeout reached, pushed %d of %d repos. Not started: %s", len(repos)-len(unstarted), len(repos), strings.Join(names, ", "))
+		}
 		if err != nil {
 			// TODO: dig into errors and display them with more detail
 			log.Fatal(err)
@@ -103,6 +403,12 @@ func pushOneRepo(r initialize.Repo, ctx context.Context) error {
 		return nil
 	}
 
+	// The window may have closed during a long run
+	if pushWindow != nil && !pushFlagForce && !pushWindow.contains(time.Now()) {
+		log.Printf("%s/%s - skipping, blocked by the maintenance window", r.Owner, r.Name)
+		return nil
+	}
+
 	// Prepare workdir for current step's output
 	pushOutputPath := outputPath(r.Name, "push")
 	pushWorkDir := filepath.Dir(pushOutputPath)
@@ -110,19 +416,124 @@ func pushOneRepo(r initialize.Repo, ctx context.Context) error {
 		return err
 	}
 
+	// Reviewers requested by the previous run, so they can be reconciled
+	var previousPush push.Output
+	loadJSON(pushOutputPath, &previousPush)
+
 	// Execute
 	input := push.Input{
-		RepoName:      r.Name,
-		PlanDir:       planOutput.PlanDir,
-		WorkDir:       pushWorkDir,
-		CommitMessage: planOutput.CommitMessage,
-		PRBody:        prBody,
-		PRAssignee:    prAssignee,
-		BranchName:    planOutput.BranchName,
-		RepoOwner:     r.Owner,
-	}
-	output, err := push.Push(ctx, input, githubLimiter, pushThrottle)
+		RepoName:              r.Name,
+		PlanDir:               planOutput.PlanDir,
+		WorkDir:               pushWorkDir,
+		CommitMessage:         planOutput.CommitMessage,
+		PRBody:                prBody,
+		PRBodyTemplatePath:    pushFlagBodyTemplate,
+		UpdateTitle:           pushFlagUpdateTitle,
+		UpdateBody:            prUpdateBody,
+		PRAssignees:           prAssignees,
+		FallbackAssignee:      pushFlagFallbackAssignee,
+		StrictAssignee:        pushFlagStrictAssignee,
+		AssignToCommitter:     pushFlagAssignToCommitter,
+		Labels:                pushFlagLabels,
+		Milestone:             pushFlagMilestone,
+		Draft:                 pushFlagDraft,
+		DryRun:                pushFlagDryRun,
+		Reviewers:             pushFlagReviewers,
+		ReconcileReviewers:    pushFlagReconcileReviewers,
+		PreviousReviewers:     previousPush.RequestedReviewers,
+		TeamReviewers:         teamReviewersFor(r, pushTeamReviewers, pushFlagTeamReviewers),
+		PreviousTeamReviewers: previousPush.RequestedTeamReviewers,
+		ChangedFiles:          pushFlagChangedFiles,
+		FileCheck:             push.FileCheck{MaxSize: pushFlagMaxFileSizeKB * 1024, Binary: pushFlagWarnBinary, Strict: pushFlagStrictFileCheck},
+		UserAgent:             userAgent,
+		GithubToken:           githubToken,
+		GithubBaseURL:         rootFlagGithubBaseURL,
+		BranchName:            planOutput.BranchName,
+		RepoOwner:             r.Owner,
+		Progress:              pushProgress(r),
+		BaseBranches:          pushFlagBaseBranches,
+		IgnoreContexts:        pushFlagIgnoreContexts,
+		StatusAggregation:     pushFlagStatusAggregation,
+		BuildURLHosts:         push.HostFilter{Allow: pushFlagBuildURLAllowHosts, Deny: pushFlagBuildURLDenyHosts},
+		CIContext:             pushFlagCIContext,
+		CheckRuns:             pushFlagCheckRuns,
+		FetchBase:             pushFlagFetchBase,
+		BaseFromTopics:        pushFlagBaseFromTopics,
+		PreferDefaultBranch:   pushFlagPreferDefaultBranch,
+		SignOff:               pushFlagSignOff,
+		AuthorName:            pushFlagAuthorName,
+		AuthorEmail:           pushFlagAuthorEmail,
+		CommitterName:         pushFlagCommitterName,
+		CommitterEmail:        pushFlagCommitterEmail,
+		SquashBeforePush:      pushFlagSquash,
+		SanitizeBranch:        pushFlagSanitizeBranch,
+		HandoffMentions:       pushFlagHandoffMentions,
+		MentionTeams:          pushFlagMentionTeams,
+		MentionTemplate:       pushFlagMentionTemplate,
+		LockTTL:               pushLockTTL,
+		DiffBase:              pushFlagDiffBase,
+		MaxTitleLength:        pushFlagMaxTitleLength,
+		RunID:                 pushFlagRunID,
+		PlanName:              pushFlagPlanName,
+		RenamedBranch:         pushFlagRenamedBranch,
+		StrictMarkers:         pushFlagStrictMarkers,
+		BodyFooterTemplate:    bodyFooterTemplate(),
+		BodyFooterHidden:      pushFlagBodyFooterHidden,
+		Version:               cliVersion,
+		SourceBranch:          pushFlagSourceBranch,
+		SkipPRDisabled:        pushFlagSkipPRDisabled,
+		SkipReadOnly:          pushFlagSkipReadOnly,
+		IgnoreWhitespace:      pushFlagIgnoreWhitespace,
+		AutoMerge:             pushFlagAutoMerge,
+		MergeMethod:           pushFlagMergeMethod,
+		RetryWithMinimalBody:  pushFlagRetryWithMinimalBody,
+		ForcePush:             pushFlagForcePush,
+		ForcePushFallback:     pushFlagForcePushFallback,
+		GitSlots:              pushGitSlots,
+		APISlots:              pushAPISlots,
+		MergeablePolls:        pushFlagMergeablePolls,
+		GitTimeout:            pushGitTimeout,
+		MergeablePollInterval: pushMergeablePollInterval,
+		RemoteName:            pushFlagRemote,
+		HeadOwner:             pushFlagHeadOwner,
+		OptOutFile:            pushFlagOptOutFile,
+		SkipUpToDate:          pushFlagSkipUpToDate,
+		LockConversation:      pushFlagLockConversation,
+		LockReason:            pushFlagLockReason,
+		Dispatch: push.WorkflowDispatch{
+			Workflow:      pushFlagDispatchWorkflow,
+			Inputs:        pushDispatchInputs,
+			PRNumberInput: pushFlagDispatchPRInput,
+		},
+		Validate: push.Validation{
+			Workflow: pushFlagValidateWorkflow,
+			Inputs:   pushValidateInputs,
+			Timeout:  pushValidateTimeout,
+		},
+		Retry:    push.RetryPolicy{MaxAttempts: pushFlagMaxAttempts, Backoff: pushRetryBackoff},
+		APIRetry: push.RetryPolicy{MaxAttempts: pushFlagAPIMaxAttempts, Backoff: pushAPIRetryBackoff},
+	}
+	if pushFlagConfigHash || pushFlagSkipUnchanged {
+		hash, err := pushConfigHash(planOutput, input)
+		if err != nil {
+			return err
+		}
+		input.ConfigHash = hash
+		input.SkipUnchangedConfig = pushFlagSkipUnchanged
+	}
+	limiter := githubPacing.Track(githubLimiter)
+	output, err := push.Push(ctx, input, limiter, pushThrottle)
+	output.Pacing = limiter.Waits()
+	if output.Pacing.RetryAfter > 0 {
+		log.Printf("%s/%s - waited %s", r.Owner, r.Name, output.Pacing)
+	}
+	if pushFlagDryRun {
+		// the real push's output is left alone, so a later push or merge isn't confused
+		return writeDryRun(r, output, err, filepath.Join(pushWorkDir, "push-dry-run.json"))
+	}
+	sendWebhook(ctx, r, "push", output, err)
 	if err != nil {
+		reportPushDone(r, err)
 		o := struct {
 			push.Output
 			Error string
@@ -130,6 +541,181 @@ func pushOneRepo(r initialize.Repo, ctx context.Context) error {
 		writeJSON(o, pushOutputPath)
 		return err
 	}
+	if output.ConfigUnchanged {
+		log.Printf("%s/%s - config unchanged since the PR was pushed, skipped pushing", r.Owner, r.Name)
+	}
+	if output.OptedOut {
+		log.Printf("%s/%s - skipped, repo opted out: %s", r.Owner, r.Name, output.OptedOutReason)
+	}
+	if output.PRDisabled {
+		log.Printf("%s/%s - skipped, PRs are disabled: %s", r.Owner, r.Name, output.PRDisabledReason)
+	}
+	if output.ReadOnly {
+		log.Printf("%s/%s - skipped, the token is read-only: %s", r.Owner, r.Name, output.ReadOnlyReason)
+	}
+	if output.ValidationFailed {
+		log.Printf("%s/%s - skipped opening the PR, validation %s: %s", r.Owner, r.Name, output.ValidationConclusion, output.ValidationURL)
+	}
+	if len(output.FilteredReviewers) > 0 {
+		log.Printf("%s/%s - didn't request reviews from the PR's author: %s", r.Owner, r.Name, strings.Join(output.FilteredReviewers, ", "))
+	}
+	if output.InvalidBodyError != "" {
+		log.Printf("%s/%s - warning: opened the PR with a minimal body, since Github rejected the full body: %s", r.Owner, r.Name, output.InvalidBodyError)
+	}
+	if output.AssigneeWarning != "" {
+		log.Printf("%s/%s - warning: %s", r.Owner, r.Name, output.AssigneeWarning)
+	}
+	if len(output.FlaggedFiles) > 0 {
+		log.Printf("%s/%s - warning: binary or large files in the change: %s", r.Owner, r.Name, strings.Join(output.FlaggedFiles, ", "))
+	}
+	if len(output.UnknownTeamReviewers) > 0 {
+		log.Printf("%s/%s - warning: didn't request reviews from unknown teams: %s", r.Owner, r.Name, strings.Join(output.UnknownTeamReviewers, ", "))
+	}
+	if output.ReviewerWarning != "" {
+		log.Printf("%s/%s - warning: %s", r.Owner, r.Name, output.ReviewerWarning)
+	}
+	if output.BaseWarning != "" {
+		log.Printf("%s/%s - warning: %s", r.Owner, r.Name, output.BaseWarning)
+	}
+	if output.AutoMergeWarning != "" {
+		log.Printf("%s/%s - warning: %s, merge it with mp merge", r.Owner, r.Name, output.AutoMergeWarning)
+	}
+	if output.TeamMention == push.TeamMentionPosted {
+		log.Printf("%s/%s - mentioned teams on %s: %s", r.Owner, r.Name, output.PullRequestURL, strings.Join(pushFlagMentionTeams, ", "))
+	}
+	if output.BranchRenamedFrom != "" {
+		log.Printf("%s/%s - branch of %s was renamed from %s, pushed to its new name", r.Owner, r.Name, output.PullRequestURL, output.BranchRenamedFrom)
+	}
+	if output.FallbackBranch != "" {
+		log.Printf("%s/%s - warning: %s is protected against force-pushes, pushed %s and opened %s instead", r.Owner, r.Name, planOutput.BranchName, output.FallbackBranch, output.PullRequestURL)
+		if output.SupersededPRURL != "" {
+			log.Printf("%s/%s - warning: %s is superseded by %s, close it", r.Owner, r.Name, output.SupersededPRURL, output.PullRequestURL)
+		}
+	}
+	if output.SharedBranchPRURL != "" {
+		log.Printf("%s/%s - warning: %s is another campaign's PR on the same branch, opened %s from a separate branch", r.Owner, r.Name, output.SharedBranchPRURL, output.PullRequestURL)
+	}
+	if output.OrphanedPRURL != "" {
+		log.Printf("%s/%s - warning: %s is this plan's PR on another branch, close it in favor of %s", r.Owner, r.Name, output.OrphanedPRURL, output.PullRequestURL)
+	}
+	trackPR(ctx, r, output.PullRequestNumber, output.PullRequestURL, false)
+	reportPushDone(r, nil)
 	writeJSON(output, pushOutputPath)
 	return nil
 }
+
+// pushProgress reports each phase of the repo's push, if --live is set
+func pushProgress(r initialize.Repo) func(string) {
+	if pushReporter == nil {
+		return nil
+	}
+	return func(phase string) {
+		pushReporter.Report(progress.Event{Repo: r.Name, Phase: phase, Status: "running"})
+	}
+}
+
+func reportPushDone(r initialize.Repo, err error) {
+	if pushReporter == nil {
+		return
+	}
+	if err != nil {
+		pushReporter.Report(progress.Event{Repo: r.Name, Phase: err.Error(), Status: "error"})
+		return
+	}
+	pushReporter.Report(progress.Event{Repo: r.Name, Phase: "pushed", Status: "done"})
+}
+
+// pushConfigHash identifies the config which produced a repo's PR: its planned change, and how it's pushed
+func pushConfigHash(planOutput plan.Output, input push.Input) (string, error) {
+	// the template's contents, not its path, since editing it changes the PRs
+	bodyTemplate := ""
+	if input.PRBodyTemplatePath != "" {
+		bs, err := ioutil.ReadFile(input.PRBodyTemplatePath)
+		if err != nil {
+			return "", err
+		}
+		bodyTemplate = string(bs)
+	}
+	config := struct {
+		GitDiff        string
+		CommitMessage  string
+		BranchName     string
+		PRBody         string
+		PRBodyTemplate string
+		UpdateTitle    string
+		UpdateBody     string
+		MaxTitleLength int
+		BaseBranches   []string
+		BaseFromTopics bool
+		SignOff        bool
+	}{
+		GitDiff:        planOutput.GitDiff,
+		CommitMessage:  input.CommitMessage,
+		BranchName:     input.BranchName,
+		PRBody:         input.PRBody,
+		PRBodyTemplate: bodyTemplate,
+		UpdateTitle:    input.UpdateTitle,
+		UpdateBody:     input.UpdateBody,
+		MaxTitleLength: input.MaxTitleLength,
+		BaseBranches:   input.BaseBranches,
+		BaseFromTopics: input.BaseFromTopics,
+		SignOff:        input.SignOff,
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:12], nil
+}
+
+// prBudgetInterval spreads PR creation evenly, so no more than perHour PRs are opened in any hour
+func prBudgetInterval(perHour int) time.Duration {
+	return time.Hour / time.Duration(perHour)
+}
+
+// estimatePushDuration is the time spent waiting between PR creations. The first PR doesn't wait.
+func estimatePushDuration(repos int, interval time.Duration) time.Duration {
+	if repos <= 1 {
+		return 0
+	}
+	return time.Duration(repos-1) * interval
+}
+
+// teamReviewersFor looks up the repo's teams in mapping, by owner/name then name, falling back to the global teams
+func teamReviewersFor(r initialize.Repo, mapping map[string][]string, fallback []string) []string {
+	if teams, ok := mapping[r.Owner+"/"+r.Name]; ok {
+		return teams
+	}
+	if teams, ok := mapping[r.Name]; ok {
+		return teams
+	}
+	return fallback
+}
+
+// writeDryRun logs what the push would have done, and saves it to path for review
+func writeDryRun(r initialize.Repo, output push.Output, err error, path string) error {
+	reportPushDone(r, err)
+	if err != nil {
+		log.Printf("%s/%s - dry run failed: %s", r.Owner, r.Name, err.Error())
+		o := struct {
+			push.Output
+			Error string
+		}{output, err.Error()}
+		writeJSON(o, path)
+		return err
+	}
+	log.Printf("%s/%s - %s", r.Owner, r.Name, output.String())
+	return writeJSON(output, path)
+}
+
+// bodyFooterTemplate is --body-footer-template, or with --body-footer the default footer
+func bodyFooterTemplate() string {
+	if pushFlagBodyFooterTemplate != "" {
+		return pushFlagBodyFooterTemplate
+	}
+	if pushFlagBodyFooter {
+		return push.DefaultBodyFooterTemplate
+	}
+	return ""
+}
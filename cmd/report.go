@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/report"
+	"github.com/spf13/cobra"
+)
+
+// CLI flags
+var reportFlagOutput string
+var reportFlagTitle string
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Write a Markdown report of a workflow's progress",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		rows := []report.Row{}
+		for _, r := range repos {
+			rows = append(rows, reportRow(r.Name))
+		}
+
+		doc := report.Document(reportFlagTitle, time.Now(), rows)
+		if err := ioutil.WriteFile(reportFlagOutput, []byte(doc), 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote report to %s", reportFlagOutput)
+	},
+}
+
+// reportRow summarizes a repo from the persisted output of each step
+func reportRow(repo string) report.Row {
+	status, details := getRepoStatus(repo)
+	row := report.Row{Repo: repo, Status: status, Details: details}
+
+	var pushOutput push.Output
+	if loadJSON(outputPath(repo, "push"), &pushOutput) == nil {
+		row.PullRequestURL = pushOutput.PullRequestURL
+	}
+
+	// the first step that didn't succeed is the one to blame
+	for _, step := range []string{"clone", "plan", "push", "merge"} {
+		var stepOutput struct {
+			Success bool
+			Error   string
+		}
+		if loadJSON(outputPath(repo, step), &stepOutput) == nil && stepOutput.Success {
+			continue
+		}
+		if stepOutput.Error != "" {
+			row.ErrorStep = step
+		}
+		break
+	}
+	return row
+}
@@ -9,46 +9,231 @@ import (
 	"time"
 
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/Clever/microplane/webhook"
 	"github.com/spf13/cobra"
 )
 
 var workDir string
 var cliVersion string
 
+// CLI flags
+var rootFlagAdaptiveRateLimit bool
+var rootFlagRepoOrder string
+var rootFlagUserAgent string
+var rootFlagGithubBaseURL string
+var rootFlagOrgAccessCheck string
+
+// userAgent identifies microplane's requests to Github
+var userAgent string
+
 // Github's rate limit for authenticated requests is 5000 QPH = 83.3 QPM = 1.38 QPS = 720ms/query
 // We also use a global limiter to prevent concurrent requests, which trigger Github's abuse detection
-var githubLimiter = time.NewTicker(720 * time.Millisecond)
+var githubLimiter ratelimit.Limiter = ratelimit.NewTicker(720 * time.Millisecond)
+
+// githubPacing tracks how long requests waited on rate limits during the run, see logPacing
+var githubPacing = ratelimit.NewPacing()
+
+// adaptiveRateLimitMinDelay is the fastest the adaptive limiter will send requests
+const adaptiveRateLimitMinDelay = 100 * time.Millisecond
 
 var rootCmd = &cobra.Command{
 	Use:   "mp",
 	Short: "Microplane makes git changes across many repos",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// resolved here rather than in init, so `mp --help` doesn't need a token or run the gh CLI
+		githubToken = resolveGithubToken()
+		if githubToken == "" {
+			log.Fatalf("GITHUB_API_TOKEN env var is not set, and there's no gh CLI login. In order to use microplane, create a token (https://help.github.com/articles/creating-a-personal-access-token-for-the-command-line/) then set the env var, or log in with `gh auth login`.")
+		}
+
+		userAgent = rootFlagUserAgent
+		if userAgent == "" {
+			userAgent = "microplane"
+			if cliVersion != "" {
+				userAgent += "/" + cliVersion
+			}
+		}
+
+		switch rootFlagOrgAccessCheck {
+		case "fail", "warn", "off":
+		default:
+			log.Fatalf("Error parsing --org-access-check flag: expected fail, warn, or off, got %s", rootFlagOrgAccessCheck)
+		}
+
+		if rootFlagAdaptiveRateLimit {
+			githubLimiter = ratelimit.NewAdaptive(adaptiveRateLimitMinDelay)
+		}
+
+		webhookBackoff, err := time.ParseDuration(rootFlagWebhookBackoff)
+		if err != nil {
+			log.Fatalf("Error parsing --webhook-backoff flag: %s", err.Error())
+		}
+		webhookConfig = webhook.Config{
+			URL:            rootFlagWebhookURL,
+			MaxAttempts:    rootFlagWebhookAttempts,
+			Backoff:        webhookBackoff,
+			DeadLetterPath: rootFlagWebhookDeadLetter,
+		}
+		if webhookConfig.DeadLetterPath == "" {
+			webhookConfig.DeadLetterPath = path.Join(workDir, "webhook-dead-letter.jsonl")
+		}
+	},
 }
 
 func init() {
-	if os.Getenv("GITHUB_API_TOKEN") == "" {
-		log.Fatalf("GITHUB_API_TOKEN env var is not set. In order to use microplane, create a token (https://help.github.com/articles/creating-a-personal-access-token-for-the-command-line/) then set the env var.")
-	}
-
 	rootCmd.PersistentFlags().StringP("repo", "r", "", "single repo to operate on")
+	rootCmd.PersistentFlags().BoolVar(&rootFlagAdaptiveRateLimit, "adaptive-rate-limit", false, "Pace Github API requests using the rate limit remaining, instead of a fixed interval")
+	rootCmd.PersistentFlags().StringVar(&rootFlagRepoOrder, "repo-order", "as-listed", "Order to process repos in: as-listed, alphabetical, size-asc, or random. size-asc costs a Github API request per repo")
+	rootCmd.PersistentFlags().StringVar(&rootFlagTrackingRepo, "tracking-repo", "", "Repo to keep a campaign tracking issue in, listing each PR, e.g. 'Clever/coordination'")
+	rootCmd.PersistentFlags().StringVar(&rootFlagTrackingTitle, "tracking-title", "", "Title of the tracking issue. An open issue with this title is reused")
+	rootCmd.PersistentFlags().StringVar(&rootFlagWebhookURL, "webhook-url", "", "URL to POST each repo's push and merge result to, as JSON")
+	rootCmd.PersistentFlags().IntVar(&rootFlagWebhookAttempts, "webhook-attempts", 3, "Number of times to try delivering each webhook")
+	rootCmd.PersistentFlags().StringVar(&rootFlagWebhookBackoff, "webhook-backoff", "1s", "How long to wait before retrying a webhook, doubled before each later retry")
+	rootCmd.PersistentFlags().StringVar(&rootFlagWebhookDeadLetter, "webhook-dead-letter", "", "File to append undelivered webhooks to. Defaults to webhook-dead-letter.jsonl in the workdir")
+	rootCmd.PersistentFlags().StringVar(&rootFlagOrgAccessCheck, "org-access-check", "warn", "Before cloning, pushing, or merging, check the Github token can access each repo owner, so a misconfigured token gives one clear error rather than a 404 per repo: fail, warn, or off. Checks --github-base-url's server, if set")
+	rootCmd.PersistentFlags().StringVar(&rootFlagUserAgent, "user-agent", "", "User-Agent for Github API requests. Defaults to microplane/<version>")
+	rootCmd.PersistentFlags().StringVar(&rootFlagGithubBaseURL, "github-base-url", "", "API URL of a Github Enterprise server, e.g. https://github.example.com/api/v3/. Defaults to github.com")
 	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(compareCmd)
 	rootCmd.AddCommand(docsCmd)
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportFlagOutput, "output", "o", "export.json", "Path to write the export to")
 	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().StringVar(&initFlagSearch, "search", initialize.SearchCode, "Kind of Github search the query is: code, or repo")
 
 	rootCmd.AddCommand(mergeCmd)
 	mergeCmd.Flags().StringVarP(&mergeFlagThrottle, "throttle", "t", "1ms", "Throttle number of merges, e.g. '30s' means 1 merge per 30 seconds")
 	mergeCmd.Flags().BoolVar(&mergeFlagIgnoreReviewApproval, "ignore-review-approval", false, "Ignore whether or not the review has been approved")
 	mergeCmd.Flags().BoolVar(&mergeFlagIgnoreBuildStatus, "ignore-build-status", false, "Ignore whether or not builds are passing")
+	mergeCmd.Flags().IntVar(&mergeFlagMinApprovals, "min-approvals", 0, "Minimum number of reviewers whose latest review is an approval")
+	mergeCmd.Flags().IntVar(&mergeFlagBaseModifiedRetries, "base-modified-retries", 3, "Number of times to retry a merge when the base branch was modified")
+	mergeCmd.Flags().StringVar(&mergeFlagBaseModifiedRetryInterval, "base-modified-retry-interval", "5s", "How long to wait before retrying a merge when the base branch was modified")
+	mergeCmd.Flags().StringVar(&mergeFlagTag, "tag", "", "Tag each merge commit, e.g. 'release-{{.PRNumber}}'. {{.Org}}, {{.Repo}}, {{.PRNumber}}, and {{.MergeCommitSHA}} are available")
+	mergeCmd.Flags().StringVar(&mergeFlagTagMessage, "tag-message", "", "Message for the --tag, with the same templating. Defaults to the tag's name")
+	mergeCmd.Flags().BoolVar(&mergeFlagSignTag, "sign-tag", false, "Sign the --tag with your git config's key, using the repo's local clone")
+	mergeCmd.Flags().BoolVar(&mergeFlagUpdateBehind, "update-behind", false, "Update PRs which are behind their base by merging the base in, then merge them once up to date")
+	mergeCmd.Flags().IntVar(&mergeFlagUpdatePolls, "update-polls", 20, "Number of times to check whether an updated PR (and its build) is ready to merge")
+	mergeCmd.Flags().StringVar(&mergeFlagUpdatePollInterval, "update-poll-interval", "30s", "How long to wait between checks on an updated PR")
 
 	rootCmd.AddCommand(planCmd)
 	planCmd.Flags().StringVarP(&planFlagBranch, "branch", "b", "", "Git branch to commit to")
-	planCmd.Flags().StringVarP(&planFlagMessage, "message", "m", "", "Commit message")
+	planCmd.Flags().StringVarP(&planFlagMessage, "message", "m", "", "Commit message, or @path to read it from a file (@@ for a message starting with @)")
+	planCmd.Flags().StringVar(&planFlagSubmodules, "submodules", plan.SubmoduleWarn, "How to handle the change moving submodule pointers: warn (commit them, with a warning), include (commit them), or ignore (leave them out of the commit)")
+	planCmd.Flags().StringVar(&planFlagManifest, "manifest", "", "JSON manifest of files to create in each repo, instead of (or before) running a command")
 
 	rootCmd.AddCommand(pushCmd)
 	pushCmd.Flags().StringVarP(&pushFlagThrottle, "throttle", "t", "1ms", "Throttle number of pushes, e.g. '30s' means 1 push per 30 seconds")
-	pushCmd.Flags().StringVarP(&pushFlagAssignee, "assignee", "a", "", "Github user to assign the PR to")
+	pushCmd.Flags().StringSliceVarP(&pushFlagAssignees, "assignee", "a", []string{}, "Github users to assign the PR to, e.g. 'alice,bob'")
 	pushCmd.Flags().StringVarP(&pushFlagBodyFile, "body-file", "b", "", "body of PR")
+	pushCmd.Flags().StringVar(&pushFlagBodyTemplate, "body-template", "", "Go template file rendered as each PR's body, overriding --body-file. {{.RepoName}}, {{.RepoOwner}}, {{.BranchName}}, and {{.CommitSHA}} are available")
+	pushCmd.Flags().StringSliceVar(&pushFlagBaseBranches, "base", []string{"master"}, "Base branches to open the PR against, the first that exists in each repo is used, e.g. 'main,master'")
+
+	pushCmd.Flags().BoolVar(&pushFlagLive, "live", false, "Show a live-updating table of each repo's progress (plain logs when not a terminal)")
+	pushCmd.Flags().BoolVar(&pushFlagBaseFromTopics, "base-from-topics", false, "Use the base branch declared by each repo's 'mp-base-<branch>' topic, or else its default branch. Overrides --base")
+	pushCmd.Flags().IntVar(&pushFlagPRsPerHour, "prs-per-hour", 0, "Budget of PRs to open per hour, to stay under Github's PR creation limit. 0 for no budget")
+	pushCmd.Flags().StringVar(&pushFlagPRBudgetAction, "pr-budget-action", "pace", "What to do when --throttle would exceed --prs-per-hour: pace (slow down PR creation) or warn")
+	pushCmd.Flags().StringVar(&pushFlagTimeout, "timeout", "", "Stop starting new pushes after this long, e.g. '25m'. Repos not started are listed, and pushed by the next run")
+	pushCmd.Flags().StringVar(&pushFlagTimeoutGrace, "timeout-grace", "2m", "How long pushes in progress at the --timeout get to finish before they're canceled")
+	pushCmd.Flags().IntVar(&pushFlagMaxAttempts, "max-attempts", 1, "Number of times to try each push, retrying on transient errors like network failures and Github 5xx responses")
+	pushCmd.Flags().IntVar(&pushFlagAPIMaxAttempts, "api-max-attempts", 3, "Number of times to try each Github API call that opens, edits, assigns, labels, or comments on a PR, retrying on rate limit errors and 5xx responses. Comments are only retried if the failed attempt didn't post them")
+	pushCmd.Flags().StringVar(&pushFlagAPIRetryBackoff, "api-retry-backoff", "2s", "How long to wait before retrying a Github API call after a 5xx response, doubled before each later retry. Rate limits are waited out instead")
+	pushCmd.Flags().StringVar(&pushFlagRetryBackoff, "retry-backoff", "5s", "How long to wait before retrying a push, doubled before each later retry")
+	pushCmd.Flags().StringVar(&pushFlagLockTTL, "lock-ttl", "", "Lock each branch while pushing so concurrent operators don't collide, e.g. '30m'. Locks older than this are stale")
+	pushCmd.Flags().StringVar(&pushFlagDispatchWorkflow, "dispatch-workflow", "", "Github Actions workflow file to trigger on the branch once the PR exists, e.g. 'validate.yml'")
+	pushCmd.Flags().StringSliceVar(&pushFlagDispatchInputs, "dispatch-input", []string{}, "Input for the dispatched workflow, as key=value")
+	pushCmd.Flags().StringVar(&pushFlagValidateWorkflow, "validate-workflow", "", "Github Actions workflow file to run on the pushed branch before opening the PR, e.g. 'validate.yml'. The PR is skipped if it fails")
+	pushCmd.Flags().StringSliceVar(&pushFlagValidateInputs, "validate-input", []string{}, "Input for the validation workflow, as key=value")
+	pushCmd.Flags().StringVar(&pushFlagValidateTimeout, "validate-timeout", "30m", "How long to wait for the validation workflow to finish")
+	pushCmd.Flags().StringVar(&pushFlagDispatchPRInput, "dispatch-pr-input", "pr_number", "Name of the dispatched workflow's input that receives the PR number, empty to not send it")
+	pushCmd.Flags().StringVar(&pushFlagCIContext, "ci-context", push.DefaultCIContext, "Status context or check run name (or glob) of the build to link to, e.g. 'build' for a Github Actions job")
+	pushCmd.Flags().BoolVar(&pushFlagCheckRuns, "check-runs", false, "Include check runs, e.g. from Github Actions, in the PR's status")
+	pushCmd.Flags().BoolVar(&pushFlagDryRun, "dry-run", false, "Show what would be pushed, and the PR that would be opened, without pushing or changing anything on Github")
+	pushCmd.Flags().BoolVar(&pushFlagDraft, "draft", false, "Open PRs as drafts. PRs which already exist are left as they are")
+	pushCmd.Flags().StringVar(&pushFlagMilestone, "milestone", "", "Title of the open milestone to attach the PRs to. Each repo must have it")
+	pushCmd.Flags().StringSliceVar(&pushFlagLabels, "label", []string{}, "Labels to add to the PRs, e.g. 'automated'")
+	pushCmd.Flags().StringSliceVar(&pushFlagReviewers, "reviewer", []string{}, "Github users to request reviews from")
+	pushCmd.Flags().StringVar(&pushFlagChangedFiles, "changed-files", "", "Record the files each PR changed in the push output, from the local diff (local) or from Github (api)")
+	pushCmd.Flags().Int64Var(&pushFlagMaxFileSizeKB, "max-file-size-kb", 1024, "Warn about added or modified files larger than this, in KB. 0 disables the check")
+	pushCmd.Flags().BoolVar(&pushFlagWarnBinary, "warn-binary", false, "Warn about added or modified binary files")
+	pushCmd.Flags().BoolVar(&pushFlagStrictFileCheck, "strict-file-check", false, "Fail the push, rather than warn, for binary or large files")
+	pushCmd.Flags().StringSliceVar(&pushFlagTeamReviewers, "team-reviewer", []string{}, "Slugs of teams to request reviews from, for repos not in --team-reviewers-file")
+	pushCmd.Flags().StringVar(&pushFlagTeamReviewersFile, "team-reviewers-file", "", "JSON file mapping repos, by name or owner/name, to the slugs of the teams that review them")
+	pushCmd.Flags().BoolVar(&pushFlagReconcileReviewers, "reconcile-reviewers", false, "Remove reviewers requested by a previous push who are no longer a --reviewer. Reviewers added by hand are kept")
+	pushCmd.Flags().StringVar(&pushFlagFallbackAssignee, "fallback-assignee", "", "Github user to assign the PR to when --assignee can't be assigned, e.g. in repos they don't have access to")
+	pushCmd.Flags().BoolVar(&pushFlagAssignToCommitter, "assign-to-committer", false, "Assign the PR to whoever last changed its files, falling back to --assignee")
+	pushCmd.Flags().BoolVar(&pushFlagStrictAssignee, "strict-assignee", false, "Fail the push when neither --assignee nor --fallback-assignee could be assigned")
+	pushCmd.Flags().StringVar(&pushFlagAuthorName, "author-name", "", "Author name for the pushed commit, e.g. when pushing from CI. Defaults to the plan's commit author. The plan must make a single commit, or be pushed with --squash")
+	pushCmd.Flags().StringVar(&pushFlagAuthorEmail, "author-email", "", "Author email for the pushed commit. Defaults to the plan's commit author")
+	pushCmd.Flags().StringVar(&pushFlagCommitterName, "committer-name", "", "Committer name for commits amended by the push. Defaults to your git config")
+	pushCmd.Flags().StringVar(&pushFlagCommitterEmail, "committer-email", "", "Committer email for commits amended by the push. Defaults to your git config")
+	pushCmd.Flags().StringSliceVar(&pushFlagMentionTeams, "mention-team", []string{}, "Teams to notify with a comment mentioning them once the PR is open, without requesting their review, e.g. 'platform' or 'Clever/platform'")
+	pushCmd.Flags().StringVar(&pushFlagMentionTemplate, "mention-template", push.DefaultMentionTemplate, "Text of the --mention-team comment. {{.Teams}}, {{.Org}}, {{.Repo}}, and {{.PRNumber}} are available")
+	pushCmd.Flags().StringSliceVar(&pushFlagHandoffMentions, "handoff-mention", []string{}, "Github users to mention in a comment handing an existing PR off to --assignee, instead of reassigning it")
+	pushCmd.Flags().BoolVar(&pushFlagSanitizeBranch, "sanitize-branch", false, "Replace characters git doesn't allow in the branch name, instead of failing")
+	pushCmd.Flags().BoolVar(&pushFlagSquash, "squash", false, "Squash the plan's commits into one with the plan's commit message before pushing")
+	pushCmd.Flags().BoolVarP(&pushFlagSignOff, "signoff", "s", false, "Add a Signed-off-by trailer to the commit, like git commit -s")
+	pushCmd.Flags().BoolVar(&pushFlagPreferDefaultBranch, "prefer-default-branch", false, "Open PRs against each repo's default branch when it differs from the resolved base")
+	pushCmd.Flags().IntVar(&pushFlagMaxTitleLength, "max-title-length", 0, "Truncate longer PR titles, moving the rest into the body. 0 means no limit")
+	pushCmd.Flags().StringVar(&pushFlagUpdateTitle, "update-title", "", "Title to set when an existing PR is reused. Defaults to the title it was created with")
+	pushCmd.Flags().StringVar(&pushFlagUpdateBodyFile, "update-body-file", "", "Body to set when an existing PR is reused. Defaults to the body it was created with")
+	pushCmd.Flags().BoolVar(&pushFlagLockConversation, "lock-conversation", false, "Lock each PR's conversation once it's open, for informational PRs")
+	pushCmd.Flags().StringVar(&pushFlagLockReason, "lock-reason", "", "Reason shown for the locked conversation: off-topic, too heated, resolved, or spam")
+	pushCmd.Flags().StringVar(&pushFlagOptOutFile, "opt-out-file", ".microplane-ignore", "Skip repos which have this file, so they can opt out of automated changes. Empty to push to every repo")
+	pushCmd.Flags().IntVar(&pushFlagMergeablePolls, "mergeable-polls", 0, "Number of times to read each PR while Github works out whether it has conflicts, 0 to not wait")
+	pushCmd.Flags().StringVar(&pushFlagMergeablePollInterval, "mergeable-poll-interval", "2s", "How long to wait between reads of a PR while Github works out whether it has conflicts")
+	pushCmd.Flags().StringVar(&pushFlagGitTimeout, "git-timeout", "", "How long each git command may take before the repo fails, e.g. '5m', so a push stuck on credentials doesn't hold up the run")
+	pushCmd.Flags().IntVar(&pushFlagGitConcurrency, "git-concurrency", 5, "Number of repos to run `git push` for at once")
+	pushCmd.Flags().IntVar(&pushFlagAPIConcurrency, "api-concurrency", 5, "Number of repos to make Github API calls for, e.g. to open and update PRs, at once. Requests are still paced by the Github rate limit")
+	pushCmd.Flags().BoolVar(&pushFlagForcePush, "force-push", true, "Force-push each branch. Without it, a branch with commits that aren't in the plan, e.g. a teammate's, fails to push instead of being overwritten")
+	pushCmd.Flags().BoolVar(&pushFlagForcePushFallback, "force-push-fallback", false, "When a branch is protected against force-pushes, push to the branch suffixed with -fallback and open a new PR from it, instead of failing. Later runs push straight to the fallback branch")
+	pushCmd.Flags().StringVar(&pushFlagRemote, "remote", "origin", "Name of the git remote to push to")
+	pushCmd.Flags().StringVar(&pushFlagHeadOwner, "head-owner", "", "Owner of the forks the branches are pushed to, to open PRs from forks. Use --remote to push to the forks")
+	pushCmd.Flags().BoolVar(&pushFlagRetryWithMinimalBody, "retry-with-minimal-body", false, "When a repo rejects a PR as invalid, e.g. a bot requiring fields in the body, retry with just the title as the body")
+	pushCmd.Flags().BoolVar(&pushFlagAutoMerge, "auto-merge", false, "Turn on Github's auto-merge for each PR, so it merges itself once required checks pass. Repos must allow auto-merge")
+	pushCmd.Flags().StringVar(&pushFlagMergeMethod, "merge-method", push.MergeMethodMerge, "How --auto-merge merges PRs: merge, squash, or rebase")
+	pushCmd.Flags().BoolVar(&pushFlagIgnoreWhitespace, "ignore-whitespace", false, "Treat changes which only touch whitespace as no changes, so they don't open PRs")
+	pushCmd.Flags().BoolVar(&pushFlagSkipReadOnly, "skip-read-only", false, "Skip repos the Github token can read but not push to, instead of failing (costs an extra Github API request per repo)")
+	pushCmd.Flags().BoolVar(&pushFlagSkipPRDisabled, "skip-pr-disabled", false, "Skip repos which don't accept PRs, e.g. archived repos, instead of failing")
+	pushCmd.Flags().StringVar(&pushFlagWindowStart, "window-start", "", "Only push during a maintenance window starting at this time of day, e.g. '09:00'")
+	pushCmd.Flags().StringVar(&pushFlagWindowEnd, "window-end", "", "End of the maintenance window, e.g. '17:00'. Before --window-start means it spans midnight")
+	pushCmd.Flags().StringVar(&pushFlagWindowTimezone, "window-timezone", "Local", "Timezone of the maintenance window, e.g. 'America/Los_Angeles'")
+	pushCmd.Flags().StringSliceVar(&pushFlagWindowDays, "window-days", []string{}, "Days the maintenance window is open, e.g. 'mon,tue,wed,thu,fri'. Defaults to every day")
+	pushCmd.Flags().BoolVar(&pushFlagWindowWait, "window-wait", false, "Wait for the maintenance window to open, instead of refusing to push")
+	pushCmd.Flags().BoolVar(&pushFlagForce, "force", false, "Push even outside the maintenance window")
+	pushCmd.Flags().BoolVar(&pushFlagSkipUpToDate, "skip-up-to-date", false, "Don't update an open PR's title and body when its branch was already up to date")
+	pushCmd.Flags().BoolVar(&pushFlagConfigHash, "config-hash", false, "Record a hash of each repo's planned change and push config in its PR body")
+	pushCmd.Flags().BoolVar(&pushFlagSkipUnchanged, "skip-unchanged", false, "Don't push again when the open PR's config hash matches. Implies --config-hash")
+	pushCmd.Flags().StringVar(&pushFlagSourceBranch, "source-branch", "", "Local branch with the planned change, to push instead of HEAD")
+	pushCmd.Flags().BoolVar(&pushFlagBodyFooter, "body-footer", false, "Append a footer to each PR body with the run ID, microplane version, time, and a link to microplane's docs")
+	pushCmd.Flags().StringVar(&pushFlagBodyFooterTemplate, "body-footer-template", "", "Footer to append to each PR body instead, e.g. 'Run {{.RunID}} by microplane {{.Version}}'. {{.Org}}, {{.Repo}}, {{.RunID}}, {{.Version}}, {{.Timestamp}}, and {{.DocsURL}} are available")
+	pushCmd.Flags().BoolVar(&pushFlagBodyFooterHidden, "body-footer-hidden", false, "Hide the footer in an HTML comment, so it's only visible in the PR body's source")
+	pushCmd.Flags().StringVar(&pushFlagRunID, "run-id", "", "Mark PRs with this ID, so re-runs find them even if their branch was renamed on Github")
+	pushCmd.Flags().StringVar(&pushFlagPlanName, "plan-name", "", "Mark PRs with this plan's name, so re-runs find them even after the plan's branch name changed")
+	pushCmd.Flags().BoolVar(&pushFlagStrictMarkers, "strict-markers", false, "Only reuse a branch's open PR if it has this push's --run-id, --plan-name, or --config-hash marker, otherwise push to a separate branch and open a new PR")
+	pushCmd.Flags().StringVar(&pushFlagRenamedBranch, "renamed-branch", push.RenamedBranchAdopt, "When --plan-name finds the PR on another branch: adopt to push to the PR's branch, or warn to open a new PR and report the old one")
+	pushCmd.Flags().StringVar(&pushFlagDiffBase, "diff-base", "", "Ref to summarize the diff against, e.g. a release tag. Defaults to the PR's base")
+	pushCmd.Flags().BoolVar(&pushFlagFetchBase, "fetch-base", false, "Fetch the base branch into shallow clones before diffing against it")
+	pushCmd.Flags().StringSliceVar(&pushFlagBuildURLAllowHosts, "build-url-allow-host", []string{}, "Only report CI build URLs on these hosts, e.g. 'circleci.com'")
+	pushCmd.Flags().StringSliceVar(&pushFlagBuildURLDenyHosts, "build-url-deny-host", []string{}, "Never report CI build URLs on these hosts, e.g. 'ci.internal.example.com'")
+	pushCmd.Flags().StringVar(&pushFlagStatusAggregation, "status-aggregation", "github", "How to combine mixed status contexts: github, strict (any failure wins), or lenient (pending until every context completes)")
+	pushCmd.Flags().StringSliceVar(&pushFlagIgnoreContexts, "ignore-context", []string{}, "Status contexts (or globs) to ignore when computing the PR's status, e.g. 'license/cla'")
+
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringVarP(&reportFlagOutput, "output", "o", "report.md", "Path to write the report to")
+	reportCmd.Flags().StringVar(&reportFlagTitle, "title", "Microplane Report", "Title of the report")
 
 	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVar(&statusFlagReviewComments, "review-comments", false, "Count each PR's review comments and unresolved threads (costs extra Github API requests)")
+	statusCmd.Flags().StringVar(&statusFlagAssigneeFormat, "assignee-format", push.AssigneePlain, "How to show each PR's assignee: 'plain' logins, or 'mention' (@login, which notifies them when the status is posted to Github)")
+	statusCmd.Flags().BoolVar(&statusFlagJSON, "json", false, "Print the status as JSON instead of a table")
+	statusCmd.Flags().StringVar(&statusFlagDoNotMergeLabel, "do-not-merge-label", "", "Label to add to PRs whose status is failure, and remove once it's success, e.g. 'do-not-merge'")
+	statusCmd.Flags().StringVar(&statusFlagCommentOn, "comment-on", "", "Post the status table as a comment on a Github issue, e.g. 'Clever/coordination#12'")
+	statusCmd.Flags().StringVar(&statusFlagNotifyNewlyFailing, "notify-newly-failing", "", "Notify about PRs whose status went from success or pending to failing since the last status run with this flag: 'comment' on the PR, or POST to --webhook-url with 'webhook'. Each run reads the PRs' statuses from Github, and records them in the workdir to compare against next time")
+	statusCmd.Flags().BoolVar(&statusFlagShowContexts, "show-contexts", false, "List the status contexts which haven't succeeded next to each PR's status, leaving out --ignore-context")
+	statusCmd.Flags().StringSliceVar(&statusFlagIgnoreContexts, "ignore-context", []string{}, "Status contexts (or globs) to ignore when computing the PR's status, e.g. 'license/cla'")
 
 	workDir, _ = filepath.Abs("./mp")
 
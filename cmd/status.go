@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 
@@ -12,15 +15,49 @@ import (
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/plan"
 	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/report"
 	"github.com/fatih/color"
 	"github.com/nathanleiby/diffparser"
 	"github.com/spf13/cobra"
 )
 
+// CLI flags
+var statusFlagIgnoreContexts []string
+var statusFlagCommentOn string
+var statusFlagDoNotMergeLabel string
+var statusFlagReviewComments bool
+var statusFlagJSON bool
+var statusFlagAssigneeFormat string
+var statusFlagShowContexts bool
+var statusFlagNotifyNewlyFailing string
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Status shows a workflow's progress",
 	Run: func(cmd *cobra.Command, args []string) {
+		switch statusFlagAssigneeFormat {
+		case push.AssigneePlain, push.AssigneeMention:
+		default:
+			log.Fatalf("Error parsing --assignee-format flag: expected %s or %s, got %s", push.AssigneePlain, push.AssigneeMention, statusFlagAssigneeFormat)
+		}
+		var notifier report.Notifier
+		switch statusFlagNotifyNewlyFailing {
+		case "":
+		case "comment":
+			commentNotifier, err := report.NewCommentNotifier(context.Background(), githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter)
+			if err != nil {
+				log.Fatal(err)
+			}
+			notifier = commentNotifier
+		case "webhook":
+			if webhookConfig.URL == "" {
+				log.Fatalf("Error parsing --notify-newly-failing flag: webhook needs --webhook-url")
+			}
+			notifier = webhookNotifier{}
+		default:
+			log.Fatalf("Error parsing --notify-newly-failing flag: expected comment or webhook, got %s", statusFlagNotifyNewlyFailing)
+		}
+
 		// find files and folders to explain the status of each repo
 		initPath := outputPath("", "init")
 
@@ -50,17 +87,109 @@ var statusCmd = &cobra.Command{
 			isSingleRepo = true
 		}
 
-		repos := []string{}
+		targets := []initialize.Repo{}
 		for _, r := range initOutput.Repos {
 			if singleRepo != "" && r.Name != singleRepo {
 				continue
 			}
-			repos = append(repos, r.Name)
+			targets = append(targets, r)
+		}
+		rows := printStatus(targets)
+
+		if statusFlagDoNotMergeLabel != "" {
+			for _, r := range targets {
+				if err := syncDoNotMergeLabel(r); err != nil {
+					log.Printf("%s/%s - error updating %s label: %s", r.Owner, r.Name, statusFlagDoNotMergeLabel, err.Error())
+				}
+			}
+		}
+
+		if notifier != nil {
+			for _, r := range targets {
+				if err := notifyNewlyFailing(context.Background(), r, notifier); err != nil {
+					log.Printf("%s/%s - error notifying about failing PR: %s", r.Owner, r.Name, err.Error())
+				}
+			}
+		}
+
+		if statusFlagCommentOn != "" {
+			issue, err := report.ParseIssue(statusFlagCommentOn)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := report.Comment(context.Background(), issue, rows, githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter); err != nil {
+				log.Fatalf("error commenting on %s: %s", statusFlagCommentOn, err.Error())
+			}
 		}
-		printStatus(repos)
 	},
 }
 
+// pushedPRStatus returns the repo's pushed PR and its status, excluding --ignore-context. ok is false if no PR was pushed.
+func pushedPRStatus(r initialize.Repo) (pushOutput push.Output, status string, ok bool) {
+	if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.NoChanges || pushOutput.PRDisabled || pushOutput.ReadOnly || pushOutput.ValidationFailed || pushOutput.OptedOut {
+		return pushOutput, "", false
+	}
+	status = pushOutput.PullRequestEffectiveStatus
+	if len(statusFlagIgnoreContexts) > 0 && pushOutput.PullRequestContextStatuses != nil {
+		status = push.AggregateStatus(pushOutput.PullRequestContextStatuses, statusFlagIgnoreContexts, pushOutput.StatusAggregation)
+	}
+	if status == "" {
+		status = pushOutput.PullRequestCombinedStatus
+	}
+	return pushOutput, status, true
+}
+
+// syncDoNotMergeLabel flags a pushed PR with the do-not-merge label while its status is failure
+func syncDoNotMergeLabel(r initialize.Repo) error {
+	pushOutput, status, ok := pushedPRStatus(r)
+	if !ok {
+		return nil
+	}
+	return push.SyncFailureLabel(context.Background(), r.Owner, r.Name, pushOutput.PullRequestNumber, status, statusFlagDoNotMergeLabel, githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter)
+}
+
+// notifyNewlyFailing tells the notifier about a pushed PR which started failing since the previous status run,
+// then records its status in the workdir for the next run. The status is read from Github, since the one recorded
+// by push is as old as the push. If the notifier fails, the previous status is kept, so the next run notifies again.
+func notifyNewlyFailing(ctx context.Context, r initialize.Repo, notifier report.Notifier) error {
+	pushOutput, _, ok := pushedPRStatus(r)
+	if !ok {
+		return nil
+	}
+	// the status SHA is only worth keeping when push was told to report on another commit than the PR's head
+	statusSHA := ""
+	if pushOutput.StatusSHA != pushOutput.CommitSHA {
+		statusSHA = pushOutput.StatusSHA
+	}
+	ignoreContexts := pushOutput.IgnoreContexts
+	if len(statusFlagIgnoreContexts) > 0 {
+		ignoreContexts = statusFlagIgnoreContexts
+	}
+	status, err := push.GetEffectiveStatus(ctx, r.Owner, r.Name, pushOutput.PullRequestNumber, statusSHA, ignoreContexts, pushOutput.StatusAggregation, pushOutput.CheckRuns, githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter)
+	if err != nil {
+		return err
+	}
+	current := report.PRStatus{Owner: r.Owner, Repo: r.Name, Number: pushOutput.PullRequestNumber, URL: pushOutput.PullRequestURL, Status: status}
+
+	path := outputPath(r.Name, "status")
+	var previous *report.PRStatus
+	var saved report.PRStatus
+	if loadJSON(path, &saved) == nil {
+		previous = &saved
+	}
+	if regression, ok := report.NewlyFailing(previous, current); ok && notifier != nil {
+		if err := notifier.Notify(ctx, regression); err != nil {
+			return err
+		}
+		log.Printf("%s/%s - %s went from %s to %s", r.Owner, r.Name, current.URL, regression.Previous, current.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeJSON(current, path)
+}
+
 func tabWriterWithDefaults() *tabwriter.Writer {
 	w := new(tabwriter.Writer)
 	minWidth := 0
@@ -76,19 +205,56 @@ func joinWithTab(s ...string) string {
 	return strings.Join(s, "\t")
 }
 
-func printStatus(repos []string) {
+func printStatus(repos []initialize.Repo) []report.Row {
+	rows := []report.Row{}
 	out := tabWriterWithDefaults()
-	fmt.Fprintln(out, joinWithTab("REPO", "STATUS", "DETAILS"))
+	if !statusFlagJSON {
+		fmt.Fprintln(out, joinWithTab("REPO", "STATUS", "DETAILS"))
+	}
 	for _, r := range repos {
-		status, details := getRepoStatus(r)
-		d2 := strings.TrimSpace(details)
+		status, details := getRepoStatus(r.Name)
+		row := report.Row{Repo: r.Name, Status: status, Details: details}
+		if statusFlagReviewComments {
+			addReviewActivity(r, &row)
+		}
+		rows = append(rows, row)
+		if statusFlagJSON {
+			continue
+		}
+
+		d2 := strings.TrimSpace(row.Details)
 		d3 := strings.Join(strings.Split(d2, "\n"), " ")
 		if len(d3) > 150 {
 			d3 = d3[:150] + "..."
 		}
-		fmt.Fprintln(out, joinWithTab(r, status, d3))
+		fmt.Fprintln(out, joinWithTab(r.Name, status, d3))
 	}
 	out.Flush()
+
+	if statusFlagJSON {
+		b, err := json.MarshalIndent(rows, "", "    ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+	}
+	return rows
+}
+
+// addReviewActivity counts review comments on a pushed PR. It's opt-in, since it costs extra API requests per repo.
+func addReviewActivity(r initialize.Repo, row *report.Row) {
+	var pushOutput push.Output
+	if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.NoChanges || pushOutput.PRDisabled || pushOutput.ReadOnly || pushOutput.ValidationFailed || pushOutput.OptedOut {
+		return
+	}
+	activity, err := push.GetReviewActivity(context.Background(), r.Owner, r.Name, pushOutput.PullRequestNumber, githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter)
+	if err != nil {
+		log.Printf("%s/%s - error counting review comments: %s", r.Owner, r.Name, err.Error())
+		return
+	}
+	row.ReviewComments = activity.ReviewComments
+	row.UnresolvedThreads = activity.UnresolvedThreads
+	row.Details = fmt.Sprintf("%s review comments:%d unresolved threads:%d", row.Details, activity.ReviewComments, activity.UnresolvedThreads)
 }
 
 func getRepoStatus(repo string) (status, details string) {
@@ -135,8 +301,37 @@ func getRepoStatus(repo string) (status, details string) {
 		}
 		return
 	}
+	if pushOutput.NoChanges {
+		status = "no changes"
+		details = pushOutput.NoChangesReason
+		return
+	}
+	if pushOutput.OptedOut {
+		status = "opted out"
+		details = pushOutput.OptedOutReason
+		return
+	}
+	if pushOutput.PRDisabled {
+		status = "PRs disabled"
+		details = pushOutput.PRDisabledReason
+		return
+	}
+	if pushOutput.ReadOnly {
+		status = "read only"
+		details = pushOutput.ReadOnlyReason
+		return
+	}
+	if pushOutput.ValidationFailed {
+		status = "validation " + pushOutput.ValidationConclusion
+		details = pushOutput.ValidationURL
+		return
+	}
 	status = "pushed"
-	details = pushOutput.String()
+	if len(statusFlagIgnoreContexts) > 0 && pushOutput.PullRequestContextStatuses != nil {
+		pushOutput.PullRequestEffectiveStatus = push.AggregateStatus(pushOutput.PullRequestContextStatuses, statusFlagIgnoreContexts, pushOutput.StatusAggregation)
+		pushOutput.IgnoreContexts = statusFlagIgnoreContexts
+	}
+	details = pushOutput.Format(statusFlagAssigneeFormat, statusFlagShowContexts)
 
 	var mergeOutput struct {
 		merge.Output
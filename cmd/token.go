@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// githubToken authenticates Github API requests. It's resolved before each command runs, see resolveGithubToken
+var githubToken string
+
+// resolveGithubToken finds a Github token in GITHUB_API_TOKEN or, failing that, from the gh CLI's login,
+// which may keep it in a config file or the system keychain. It's empty if neither has one.
+func resolveGithubToken() string {
+	if token := os.Getenv("GITHUB_API_TOKEN"); token != "" {
+		return token
+	}
+	output, err := exec.Command("gh", "auth", "token").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/report"
+)
+
+// CLI flags
+var rootFlagTrackingRepo string
+var rootFlagTrackingTitle string
+
+// trackingIssue is the campaign's tracking issue, if --tracking-repo is set
+var trackingIssue *report.Tracker
+
+// trackingState is persisted so later runs reuse the same tracking issue
+type trackingState struct {
+	Issue report.Issue
+	Title string
+}
+
+func trackingStatePath() string {
+	return path.Join(workDir, "tracking-issue.json")
+}
+
+// openTrackingIssue finds or creates the tracking issue, if --tracking-repo is set
+func openTrackingIssue(ctx context.Context) {
+	if rootFlagTrackingRepo == "" {
+		return
+	}
+	parts := strings.Split(rootFlagTrackingRepo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Fatalf("Error parsing --tracking-repo flag: expected owner/repo, got %s", rootFlagTrackingRepo)
+	}
+	if rootFlagTrackingTitle == "" {
+		log.Fatal("--tracking-title is required with --tracking-repo")
+	}
+
+	number := 0
+	var state trackingState
+	if loadJSON(trackingStatePath(), &state) == nil && state.Issue.Owner == parts[0] && state.Issue.Repo == parts[1] && state.Title == rootFlagTrackingTitle {
+		number = state.Issue.Number
+	}
+	var err error
+	trackingIssue, err = report.OpenTracker(ctx, parts[0], parts[1], rootFlagTrackingTitle, number, githubToken, rootFlagGithubBaseURL, userAgent, githubLimiter)
+	if err != nil {
+		log.Fatalf("could not open tracking issue: %s", err.Error())
+	}
+	if err := writeJSON(trackingState{Issue: trackingIssue.Issue, Title: trackingIssue.Title}, trackingStatePath()); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("tracking PRs in %s/%s#%d", trackingIssue.Issue.Owner, trackingIssue.Issue.Repo, trackingIssue.Issue.Number)
+}
+
+// trackPR adds the repo's PR to the tracking issue, checked once it's merged.
+// A failure is only logged, since the issue can be brought up to date by a later run.
+func trackPR(ctx context.Context, r initialize.Repo, number int, url string, merged bool) {
+	if trackingIssue == nil || url == "" {
+		return
+	}
+	name := fmt.Sprintf("%s/%s#%d", r.Owner, r.Name, number)
+	if err := trackingIssue.Track(ctx, name, url, merged); err != nil {
+		log.Printf("%s/%s - could not update tracking issue: %s", r.Owner, r.Name, err.Error())
+	}
+}
+
+// summarizeTracking comments on the tracking issue with the run's summary
+func summarizeTracking(ctx context.Context, repos []initialize.Repo) {
+	if trackingIssue == nil {
+		return
+	}
+	rows := []report.Row{}
+	for _, r := range repos {
+		rows = append(rows, reportRow(r.Name))
+	}
+	if err := trackingIssue.Summarize(ctx, rows); err != nil {
+		log.Printf("could not summarize the run on the tracking issue: %s", err.Error())
+	}
+}
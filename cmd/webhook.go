@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/report"
+	"github.com/Clever/microplane/webhook"
+)
+
+// CLI flags
+var rootFlagWebhookURL string
+var rootFlagWebhookAttempts int
+var rootFlagWebhookBackoff string
+var rootFlagWebhookDeadLetter string
+
+// webhookConfig is set from the flags before each command runs
+var webhookConfig webhook.Config
+
+// sendWebhook reports the repo's result for a step, if --webhook-url is set.
+// A failed delivery is only logged, since it's in the dead-letter file.
+func sendWebhook(ctx context.Context, r initialize.Repo, step string, output interface{}, err error) {
+	if webhookConfig.URL == "" {
+		return
+	}
+	payload := webhook.Payload{
+		Owner:   r.Owner,
+		Repo:    r.Name,
+		Step:    step,
+		Success: err == nil,
+		Output:  output,
+	}
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	if err := webhook.Deliver(ctx, webhookConfig, payload); err != nil {
+		log.Printf("%s/%s - could not deliver %s webhook: %s", r.Owner, r.Name, step, err.Error())
+	}
+}
+
+// webhookNotifier POSTs each PR which started failing to --webhook-url, as a failed "status" step
+type webhookNotifier struct{}
+
+func (webhookNotifier) Notify(ctx context.Context, r report.Regression) error {
+	return webhook.Deliver(ctx, webhookConfig, webhook.Payload{
+		Owner:   r.Owner,
+		Repo:    r.Repo,
+		Step:    "status",
+		Success: false,
+		Error:   fmt.Sprintf("status went from %s to %s", r.Previous, r.Status),
+		Output:  r,
+	})
+}
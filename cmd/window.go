@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow is a daily time range, e.g. 09:00-17:00 on weekdays.
+// A range whose end is before its start spans midnight, and belongs to the day it starts on.
+type maintenanceWindow struct {
+	start time.Duration // since midnight
+	end   time.Duration
+	loc   *time.Location
+	days  map[time.Weekday]bool // empty means every day
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseWindow parses HH:MM start and end times, an IANA timezone (e.g. "America/Los_Angeles"),
+// and optional days (e.g. "mon", "tue")
+func parseWindow(start string, end string, timezone string, days []string) (*maintenanceWindow, error) {
+	w := &maintenanceWindow{days: map[time.Weekday]bool{}}
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("maintenance window %s-%s is empty", start, end)
+	}
+	if w.loc, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("invalid maintenance window timezone %s: %s", timezone, err)
+	}
+	for _, d := range days {
+		day, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, fmt.Errorf("invalid maintenance window day %s, expected e.g. mon", d)
+		}
+		w.days[day] = true
+	}
+	return w, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid maintenance window time %s, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// opening returns when the window opens on the day t is in
+func (w *maintenanceWindow) opening(t time.Time) time.Time {
+	t = t.In(w.loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.loc)
+	return midnight.Add(w.start)
+}
+
+func (w *maintenanceWindow) length() time.Duration {
+	if w.end > w.start {
+		return w.end - w.start
+	}
+	return 24*time.Hour - w.start + w.end
+}
+
+func (w *maintenanceWindow) onDay(t time.Time) bool {
+	return len(w.days) == 0 || w.days[t.Weekday()]
+}
+
+// contains checks whether t is within the window
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	// the window containing t opened today, or yesterday if it spans midnight
+	for _, open := range []time.Time{w.opening(t), w.opening(t.In(w.loc).AddDate(0, 0, -1))} {
+		if w.onDay(open) && !t.Before(open) && t.Before(open.Add(w.length())) {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the next time the window opens after t
+func (w *maintenanceWindow) next(t time.Time) time.Time {
+	for i := 0; i <= 7; i++ {
+		open := w.opening(t.In(w.loc).AddDate(0, 0, i))
+		if w.onDay(open) && open.After(t) {
+			return open
+		}
+	}
+	// unreachable, every window opens at least once a week
+	return t
+}
+
+// checkPushWindow blocks pushes outside the maintenance window, unless --force is set.
+// With --window-wait, it waits for the window to open instead.
+func checkPushWindow(now time.Time) error {
+	if pushWindow == nil || pushFlagForce || pushWindow.contains(now) {
+		return nil
+	}
+	next := pushWindow.next(now)
+	if !pushFlagWindowWait {
+		return fmt.Errorf("pushes are blocked outside the maintenance window, which next opens at %s (use --force to override)", next.Format(time.RFC1123))
+	}
+	log.Printf("waiting for the maintenance window to open at %s", next.Format(time.RFC1123))
+	time.Sleep(next.Sub(now))
+	return nil
+}
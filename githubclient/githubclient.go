@@ -0,0 +1,68 @@
+package githubclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// New is a client authenticated with token, for github.com or for the Github Enterprise API at baseURL if it's set,
+// e.g. "https://github.example.com/api/v3/". userAgent, if set, identifies microplane's requests to Github.
+func New(ctx context.Context, token string, baseURL string, userAgent string) (*github.Client, error) {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+	client := github.NewClient(tc)
+	if baseURL != "" {
+		uploadURL, err := enterpriseUploadURL(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		if client, err = github.NewEnterpriseClient(baseURL, uploadURL, tc); err != nil {
+			return nil, err
+		}
+	}
+	if userAgent != "" {
+		client.UserAgent = userAgent
+	}
+	return client, nil
+}
+
+// enterpriseUploadURL derives the uploads endpoint from a Github Enterprise API URL,
+// which is /api/uploads/ on the same host as /api/v3/
+func enterpriseUploadURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("Github base URL %s must be absolute, e.g. https://github.example.com/api/v3/", baseURL)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if strings.HasSuffix(path, "/api/v3") {
+		u.Path = strings.TrimSuffix(path, "/v3") + "/uploads/"
+	} else {
+		u.Path = "/api/uploads/"
+	}
+	return u.String(), nil
+}
+
+// Do sends a request for an endpoint the vendored go-github doesn't support: preview features, the Actions and Checks
+// APIs, and GraphQL. It goes through client, so it has the client's transport, authentication, user agent, and base URL,
+// and urlStr is relative to the REST API's root, e.g. "../graphql" for /api/graphql next to /api/v3/ on Github Enterprise.
+// accept, if set, replaces the Accept header, e.g. with a preview's media type. The response is decoded into v, if set.
+func Do(ctx context.Context, client *github.Client, method string, urlStr string, accept string, body interface{}, v interface{}) (*github.Response, error) {
+	req, err := client.NewRequest(method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return client.Do(ctx, req, v)
+}
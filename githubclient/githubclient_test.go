@@ -0,0 +1,63 @@
+package githubclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnterpriseUploadURL(t *testing.T) {
+	for base, upload := range map[string]string{
+		"https://github.example.com/api/v3/": "https://github.example.com/api/uploads/",
+		"https://github.example.com/api/v3":  "https://github.example.com/api/uploads/",
+		"https://github.example.com/":        "https://github.example.com/api/uploads/",
+	} {
+		u, err := enterpriseUploadURL(base)
+		assert.NoError(t, err)
+		assert.Equal(t, upload, u, base)
+	}
+
+	_, err := enterpriseUploadURL("github.example.com/api/v3")
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	client, err := New(context.Background(), "token", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.github.com/", client.BaseURL.String())
+
+	client, err = New(context.Background(), "token", "https://github.example.com/api/v3", "microplane/1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3/", client.BaseURL.String())
+	assert.Equal(t, "https://github.example.com/api/uploads/", client.UploadURL.String())
+	assert.Equal(t, "microplane/1.0", client.UserAgent)
+
+	_, err = New(context.Background(), "token", "github.example.com/api/v3", "")
+	assert.Error(t, err)
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/graphql", r.URL.Path)
+		assert.Equal(t, "application/vnd.github.example-preview+json", r.Header.Get("Accept"))
+		assert.Equal(t, "microplane/1.0", r.Header.Get("User-Agent"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"data": {"ok": true}}`)
+	}))
+	defer server.Close()
+	client, err := New(context.Background(), "token", server.URL+"/api/v3/", "microplane/1.0")
+	assert.NoError(t, err)
+
+	var result struct {
+		Data struct {
+			OK bool
+		}
+	}
+	_, err = Do(context.Background(), client, "POST", "../graphql", "application/vnd.github.example-preview+json", map[string]string{"query": "{}"}, &result)
+	assert.NoError(t, err)
+	assert.True(t, result.Data.OK)
+}
@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"sort"
+	"time"
 
+	"github.com/Clever/microplane/githubclient"
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 // Repo describes a GithubRepository
@@ -22,7 +22,15 @@ type Repo struct {
 type Input struct {
 	WorkDir string
 	Query   string
+	// Search is the kind of Github search Query is: SearchCode (the default) or SearchRepositories
+	Search  string
 	Version string
+	// UserAgent, if set, identifies microplane's requests to Github
+	UserAgent string
+	// GithubToken authenticates requests to Github
+	GithubToken string
+	// GithubBaseURL, if set, is the API of a Github Enterprise server, e.g. "https://github.example.com/api/v3/"
+	GithubBaseURL string
 }
 
 // Output for Initialize
@@ -40,7 +48,7 @@ func (a ByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
 
 // Initialize searches Github for matching repos
 func Initialize(input Input) (Output, error) {
-	repos, err := githubSearch(input.Query)
+	repos, err := githubSearch(input)
 	if err != nil {
 		return Output{}, err
 	}
@@ -51,38 +59,54 @@ func Initialize(input Input) (Output, error) {
 	}, nil
 }
 
+// Kinds of Github search for Input.Search
+const (
+	// SearchCode finds repos with code matching the query, e.g. "org:Clever filename:circle.yml"
+	SearchCode = "code"
+	// SearchRepositories finds repos matching the query, e.g. "org:Clever topic:go archived:false"
+	SearchRepositories = "repo"
+)
+
+// maxSearchRetries caps how many times a rate limited search page is tried again, so a persistent limit fails the init
+const maxSearchRetries = 5
+
 // githubSearch queries github and returns a list of matching repos
 //
 // GitHub Code Search Syntax:
 // https://help.github.com/articles/searching-code/
-func githubSearch(query string) ([]Repo, error) {
+func githubSearch(input Input) ([]Repo, error) {
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_API_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-
-	client := github.NewClient(tc)
+	client, err := githubclient.New(ctx, input.GithubToken, input.GithubBaseURL, input.UserAgent)
+	if err != nil {
+		return nil, err
+	}
 
-	opts := &github.SearchOptions{}
-	allRepos := map[string]*github.Repository{}
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	// keyed by full name, since repos in different orgs can share a name
+	allRepos := map[string]github.Repository{}
 	numProcessedResults := 0
+	retries := 0
 	for {
-		result, resp, err := client.Search.Code(context.Background(), query, opts)
+		page, total, incompleteResults, resp, err := searchPage(ctx, client, input.Query, input.Search, opts)
+		if wait, ok := searchRateLimited(err, time.Now()); ok && retries < maxSearchRetries {
+			retries++
+			log.Printf("search rate limited, waiting %s", wait)
+			time.Sleep(wait)
+			continue
+		}
 		if err != nil {
-			log.Printf("Search.Code returned error: %v", err)
+			return nil, err
 		}
+		retries = 0
 
-		for _, codeResult := range result.CodeResults {
+		for _, r := range page {
 			numProcessedResults = numProcessedResults + 1
-			repoCopy := *codeResult.Repository
-			allRepos[*codeResult.Repository.Name] = &repoCopy
+			allRepos[r.GetFullName()] = r
 		}
 
-		incompleteResults := result.GetIncompleteResults()
 		if incompleteResults {
 			log.Println("WARNING: Github API timed out before completing query")
-			log.Printf("processed %d of about %d results -- next page is %d", numProcessedResults, *result.Total, resp.NextPage)
+			log.Printf("processed %d of about %d results -- next page is %d", numProcessedResults, total, resp.NextPage)
 		}
 
 		if resp.NextPage == 0 {
@@ -91,14 +115,67 @@ func githubSearch(query string) ([]Repo, error) {
 		opts.Page = resp.NextPage
 	}
 
+	// the workdir is keyed by repo name, so repos sharing a name would overwrite each other's clone and plan
+	byName := map[string]string{}
+	for fullName, r := range allRepos {
+		if other, ok := byName[r.GetName()]; ok {
+			return nil, fmt.Errorf("search found both %s and %s, narrow the query so repo names are unique", other, fullName)
+		}
+		byName[r.GetName()] = fullName
+	}
+
 	repos := []Repo{}
 	for _, r := range allRepos {
+		// Github Enterprise repos are cloned from its own host
+		cloneURL := r.GetSSHURL()
+		if cloneURL == "" {
+			cloneURL = fmt.Sprintf("git@github.com:%s", r.GetFullName())
+		}
 		repos = append(repos, Repo{
 			Name:     r.GetName(),
 			Owner:    r.Owner.GetLogin(),
-			CloneURL: fmt.Sprintf("git@github.com:%s", r.GetFullName()),
+			CloneURL: cloneURL,
 		})
 	}
 
 	return repos, nil
 }
+
+// searchPage fetches a page of search results, as the repos they're in
+func searchPage(ctx context.Context, client *github.Client, query string, search string, opts *github.SearchOptions) ([]github.Repository, int, bool, *github.Response, error) {
+	if search == SearchRepositories {
+		result, resp, err := client.Search.Repositories(ctx, query, opts)
+		if err != nil {
+			return nil, 0, false, resp, err
+		}
+		return result.Repositories, result.GetTotal(), result.GetIncompleteResults(), resp, nil
+	}
+
+	result, resp, err := client.Search.Code(ctx, query, opts)
+	if err != nil {
+		return nil, 0, false, resp, err
+	}
+	repos := []github.Repository{}
+	for _, codeResult := range result.CodeResults {
+		repos = append(repos, *codeResult.Repository)
+	}
+	return repos, result.GetTotal(), result.GetIncompleteResults(), resp, nil
+}
+
+// searchRateLimited checks whether a search failed on Github's search rate limit, which is much lower than the API's,
+// and if so how long to wait before trying again
+func searchRateLimited(err error, now time.Time) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *github.RateLimitError:
+		if wait := e.Rate.Reset.Time.Sub(now); wait > 0 {
+			return wait + time.Second, true
+		}
+		return time.Second, true
+	case *github.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			return *e.RetryAfter, true
+		}
+		return time.Minute, true
+	}
+	return 0, false
+}
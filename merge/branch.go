@@ -0,0 +1,43 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// deleteHeadBranch deletes the merged PR's head branch. It never deletes the PR's base or the repo's default branch,
+// whatever they're called, nor a branch in a fork. A branch Github already deleted on merge is fine.
+// It returns why the branch was kept, if it was.
+func deleteHeadBranch(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, githubLimiter ratelimit.Limiter) (string, error) {
+	if reason := keepHeadBranch(pr); reason != "" {
+		return reason, nil
+	}
+
+	githubLimiter.Wait()
+	resp, err := client.Git.DeleteRef(ctx, input.Org, input.Repo, "heads/"+pr.GetHead().GetRef())
+	githubLimiter.Observe(resp)
+	if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity && strings.Contains(strings.ToLower(err.Error()), "reference does not exist") {
+		return "", nil
+	}
+	return "", err
+}
+
+// keepHeadBranch says why the PR's head branch mustn't be deleted, if it mustn't
+func keepHeadBranch(pr *github.PullRequest) string {
+	head := pr.GetHead().GetRef()
+	if head == pr.GetBase().GetRef() {
+		return fmt.Sprintf("head %s is the PR's base", head)
+	}
+	if head == pr.GetBase().GetRepo().GetDefaultBranch() {
+		return fmt.Sprintf("head %s is the repo's default branch", head)
+	}
+	if headRepo := pr.GetHead().GetRepo().GetFullName(); headRepo != "" && headRepo != pr.GetBase().GetRepo().GetFullName() {
+		return fmt.Sprintf("head %s is in the fork %s", head, headRepo)
+	}
+	return ""
+}
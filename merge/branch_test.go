@@ -0,0 +1,121 @@
+package merge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGithub serves a mergeable PR in a repo whose default branch is main, recording deleted refs
+type fakeGithub struct {
+	head          string
+	deleteStatus  int
+	mu            sync.Mutex
+	deletedRefs   []string
+	mergeRequests int
+}
+
+func (f *fakeGithub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	repo := map[string]interface{}{"full_name": "Clever/svc", "default_branch": "main"}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/repos/Clever/svc/pulls/1":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"number":    1,
+			"mergeable": true,
+			"head":      map[string]interface{}{"ref": f.head, "sha": "abc", "repo": repo},
+			"base":      map[string]interface{}{"ref": "main", "repo": repo},
+		})
+	case r.Method == "GET" && r.URL.Path == "/repos/Clever/svc/commits/abc/status":
+		json.NewEncoder(w).Encode(map[string]interface{}{"state": "success"})
+	case r.Method == "GET" && r.URL.Path == "/repos/Clever/svc/pulls/1/reviews":
+		json.NewEncoder(w).Encode([]interface{}{})
+	case r.Method == "PUT" && r.URL.Path == "/repos/Clever/svc/pulls/1/merge":
+		f.mergeRequests++
+		json.NewEncoder(w).Encode(map[string]interface{}{"merged": true, "sha": "def"})
+	case r.Method == "DELETE":
+		f.deletedRefs = append(f.deletedRefs, r.URL.Path)
+		if f.deleteStatus != 0 {
+			w.WriteHeader(f.deleteStatus)
+			fmt.Fprint(w, `{"message": "Reference does not exist"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func mergeWithFake(t *testing.T, f *fakeGithub, input Input) (Output, error) {
+	server := httptest.NewServer(f)
+	defer server.Close()
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	input.Org, input.Repo, input.PRNumber, input.CommitSHA = "Clever", "svc", 1, "abc"
+	return merge(context.Background(), client, input, ratelimit.NewTicker(time.Millisecond), ticker)
+}
+
+func TestMergeMainDefaultRepo(t *testing.T) {
+	f := &fakeGithub{head: "mp-update"}
+	output, err := mergeWithFake(t, f, Input{ExpectedBase: "main", RequireBuildSuccess: true})
+	assert.NoError(t, err)
+	assert.True(t, output.Success)
+	assert.Equal(t, "def", output.MergeCommitSHA)
+	assert.Empty(t, output.BranchKept)
+	assert.Equal(t, []string{"/repos/Clever/svc/git/refs/heads/mp-update"}, f.deletedRefs)
+}
+
+func TestMergeKeepsDefaultBranch(t *testing.T) {
+	f := &fakeGithub{head: "main"}
+	output, err := mergeWithFake(t, f, Input{})
+	assert.NoError(t, err)
+	assert.True(t, output.Success)
+	assert.Equal(t, "head main is the PR's base", output.BranchKept)
+	assert.Empty(t, f.deletedRefs)
+}
+
+func TestMergeBranchAlreadyDeleted(t *testing.T) {
+	// Github deleted the branch on merge, since the repo has auto-delete turned on
+	f := &fakeGithub{head: "mp-update", deleteStatus: http.StatusUnprocessableEntity}
+	output, err := mergeWithFake(t, f, Input{})
+	assert.NoError(t, err)
+	assert.True(t, output.Success)
+}
+
+func TestMergeUnexpectedBase(t *testing.T) {
+	// the campaign was pushed against master, but the PR now targets main
+	f := &fakeGithub{head: "mp-update"}
+	_, err := mergeWithFake(t, f, Input{ExpectedBase: "master"})
+	assert.EqualError(t, err, "PR targets base main, expected master")
+	assert.Equal(t, 0, f.mergeRequests)
+}
+
+func TestKeepHeadBranch(t *testing.T) {
+	repo := func(name string, defaultBranch string) *github.Repository {
+		return &github.Repository{FullName: github.String(name), DefaultBranch: github.String(defaultBranch)}
+	}
+	pr := func(head string, headRepo *github.Repository, base string) *github.PullRequest {
+		return &github.PullRequest{
+			Head: &github.PullRequestBranch{Ref: github.String(head), Repo: headRepo},
+			Base: &github.PullRequestBranch{Ref: github.String(base), Repo: repo("Clever/svc", "main")},
+		}
+	}
+	assert.Empty(t, keepHeadBranch(pr("mp-update", repo("Clever/svc", "main"), "main")))
+	assert.Empty(t, keepHeadBranch(pr("mp-update", repo("Clever/svc", "main"), "release")))
+	assert.Equal(t, "head main is the repo's default branch", keepHeadBranch(pr("main", repo("Clever/svc", "main"), "release")))
+	assert.Equal(t, "head mp-update is in the fork someone/svc", keepHeadBranch(pr("mp-update", repo("someone/svc", "main"), "main")))
+}
@@ -0,0 +1,61 @@
+package merge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"text/template"
+)
+
+// Command represents a command to run.
+type Command struct {
+	Path string
+	Args []string
+}
+
+// HookData is available to the PostMerge command's arguments, e.g. {{.PRNumber}}
+type HookData struct {
+	Org            string
+	Repo           string
+	PRNumber       int
+	MergeCommitSHA string
+}
+
+// expand renders each of the command's arguments as a text/template
+func (c Command) expand(data HookData) (Command, error) {
+	expanded := Command{Path: c.Path}
+	for _, arg := range c.Args {
+		rendered, err := render("post-merge argument", arg, data)
+		if err != nil {
+			return expanded, err
+		}
+		expanded.Args = append(expanded.Args, rendered)
+	}
+	return expanded, nil
+}
+
+// render executes text as a text/template of data. what describes the template in errors.
+func render(what string, text string, data HookData) (string, error) {
+	tmpl, err := template.New(what).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse %s %q: %s", what, text, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render %s %q: %s", what, text, err)
+	}
+	return b.String(), nil
+}
+
+// runPostMerge runs the hook, returning its combined output.
+// The merge already happened, so a failure is reported rather than undoing anything.
+func runPostMerge(ctx context.Context, hook Command, data HookData) (string, error) {
+	cmd, err := hook.expand(data)
+	if err != nil {
+		return "", err
+	}
+	execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
+	output, err := execCmd.CombinedOutput()
+	return string(output), err
+}
@@ -0,0 +1,26 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpand(t *testing.T) {
+	hook := Command{Path: "deploy", Args: []string{"--repo", "{{.Org}}/{{.Repo}}", "--pr={{.PRNumber}}", "{{.MergeCommitSHA}}"}}
+	cmd, err := hook.expand(HookData{Org: "Clever", Repo: "microplane", PRNumber: 12, MergeCommitSHA: "abc123"})
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Path: "deploy", Args: []string{"--repo", "Clever/microplane", "--pr=12", "abc123"}}, cmd)
+
+	_, err = Command{Path: "deploy", Args: []string{"{{.Nope}}"}}.expand(HookData{})
+	assert.Error(t, err)
+}
+
+func TestRender(t *testing.T) {
+	name, err := render("tag name", "release-{{.Repo}}-{{.PRNumber}}", HookData{Repo: "microplane", PRNumber: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, "release-microplane-12", name)
+
+	_, err = render("tag name", "release-{{.Repo", HookData{})
+	assert.Error(t, err)
+}
@@ -3,11 +3,14 @@ package merge
 import (
 	"context"
 	"fmt"
-	"os"
+	"log"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 // Input to Push()
@@ -20,18 +23,60 @@ type Input struct {
 	PRNumber int
 	// CommitSHA for the commit which opened the above PR. Used to look up Commit status.
 	CommitSHA string
+	// UserAgent, if set, identifies microplane's requests to Github
+	UserAgent string
+	// GithubToken authenticates requests to Github
+	GithubToken string
+	// GithubBaseURL, if set, is the API of a Github Enterprise server, e.g. "https://github.example.com/api/v3/"
+	GithubBaseURL string
+	// ExpectedBase is the branch the PR should target. If set, PRs which were retargeted elsewhere aren't merged.
+	ExpectedBase string
 	// RequireReviewApproval specifies if the PR must be approved before merging
 	// - must have at least 1 reviewer
 	// - all reviewers must have explicitly approved
 	RequireReviewApproval bool
+	// MinApprovals is the number of reviewers whose latest review must be an approval
+	MinApprovals int
 	// RequireBuildSuccess specifies if the PR must have a successful build before merging
 	RequireBuildSuccess bool
+	// BaseModifiedRetries is how many times to retry the merge when Github reports the base branch was modified
+	BaseModifiedRetries int
+	// BaseModifiedRetryInterval is how long to wait before each of those retries
+	BaseModifiedRetryInterval time.Duration
+	// UpdateBehind updates a PR which is behind its base by merging the base into it, then merges it once it's up to date
+	UpdateBehind bool
+	// UpdateBranchPolls bounds how many times to check whether the update (and its build, if required) finished
+	UpdateBranchPolls int
+	// UpdateBranchPollInterval is how long to wait before each of those checks
+	UpdateBranchPollInterval time.Duration
+	// Tag, if its Name is set, tags the merge commit once the PR is merged
+	Tag TagOnMerge
+	// PostMerge, if set, runs after the PR is merged, with its arguments expanded as templates of HookData.
+	// It doesn't run for PRs which were already merged, or which couldn't be merged.
+	PostMerge *Command
 }
 
 // Output from Push()
 type Output struct {
 	Success        bool
 	MergeCommitSHA string
+	// Approvals is the number of reviewers whose latest review is an approval
+	Approvals int
+	// Retries is the number of merge attempts retried because the base branch was modified
+	Retries int
+	// BranchUpdated is set when the PR was behind its base, and was updated before merging, see Input.UpdateBehind
+	BranchUpdated bool
+	// BranchKept is why the PR's head branch wasn't deleted after merging, e.g. it's the repo's default branch
+	BranchKept string
+	// Tag is the name of the tag created on the merge commit, see Input.Tag
+	Tag      string
+	TagError string
+	// PostMergeOutput is the combined output of Input.PostMerge
+	PostMergeOutput string
+	// PostMergeError is set when Input.PostMerge failed. The merge itself still succeeded.
+	PostMergeError string
+	// Pacing is how long the merge's Github requests waited on rate limits, if the caller tracked it
+	Pacing ratelimit.Waits
 }
 
 // Error and details from Push()
@@ -43,19 +88,22 @@ type Error struct {
 // Merge an open PR in Github
 // - githubLimiter rate limits the # of calls to Github
 // - mergeLimiter rate limits # of merges, to prevent load when submitting builds to CI system
-func Merge(ctx context.Context, input Input, githubLimiter *time.Ticker, mergeLimiter *time.Ticker) (Output, error) {
+func Merge(ctx context.Context, input Input, githubLimiter ratelimit.Limiter, mergeLimiter *time.Ticker) (Output, error) {
 	// Create Github Client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_API_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	client, err := githubclient.New(ctx, input.GithubToken, input.GithubBaseURL, input.UserAgent)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	return merge(ctx, client, input, githubLimiter, mergeLimiter)
+}
 
+func merge(ctx context.Context, client *github.Client, input Input, githubLimiter ratelimit.Limiter, mergeLimiter *time.Ticker) (Output, error) {
 	// OK to merge?
 
 	// (1) Check if the PR is mergeable
-	<-githubLimiter.C
-	pr, _, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+	githubLimiter.Wait()
+	pr, resp, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+	githubLimiter.Observe(resp)
 	if err != nil {
 		return Output{Success: false}, err
 	}
@@ -65,13 +113,29 @@ func Merge(ctx context.Context, input Input, githubLimiter *time.Ticker, mergeLi
 		return Output{Success: true, MergeCommitSHA: pr.GetMergeCommitSHA()}, nil
 	}
 
+	if input.ExpectedBase != "" && pr.GetBase().GetRef() != input.ExpectedBase {
+		return Output{Success: false}, fmt.Errorf("PR targets base %s, expected %s", pr.GetBase().GetRef(), input.ExpectedBase)
+	}
+
 	if !pr.GetMergeable() {
 		return Output{Success: false}, fmt.Errorf("PR is not mergeable")
 	}
 
+	commitSHA := input.CommitSHA
+	branchUpdated := false
+	if pr.GetMergeableState() == "behind" && input.UpdateBehind {
+		pr, err = updateBranch(ctx, client, input, pr, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		commitSHA = pr.GetHead().GetSHA()
+		branchUpdated = true
+	}
+
 	// (2) Check commit status
-	<-githubLimiter.C
-	status, _, err := client.Repositories.GetCombinedStatus(ctx, input.Org, input.Repo, input.CommitSHA, &github.ListOptions{})
+	githubLimiter.Wait()
+	status, resp, err := client.Repositories.GetCombinedStatus(ctx, input.Org, input.Repo, commitSHA, &github.ListOptions{})
+	githubLimiter.Observe(resp)
 	if err != nil {
 		return Output{Success: false}, err
 	}
@@ -84,8 +148,18 @@ func Merge(ctx context.Context, input Input, githubLimiter *time.Ticker, mergeLi
 	}
 
 	// (3) check if PR has been approved by a reviewer
-	<-githubLimiter.C
-	reviews, _, err := client.PullRequests.ListReviews(ctx, input.Org, input.Repo, input.PRNumber, &github.ListOptions{})
+	githubLimiter.Wait()
+	reviews, resp, err := client.PullRequests.ListReviews(ctx, input.Org, input.Repo, input.PRNumber, &github.ListOptions{PerPage: 100})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		// without the reviews, the PR counts as unreviewed, so it's still held back if approvals are required
+		log.Printf("%s/%s - could not list reviews of PR #%d: %s", input.Org, input.Repo, input.PRNumber, err)
+		reviews = nil
+	}
+	approvals := countApprovals(reviews)
+	if approvals < input.MinApprovals {
+		return Output{Success: false, Approvals: approvals}, fmt.Errorf("PR has %d of %d required approvals", approvals, input.MinApprovals)
+	}
 	if input.RequireReviewApproval {
 		if len(reviews) == 0 {
 			return Output{Success: false}, fmt.Errorf("PR awaiting review")
@@ -101,22 +175,89 @@ func Merge(ctx context.Context, input Input, githubLimiter *time.Ticker, mergeLi
 	options := &github.PullRequestOptions{}
 	commitMsg := ""
 	<-mergeLimiter.C
-	<-githubLimiter.C
-	result, _, err := client.PullRequests.Merge(ctx, input.Org, input.Repo, input.PRNumber, commitMsg, options)
+	var result *github.PullRequestMergeResult
+	retries := 0
+	for {
+		githubLimiter.Wait()
+		result, resp, err = client.PullRequests.Merge(ctx, input.Org, input.Repo, input.PRNumber, commitMsg, options)
+		githubLimiter.Observe(resp)
+		if err == nil || !isBaseModified(resp, err) {
+			break
+		}
+		if retries >= input.BaseModifiedRetries {
+			return Output{Success: false, Retries: retries}, fmt.Errorf("base branch was modified, gave up after %d retries: %s", retries, err)
+		}
+		retries++
+		time.Sleep(input.BaseModifiedRetryInterval)
+
+		// Re-read the PR, so we pick up the new base before trying again
+		githubLimiter.Wait()
+		pr, resp, err = client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return Output{Success: false, Retries: retries}, err
+		}
+	}
 	if err != nil {
-		return Output{Success: false}, err
+		return Output{Success: false, Retries: retries}, err
 	}
 
 	if !result.GetMerged() {
-		return Output{Success: false}, fmt.Errorf("failed to merge: %s", result.GetMessage())
+		return Output{Success: false, Retries: retries}, fmt.Errorf("failed to merge: %s", result.GetMessage())
 	}
 
 	// Delete the branch
-	<-githubLimiter.C
-	_, err = client.Git.DeleteRef(ctx, input.Org, input.Repo, "heads/"+*pr.Head.Ref)
+	branchKept, err := deleteHeadBranch(ctx, client, input, pr, githubLimiter)
 	if err != nil {
-		return Output{Success: false}, err
+		return Output{Success: false, Retries: retries}, err
+	}
+
+	output := Output{Success: true, MergeCommitSHA: result.GetSHA(), Approvals: approvals, Retries: retries, BranchUpdated: branchUpdated, BranchKept: branchKept}
+	data := HookData{
+		Org:            input.Org,
+		Repo:           input.Repo,
+		PRNumber:       input.PRNumber,
+		MergeCommitSHA: output.MergeCommitSHA,
+	}
+	if input.Tag.Name != "" {
+		// the PR is merged either way, so a tag failure doesn't fail the merge
+		output.Tag, err = createTag(ctx, client, input.Tag, data, githubLimiter)
+		if err != nil {
+			output.TagError = err.Error()
+		}
+	}
+	if input.PostMerge != nil {
+		output.PostMergeOutput, err = runPostMerge(ctx, *input.PostMerge, data)
+		if err != nil {
+			output.PostMergeError = err.Error()
+		}
 	}
+	return output, nil
+}
+
+// countApprovals counts reviewers whose latest review is an approval.
+// Comments don't change a reviewer's decision, but a later dismissal or request for changes does.
+func countApprovals(reviews []*github.PullRequestReview) int {
+	latest := map[string]string{}
+	for _, r := range reviews {
+		state := r.GetState()
+		if state == "COMMENTED" || state == "PENDING" {
+			continue
+		}
+		latest[r.GetUser().GetLogin()] = state
+	}
+
+	approvals := 0
+	for _, state := range latest {
+		if state == "APPROVED" {
+			approvals++
+		}
+	}
+	return approvals
+}
 
-	return Output{Success: true, MergeCommitSHA: result.GetSHA()}, nil
+// isBaseModified checks for Github's 405 response when the base branch moved between reading the PR and merging it
+func isBaseModified(resp *github.Response, err error) bool {
+	return resp != nil && resp.StatusCode == http.StatusMethodNotAllowed &&
+		strings.Contains(strings.ToLower(err.Error()), "base branch was modified")
 }
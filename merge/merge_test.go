@@ -0,0 +1,38 @@
+package merge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func review(login string, state string) *github.PullRequestReview {
+	return &github.PullRequestReview{
+		User:  &github.User{Login: github.String(login)},
+		State: github.String(state),
+	}
+}
+
+func TestCountApprovals(t *testing.T) {
+	reviews := []*github.PullRequestReview{
+		review("alice", "APPROVED"),
+		review("alice", "COMMENTED"),
+		review("bob", "APPROVED"),
+		review("bob", "DISMISSED"),
+		review("carol", "CHANGES_REQUESTED"),
+		review("carol", "APPROVED"),
+	}
+	// bob's approval was dismissed, carol's approval supersedes her request for changes
+	assert.Equal(t, 2, countApprovals(reviews))
+	assert.Equal(t, 0, countApprovals(nil))
+}
+
+func TestCreateTagFailureReportsNoName(t *testing.T) {
+	// signing without a local clone fails before anything is tagged
+	tag := TagOnMerge{Name: "release-{{.PRNumber}}", Sign: true}
+	name, err := createTag(context.Background(), nil, tag, HookData{PRNumber: 7}, nil)
+	assert.Error(t, err)
+	assert.Equal(t, "", name)
+}
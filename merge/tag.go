@@ -0,0 +1,87 @@
+package merge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// TagOnMerge creates an annotated tag on the merge commit
+type TagOnMerge struct {
+	// Name is a text/template of HookData, e.g. "release-{{.PRNumber}}"
+	Name string
+	// Message is a text/template of HookData. Defaults to the tag's name.
+	Message string
+	// Sign signs the tag with the local git config's key. Github's API can't sign tags,
+	// so signed tags are created in RepoDir and pushed to origin.
+	Sign bool
+	// RepoDir is a local clone of the repo, only needed to sign
+	RepoDir string
+}
+
+// createTag tags the merge commit, returning the tag's name
+func createTag(ctx context.Context, client *github.Client, tag TagOnMerge, data HookData, githubLimiter ratelimit.Limiter) (string, error) {
+	name, err := render("tag name", tag.Name, data)
+	if err != nil {
+		return "", err
+	}
+	message := name
+	if tag.Message != "" {
+		if message, err = render("tag message", tag.Message, data); err != nil {
+			return "", err
+		}
+	}
+
+	if tag.Sign {
+		if err := createSignedTag(ctx, tag.RepoDir, name, message, data.MergeCommitSHA); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+
+	githubLimiter.Wait()
+	created, resp, err := client.Git.CreateTag(ctx, data.Org, data.Repo, &github.Tag{
+		Tag:     &name,
+		Message: &message,
+		Object:  &github.GitObject{Type: github.String("commit"), SHA: &data.MergeCommitSHA},
+	})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return "", fmt.Errorf("could not create tag %s: %s", name, err)
+	}
+
+	ref := "refs/tags/" + name
+	githubLimiter.Wait()
+	_, resp, err = client.Git.CreateRef(ctx, data.Org, data.Repo, &github.Reference{
+		Ref:    &ref,
+		Object: &github.GitObject{SHA: created.SHA},
+	})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return "", fmt.Errorf("could not create tag ref %s: %s", ref, err)
+	}
+	return name, nil
+}
+
+// createSignedTag fetches the merge commit into dir, tags it with `git tag -s`, and pushes the tag
+func createSignedTag(ctx context.Context, dir string, name string, message string, sha string) error {
+	if dir == "" {
+		return errors.New("signing a tag needs a local clone of the repo")
+	}
+	for _, args := range [][]string{
+		{"fetch", "--no-tags", "origin", sha},
+		{"tag", "-s", "-m", message, name, sha},
+		{"push", "origin", "refs/tags/" + name},
+	} {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return errors.New(string(output))
+		}
+	}
+	return nil
+}
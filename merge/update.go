@@ -0,0 +1,61 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// updateBranch merges the base into a PR which is behind it, then waits for Github to finish the update
+// and, if the build must succeed, for the updated head's build to finish.
+func updateBranch(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, githubLimiter ratelimit.Limiter) (*github.PullRequest, error) {
+	oldHead := pr.GetHead().GetSHA()
+	u := fmt.Sprintf("repos/%s/%s/pulls/%d/update-branch", input.Org, input.Repo, input.PRNumber)
+	githubLimiter.Wait()
+	resp, err := githubclient.Do(ctx, client, "PUT", u, "application/vnd.github.lydian-preview+json", map[string]string{"expected_head_sha": oldHead}, nil)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, fmt.Errorf("PR is behind its base, and updating it conflicts: %s", err)
+		}
+		return nil, err
+	}
+
+	// The update is asynchronous, poll until the PR has a new head
+	for poll := 0; poll < input.UpdateBranchPolls; poll++ {
+		time.Sleep(input.UpdateBranchPollInterval)
+
+		githubLimiter.Wait()
+		pr, resp, err = client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		state := pr.GetMergeableState()
+		if pr.GetHead().GetSHA() == oldHead || state == "behind" || state == "unknown" {
+			continue
+		}
+		if state == "dirty" {
+			return nil, fmt.Errorf("PR has conflicts after updating it with its base")
+		}
+		if !input.RequireBuildSuccess {
+			return pr, nil
+		}
+
+		githubLimiter.Wait()
+		status, resp, err := client.Repositories.GetCombinedStatus(ctx, input.Org, input.Repo, pr.GetHead().GetSHA(), &github.ListOptions{})
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		if status.GetState() != "pending" {
+			return pr, nil
+		}
+	}
+	return nil, fmt.Errorf("PR was updated with its base, but wasn't ready to merge after %d polls", input.UpdateBranchPolls)
+}
@@ -0,0 +1,32 @@
+package plan
+
+// How a repo's planned diff changed between two runs, see CompareDiffs
+const (
+	// DiffSame is a repo whose diff is identical in both runs
+	DiffSame = "same"
+	// DiffChanged is a repo whose diff differs between the runs
+	DiffChanged = "changed"
+	// DiffNew is a repo with a diff in the current run, but not the previous one
+	DiffNew = "new"
+	// DiffRemoved is a repo with a diff in the previous run, but not the current one
+	DiffRemoved = "removed"
+	// DiffNone is a repo without a diff in either run
+	DiffNone = "none"
+)
+
+// CompareDiffs classifies how a repo's planned diff changed from a previous run to the current one.
+// An empty diff means that run didn't plan a change to the repo.
+func CompareDiffs(previous string, current string) string {
+	switch {
+	case previous == "" && current == "":
+		return DiffNone
+	case previous == "":
+		return DiffNew
+	case current == "":
+		return DiffRemoved
+	case previous == current:
+		return DiffSame
+	default:
+		return DiffChanged
+	}
+}
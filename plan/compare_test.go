@@ -0,0 +1,16 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareDiffs(t *testing.T) {
+	diff := "diff --git a/README.md b/README.md\n-old\n+new\n"
+	assert.Equal(t, DiffSame, CompareDiffs(diff, diff))
+	assert.Equal(t, DiffChanged, CompareDiffs(diff, diff+"+more\n"))
+	assert.Equal(t, DiffNew, CompareDiffs("", diff))
+	assert.Equal(t, DiffRemoved, CompareDiffs(diff, ""))
+	assert.Equal(t, DiffNone, CompareDiffs("", ""))
+}
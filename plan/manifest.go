@@ -0,0 +1,81 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// File is a file to create in each repo
+type File struct {
+	// Path relative to the root of the repo
+	Path string
+	// Content is a text/template, rendered with the repo's TemplateData
+	Content string
+}
+
+// Manifest declares files to create in each repo, instead of running a command
+type Manifest struct {
+	Files []File
+}
+
+// TemplateData is available to a manifest file's Content, e.g. {{.RepoName}}
+type TemplateData struct {
+	RepoName  string
+	RepoOwner string
+}
+
+// LoadManifest reads a JSON manifest from disk
+func LoadManifest(path string) (Manifest, error) {
+	var manifest Manifest
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(bs, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest %s: %s", path, err)
+	}
+	for _, f := range manifest.Files {
+		if !insideRepo(f.Path) {
+			return manifest, fmt.Errorf("invalid manifest %s: file path %s must be relative to the repo and stay inside it", path, f.Path)
+		}
+	}
+	return manifest, nil
+}
+
+// insideRepo is whether a manifest file path names a file inside the repo, e.g. not /etc/passwd or ../other-repo/file
+func insideRepo(path string) bool {
+	if path == "" || filepath.IsAbs(path) {
+		return false
+	}
+	cleaned := filepath.Clean(path)
+	return cleaned != "." && cleaned != ".." && !strings.HasPrefix(cleaned, ".."+string(filepath.Separator))
+}
+
+// writeFiles renders each file's content and writes it into dir
+func writeFiles(dir string, files []File, data TemplateData) error {
+	for _, f := range files {
+		tmpl, err := template.New(f.Path).Parse(f.Content)
+		if err != nil {
+			return fmt.Errorf("could not parse template for %s: %s", f.Path, err)
+		}
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, data); err != nil {
+			return fmt.Errorf("could not render template for %s: %s", f.Path, err)
+		}
+
+		dest := filepath.Join(dir, f.Path)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dest, content.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package plan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microplane-plan")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := []File{
+		File{Path: ".github/workflows/ci.yml", Content: "name: {{.RepoOwner}}/{{.RepoName}}\n"},
+	}
+	err = writeFiles(dir, files, TemplateData{RepoName: "microplane", RepoOwner: "Clever"})
+	assert.NoError(t, err)
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, ".github/workflows/ci.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Clever/microplane\n", string(bs))
+}
+
+func TestLoadManifestRejectsPathsOutsideRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microplane-plan")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		path  string
+		valid bool
+	}{
+		{path: ".github/workflows/ci.yml", valid: true},
+		{path: "docs/../README.md", valid: true},
+		{path: "..foo", valid: true},
+		{path: "", valid: false},
+		{path: ".", valid: false},
+		{path: "/etc/passwd", valid: false},
+		{path: "..", valid: false},
+		{path: "../other-repo/README.md", valid: false},
+		{path: "docs/../../other-repo/README.md", valid: false},
+	} {
+		manifestPath := filepath.Join(dir, "manifest.json")
+		bs, err := json.Marshal(Manifest{Files: []File{File{Path: test.path}}})
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(manifestPath, bs, 0644))
+
+		_, err = LoadManifest(manifestPath)
+		if test.valid {
+			assert.NoError(t, err, test.path)
+		} else {
+			assert.Error(t, err, test.path)
+		}
+	}
+}
@@ -19,17 +19,24 @@ type Command struct {
 type Input struct {
 	// RepoName
 	RepoName string
+	// RepoOwner is the name of the user who owns the Github repo
+	RepoOwner string
 	// RepoDir is where the git repo to modify lives. It will be copied into WorkDir
 	RepoDir string
 	// WorkDir is where we will store some results:
 	//   - {WorkDir}/plan: stores a copy of repodir but with a new commit containing changes
 	WorkDir string
-	// Command to run
+	// Command to run. Optional if Files is set.
 	Command Command
+	// Files to create in the repo, before running Command
+	Files []File
 	// CommitMessage to send to `git commit -m`
 	CommitMessage string
 	// BranchName where the commit will be made
 	BranchName string
+	// SubmoduleMode is how to handle Command changing submodule pointers: SubmoduleWarn (the default), SubmoduleInclude,
+	// or SubmoduleIgnore
+	SubmoduleMode string
 }
 
 // Output for Plan
@@ -40,6 +47,8 @@ type Output struct {
 	GitDiff       string
 	CommitMessage string
 	BranchName    string
+	// SubmoduleChanges are the submodules Command moved. They're left out of the commit with SubmoduleIgnore.
+	SubmoduleChanges []string
 }
 
 // Plan creates a copy of the cloned repo and executes a command on it.
@@ -58,22 +67,40 @@ func Plan(ctx context.Context, input Input) (Output, error) {
 		return Output{Success: false}, errors.New(string(output))
 	}
 
-	// run the change command, git add, and git commit
-	for _, cmd := range []Command{
-		input.Command,
+	// write any files declared in a manifest
+	if err := writeFiles(planDir, input.Files, TemplateData{RepoName: input.RepoName, RepoOwner: input.RepoOwner}); err != nil {
+		return Output{Success: false}, err
+	}
+
+	// run the change command and git add
+	cmds := []Command{}
+	if input.Command.Path != "" {
+		cmds = append(cmds, input.Command)
+	}
+	cmds = append(cmds,
 		Command{Path: "git", Args: []string{"checkout", "-b", input.BranchName}},
 		Command{Path: "git", Args: []string{"add", "-A"}},
-		Command{Path: "git", Args: []string{"commit", "-m", input.CommitMessage}},
-	} {
-		execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-		execCmd.Dir = planDir
-		// Set MICROPLANE_<X> convenience env vars, for use in user's script
-		execCmd.Env = append(os.Environ(), fmt.Sprintf("MICROPLANE_REPO=%s", input.RepoName))
-		if output, err := execCmd.CombinedOutput(); err != nil {
-			return Output{Success: false}, errors.New(string(output))
+	)
+	if err := runCommands(ctx, planDir, input.RepoName, cmds); err != nil {
+		return Output{Success: false}, err
+	}
+
+	// `git add -A` stages moved submodules too, which a codemod rarely means to bump
+	submodules, err := stagedSubmodules(ctx, planDir)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	if input.SubmoduleMode == SubmoduleIgnore && len(submodules) > 0 {
+		if err := unstage(ctx, planDir, submodules); err != nil {
+			return Output{Success: false}, err
 		}
 	}
 
+	commit := Command{Path: "git", Args: []string{"commit", "-m", input.CommitMessage}}
+	if err := runCommands(ctx, planDir, input.RepoName, []Command{commit}); err != nil {
+		return Output{Success: false, SubmoduleChanges: submodules}, err
+	}
+
 	// add the git diff to output, might be useful / convenient?
 	var gitDiff string
 	gitDiffCmd := exec.CommandContext(ctx, "git", "diff", "HEAD^", "HEAD")
@@ -85,10 +112,25 @@ func Plan(ctx context.Context, input Input) (Output, error) {
 	gitDiff = string(output)
 
 	return Output{
-		Success:       true,
-		PlanDir:       planDir,
-		GitDiff:       gitDiff,
-		BranchName:    input.BranchName,
-		CommitMessage: input.CommitMessage,
+		Success:          true,
+		PlanDir:          planDir,
+		GitDiff:          gitDiff,
+		BranchName:       input.BranchName,
+		CommitMessage:    input.CommitMessage,
+		SubmoduleChanges: submodules,
 	}, nil
 }
+
+// runCommands runs each command in dir, stopping at the first to fail
+func runCommands(ctx context.Context, dir string, repoName string, cmds []Command) error {
+	for _, cmd := range cmds {
+		execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
+		execCmd.Dir = dir
+		// Set MICROPLANE_<X> convenience env vars, for use in user's script
+		execCmd.Env = append(os.Environ(), fmt.Sprintf("MICROPLANE_REPO=%s", repoName))
+		if output, err := execCmd.CombinedOutput(); err != nil {
+			return errors.New(string(output))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// How to handle changes to submodule pointers, see Input.SubmoduleMode
+const (
+	// SubmoduleWarn commits submodule changes, but reports them in Output.SubmoduleChanges so they can be warned about
+	SubmoduleWarn = "warn"
+	// SubmoduleInclude commits submodule changes, as they're expected
+	SubmoduleInclude = "include"
+	// SubmoduleIgnore leaves submodule changes out of the commit
+	SubmoduleIgnore = "ignore"
+)
+
+// submoduleMode is a git file mode for a submodule (a "gitlink")
+const submoduleMode = "160000"
+
+// stagedSubmodules lists the submodules whose pointer is changed in dir's index
+func stagedSubmodules(ctx context.Context, dir string) ([]string, error) {
+	gitDiff := exec.CommandContext(ctx, "git", "diff", "--cached", "--raw", "--no-renames")
+	gitDiff.Dir = dir
+	output, err := gitDiff.CombinedOutput()
+	if err != nil {
+		return nil, errors.New(string(output))
+	}
+	return submodulePaths(string(output)), nil
+}
+
+// submodulePaths picks the submodules from `git diff --raw` output, whether added, moved, or removed
+func submodulePaths(rawDiff string) []string {
+	paths := []string{}
+	for _, line := range strings.Split(rawDiff, "\n") {
+		// :<old mode> <new mode> <old sha> <new sha> <status>\t<path>
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], ":") {
+			continue
+		}
+		modes := strings.Fields(strings.TrimPrefix(fields[0], ":"))
+		if len(modes) >= 2 && (modes[0] == submoduleMode || modes[1] == submoduleMode) {
+			paths = append(paths, fields[1])
+		}
+	}
+	return paths
+}
+
+// unstage leaves paths out of the next commit, keeping them as they were at HEAD
+func unstage(ctx context.Context, dir string, paths []string) error {
+	gitReset := exec.CommandContext(ctx, "git", append([]string{"reset", "-q", "--"}, paths...)...)
+	gitReset.Dir = dir
+	if output, err := gitReset.CombinedOutput(); err != nil {
+		return errors.New(string(output))
+	}
+	return nil
+}
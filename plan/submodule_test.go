@@ -0,0 +1,15 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmodulePaths(t *testing.T) {
+	raw := ":160000 160000 1111111 2222222 M\tvendor/lib\n" +
+		":100644 100644 3333333 4444444 M\tREADME.md\n" +
+		":000000 160000 0000000 5555555 A\tthird_party/new\n"
+	assert.Equal(t, []string{"vendor/lib", "third_party/new"}, submodulePaths(raw))
+	assert.Empty(t, submodulePaths(""))
+}
@@ -0,0 +1,87 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Event reports that a repo has moved to a new phase of a step
+type Event struct {
+	Repo string
+	// Phase is what's happening, e.g. "pushing branch"
+	Phase string
+	// Status is "running", "done", or "error"
+	Status string
+}
+
+// Reporter receives progress events from concurrently running repos
+type Reporter interface {
+	Report(e Event)
+}
+
+// New returns a live Table if stdout is a terminal, or else a Logger
+func New() Reporter {
+	if isTerminal(os.Stdout) {
+		return NewTable(os.Stdout)
+	}
+	return Logger{}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Logger reports each event as a log line
+type Logger struct{}
+
+// Report logs the event
+func (l Logger) Report(e Event) {
+	log.Printf("%s - %s (%s)", e.Repo, e.Phase, e.Status)
+}
+
+// Table redraws a table of each repo's latest event, using ANSI escape codes
+type Table struct {
+	mu     sync.Mutex
+	out    io.Writer
+	repos  []string
+	latest map[string]Event
+	drawn  int
+}
+
+// NewTable returns a Table which draws to out
+func NewTable(out io.Writer) *Table {
+	return &Table{out: out, latest: map[string]Event{}}
+}
+
+// Report updates the repo's row and redraws the table
+func (t *Table) Report(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.latest[e.Repo]; !ok {
+		t.repos = append(t.repos, e.Repo)
+	}
+	t.latest[e.Repo] = e
+
+	// move the cursor back to the top of the previously drawn table
+	if t.drawn > 0 {
+		fmt.Fprintf(t.out, "\x1b[%dA", t.drawn)
+	}
+	fmt.Fprintf(t.out, "\x1b[2K%-30s %-8s %s\n", "REPO", "STATUS", "PHASE")
+	for _, repo := range t.repos {
+		latest := t.latest[repo]
+		fmt.Fprintf(t.out, "\x1b[2K%-30s %-8s %s\n", repo, latest.Status, truncate(latest.Phase, 80))
+	}
+	t.drawn = len(t.repos) + 1
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
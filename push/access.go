@@ -0,0 +1,151 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// AccessError is returned by CheckAccess when the token can't see a repo because it has no access to the repo's owner,
+// as opposed to the repo not existing. Github reports both as a 404.
+type AccessError struct {
+	Owner string
+	// Login is the token's user
+	Login string
+	// Scopes are the token's OAuth scopes. They're unknown (nil) for fine-grained tokens and Github Apps.
+	Scopes []string
+	// Reason is what's missing
+	Reason string
+}
+
+func (e *AccessError) Error() string {
+	scopes := "unknown"
+	if e.Scopes != nil {
+		scopes = strings.Join(e.Scopes, ", ")
+	}
+	return fmt.Sprintf("the Github token for %s has no access to %s's repos: %s (token scopes: %s)", e.Login, e.Owner, e.Reason, scopes)
+}
+
+// CheckAccess checks that the token can see owner/name. If it can't, and that's because the token's user isn't a member
+// of the owner org or the token lacks the repo scope, it returns an *AccessError. A repo which doesn't exist isn't an error,
+// so a typo in one repo's name doesn't stop the rest.
+func CheckAccess(ctx context.Context, owner string, name string, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) error {
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return err
+	}
+	return checkAccess(ctx, client, owner, name, githubLimiter)
+}
+
+func checkAccess(ctx context.Context, client *github.Client, owner string, name string, githubLimiter ratelimit.Limiter) error {
+	githubLimiter.Wait()
+	repo, resp, err := client.Repositories.Get(ctx, owner, name)
+	githubLimiter.Observe(resp)
+	if err == nil {
+		rememberDefaultBranch(owner, name, repo)
+	}
+	if !isNotFound(resp, err) {
+		return err
+	}
+
+	githubLimiter.Wait()
+	user, resp, err := client.Users.Get(ctx, "")
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	var scopes []string
+	if header, ok := resp.Header["X-Oauth-Scopes"]; ok && len(header) > 0 {
+		scopes = []string{}
+		for _, scope := range strings.Split(header[0], ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	accessErr := &AccessError{Owner: owner, Login: user.GetLogin(), Scopes: scopes}
+
+	// repos owned by the token's user are always visible, with the right scope
+	if !strings.EqualFold(user.GetLogin(), owner) {
+		githubLimiter.Wait()
+		membership, resp, err := client.Organizations.GetOrgMembership(ctx, "", owner)
+		githubLimiter.Observe(resp)
+		if isNotFound(resp, err) || (err == nil && membership.GetState() != "active") {
+			accessErr.Reason = fmt.Sprintf("%s isn't a member of the %s org", accessErr.Login, owner)
+			return accessErr
+		} else if err != nil {
+			return err
+		}
+	}
+	if scopes != nil && !hasScope(scopes, "repo") {
+		accessErr.Reason = "the token doesn't have the repo scope, which private repos need"
+		return accessErr
+	}
+	return nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound checks whether a Github API call failed with a 404
+func isNotFound(resp *github.Response, err error) bool {
+	return err != nil && resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+// readOnly checks whether the token can read the repo but not push to it, and if so why. Tokens whose permissions
+// Github doesn't report, e.g. some Github Apps, are assumed to be able to push.
+func readOnly(ctx context.Context, client *github.Client, owner string, name string, githubLimiter ratelimit.Limiter) (string, bool, error) {
+	githubLimiter.Wait()
+	repo, resp, err := client.Repositories.Get(ctx, owner, name)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return "", false, err
+	}
+	rememberDefaultBranch(owner, name, repo)
+	if repo.Permissions == nil || repo.GetPermissions()["push"] {
+		return "", false, nil
+	}
+	return fmt.Sprintf("the Github token can read %s/%s, but not push to it", owner, name), true, nil
+}
+
+// pushDenied checks whether `git push` failed because the credentials can't write to the repo, and if so returns
+// git's message, e.g. "remote: Permission to Clever/svc.git denied to alice."
+func pushDenied(gitOutput string) (string, bool) {
+	for _, line := range strings.Split(gitOutput, "\n") {
+		lower := strings.ToLower(line)
+		if (strings.Contains(lower, "permission to") && strings.Contains(lower, "denied")) ||
+			strings.Contains(lower, "write access to repository not granted") {
+			return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "remote:")), true
+		}
+	}
+	return "", false
+}
+
+// writeForbidden checks whether a Github API write failed because the token can't write to the repo, and if so why.
+// Repos which don't accept PRs at all fail with a 403 too, see prDisabled.
+func writeForbidden(err error) (string, bool) {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil || e.Response.StatusCode != http.StatusForbidden {
+		return "", false
+	}
+	if _, disabled := prDisabled(err); disabled {
+		return "", false
+	}
+	lower := strings.ToLower(e.Message)
+	if strings.Contains(lower, "resource not accessible") || strings.Contains(lower, "must have push access") {
+		return e.Message, true
+	}
+	return "", false
+}
@@ -0,0 +1,113 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAccess(t *testing.T) {
+	member := false
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/svc":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		case "/user":
+			w.Header().Set("X-OAuth-Scopes", "repo, read:org")
+			fmt.Fprint(w, `{"login": "alice"}`)
+		case "/user/memberships/orgs/Clever":
+			if !member {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"message": "Not Found"}`)
+				return
+			}
+			fmt.Fprint(w, `{"state": "active"}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	err := checkAccess(context.Background(), client, "Clever", "svc", limiter)
+	accessErr, ok := err.(*AccessError)
+	if assert.True(t, ok, "expected an AccessError, got %v", err) {
+		assert.Equal(t, "alice", accessErr.Login)
+		assert.Equal(t, []string{"repo", "read:org"}, accessErr.Scopes)
+		assert.Contains(t, accessErr.Error(), "alice isn't a member of the Clever org")
+	}
+
+	member = true
+	assert.NoError(t, checkAccess(context.Background(), client, "Clever", "svc", limiter), "a member's missing repo just doesn't exist")
+}
+
+func TestReadOnly(t *testing.T) {
+	gets := 0
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/audited":
+			fmt.Fprint(w, `{"permissions": {"admin": false, "push": false, "pull": true}}`)
+		case "/repos/Clever/writable":
+			gets++
+			fmt.Fprint(w, `{"default_branch": "develop", "permissions": {"admin": false, "push": true, "pull": true}}`)
+		case "/repos/Clever/app":
+			fmt.Fprint(w, `{}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	reason, ok, err := readOnly(context.Background(), client, "Clever", "audited", limiter)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "the Github token can read Clever/audited, but not push to it", reason)
+
+	_, ok, err = readOnly(context.Background(), client, "Clever", "writable", limiter)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	branch, err := defaultBranch(context.Background(), client, "Clever", "writable", limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "develop", branch)
+	assert.Equal(t, 1, gets, "the default branch is remembered from the permission check")
+
+	_, ok, err = readOnly(context.Background(), client, "Clever", "app", limiter)
+	assert.NoError(t, err)
+	assert.False(t, ok, "a token without reported permissions is assumed to be able to push")
+}
+
+func TestPushDenied(t *testing.T) {
+	reason, ok := pushDenied("remote: Permission to Clever/svc.git denied to alice.\nfatal: unable to access 'https://github.com/Clever/svc.git/': The requested URL returned error: 403\n")
+	assert.True(t, ok)
+	assert.Equal(t, "Permission to Clever/svc.git denied to alice.", reason)
+
+	_, ok = pushDenied("remote: Write access to repository not granted.\nfatal: unable to access 'https://github.com/Clever/svc.git/': The requested URL returned error: 403\n")
+	assert.True(t, ok)
+
+	_, ok = pushDenied(" ! [rejected]        HEAD -> codemod (non-fast-forward)\n")
+	assert.False(t, ok)
+}
+
+func TestWriteForbidden(t *testing.T) {
+	forbidden := func(message string) error {
+		return &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusForbidden}, Message: message}
+	}
+	reason, ok := writeForbidden(forbidden("Resource not accessible by integration"))
+	assert.True(t, ok)
+	assert.Equal(t, "Resource not accessible by integration", reason)
+
+	_, ok = writeForbidden(forbidden("Repository was archived so is read-only."))
+	assert.False(t, ok, "archived repos are PRs disabled, not a read-only token")
+	_, ok = writeForbidden(forbidden("API rate limit exceeded"))
+	assert.False(t, ok)
+	_, ok = writeForbidden(fmt.Errorf("Resource not accessible by integration"))
+	assert.False(t, ok)
+}
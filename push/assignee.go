@@ -0,0 +1,97 @@
+package push
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// assign assigns the PR to the first group of candidates with an assignment that sticks, returning who stuck.
+// Only candidates who aren't assigned already (current) are added. Github silently ignores assignees who can't be
+// assigned, e.g. users who aren't collaborators on the repo, so assignments are verified by fetching the PR's issue again.
+func assign(ctx context.Context, client *github.Client, owner string, name string, number int, current []string, groups [][]string, retry RetryPolicy, githubLimiter ratelimit.Limiter) ([]string, error) {
+	for _, group := range groups {
+		missing := []string{}
+		for _, login := range uniqueLogins(group...) {
+			if !containsLogin(current, login) {
+				missing = append(missing, login)
+			}
+		}
+		if len(missing) > 0 {
+			err := retryAPI(ctx, retry, githubLimiter, opAddAssignees, func() (resp *github.Response, err error) {
+				_, resp, err = client.Issues.AddAssignees(ctx, owner, name, number, missing)
+				return resp, err
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			githubLimiter.Wait()
+			issue, resp, err := client.Issues.Get(ctx, owner, name, number)
+			githubLimiter.Observe(resp)
+			if err != nil {
+				return nil, err
+			}
+			current = logins(issue.Assignees)
+		}
+
+		applied := []string{}
+		for _, login := range uniqueLogins(group...) {
+			if containsLogin(current, login) {
+				applied = append(applied, login)
+			}
+		}
+		if len(applied) > 0 {
+			return applied, nil
+		}
+	}
+	return nil, nil
+}
+
+// logins are the users' logins
+func logins(users []*github.User) []string {
+	l := []string{}
+	for _, u := range users {
+		l = append(l, u.GetLogin())
+	}
+	return l
+}
+
+// hasAssignee checks whether login is one of the assignees, ignoring case like Github does
+func hasAssignee(assignees []*github.User, login string) bool {
+	for _, a := range assignees {
+		if strings.EqualFold(a.GetLogin(), login) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueLogins drops empty and repeated logins, keeping the order
+func uniqueLogins(logins ...string) []string {
+	unique := []string{}
+	for _, login := range logins {
+		if login != "" && !containsLogin(unique, login) {
+			unique = append(unique, login)
+		}
+	}
+	return unique
+}
+
+// containsAll checks that every one of wanted is in logins
+func containsAll(logins []string, wanted []string) bool {
+	return len(withoutLogins(wanted, logins)) == 0
+}
+
+// withoutLogins are the logins which aren't in exclude
+func withoutLogins(logins []string, exclude []string) []string {
+	kept := []string{}
+	for _, login := range logins {
+		if !containsLogin(exclude, login) {
+			kept = append(kept, login)
+		}
+	}
+	return kept
+}
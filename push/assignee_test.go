@@ -0,0 +1,31 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasAssignee(t *testing.T) {
+	login := func(s string) *github.User { return &github.User{Login: &s} }
+	assignees := []*github.User{login("Alice"), login("bob")}
+	assert.True(t, hasAssignee(assignees, "alice"))
+	assert.False(t, hasAssignee(assignees, "carol"), "Github ignores assignees without access")
+	assert.False(t, hasAssignee(nil, "alice"))
+}
+
+func TestUniqueLogins(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob"}, uniqueLogins("alice", "", "Alice", "bob"))
+	assert.Empty(t, uniqueLogins("", ""))
+}
+
+func TestAssignees(t *testing.T) {
+	input := Input{PRAssignees: []string{"alice", "bob"}, PRAssignee: "Alice"}
+	assert.Equal(t, []string{"alice", "bob"}, input.assignees(), "the deprecated PRAssignee is appended")
+	assert.Equal(t, []string{"carol"}, Input{PRAssignee: "carol"}.assignees())
+
+	assert.True(t, containsAll([]string{"Alice", "bob", "carol"}, []string{"alice", "bob"}))
+	assert.False(t, containsAll([]string{"alice"}, []string{"alice", "bob"}))
+	assert.Equal(t, []string{"bob"}, withoutLogins([]string{"alice", "bob"}, []string{"ALICE"}))
+}
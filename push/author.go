@@ -0,0 +1,81 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// identityArgs are git args which make the committer name and email override the ambient git config, if set
+func identityArgs(name string, email string) []string {
+	args := []string{}
+	if name != "" {
+		args = append(args, "-c", "user.name="+name)
+	}
+	if email != "" {
+		args = append(args, "-c", "user.email="+email)
+	}
+	return args
+}
+
+// overridesIdentity is whether the input overrides the commit's author or committer
+func (input Input) overridesIdentity() bool {
+	return input.AuthorName != "" || input.AuthorEmail != "" || input.CommitterName != "" || input.CommitterEmail != ""
+}
+
+// setAuthor amends the commit on HEAD to have the author and committer, keeping the commit's author name or email
+// where they're empty. The commit is left as is if it already has them, so a re-run doesn't push a new commit.
+// Only HEAD is amended, so it refuses when the plan made more than one commit since ref, rather than pushing
+// commits with a mix of authors.
+func setAuthor(ctx context.Context, dir string, ref string, input Input) error {
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", append(identityArgs(input.CommitterName, input.CommitterEmail), args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", errors.New(string(output))
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	mergeBase, err := git("merge-base", ref, "HEAD")
+	if err != nil {
+		return err
+	}
+	count, err := git("rev-list", "--count", mergeBase+"..HEAD")
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(count); err != nil {
+		return err
+	} else if n > 1 {
+		return fmt.Errorf("the plan made %d commits since %s, but only a single commit's author can be set. Squash them first, e.g. with --squash", n, ref)
+	}
+
+	current, err := git("log", "-1", "--pretty=format:%an%n%ae%n%cn%n%ce")
+	if err != nil {
+		return err
+	}
+	fields := strings.Split(current, "\n")
+	if len(fields) != 4 {
+		return fmt.Errorf("unexpected git log output: %s", current)
+	}
+	authorName, authorEmail := fields[0], fields[1]
+	if input.AuthorName != "" {
+		authorName = input.AuthorName
+	}
+	if input.AuthorEmail != "" {
+		authorEmail = input.AuthorEmail
+	}
+	if authorName == fields[0] && authorEmail == fields[1] &&
+		(input.CommitterName == "" || input.CommitterName == fields[2]) &&
+		(input.CommitterEmail == "" || input.CommitterEmail == fields[3]) {
+		return nil
+	}
+
+	_, err = git("commit", "--amend", "--allow-empty", "--no-edit", "--no-verify", "--author", fmt.Sprintf("%s <%s>", authorName, authorEmail))
+	return err
+}
@@ -0,0 +1,30 @@
+package push
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAuthor(t *testing.T) {
+	dir, git := newTestRepo(t)
+	defer os.RemoveAll(dir)
+	git("commit", "-q", "--allow-empty", "-m", "base")
+	git("branch", "base")
+	git("commit", "-q", "--allow-empty", "-m", "change")
+
+	input := Input{AuthorName: "Microplane Bot", CommitterName: "ci", CommitterEmail: "ci@example.com"}
+	assert.NoError(t, setAuthor(context.Background(), dir, "base", input))
+	assert.Equal(t, "Microplane Bot <mp@example.com>, ci <ci@example.com>", git("log", "-1", "--pretty=format:%an <%ae>, %cn <%ce>"), "the author's email is kept")
+
+	sha := git("rev-parse", "HEAD")
+	assert.NoError(t, setAuthor(context.Background(), dir, "base", input))
+	assert.Equal(t, sha, git("rev-parse", "HEAD"), "a commit which already has the author isn't amended again")
+
+	git("commit", "-q", "--allow-empty", "-m", "another change")
+	sha = git("rev-parse", "HEAD")
+	assert.Error(t, setAuthor(context.Background(), dir, "base", Input{AuthorName: "Someone Else"}), "only a single commit's author can be set")
+	assert.Equal(t, sha, git("rev-parse", "HEAD"))
+}
@@ -0,0 +1,80 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// Merge methods for Input.MergeMethod
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+const enableAutoMergeMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod}) {
+    clientMutationId
+  }
+}`
+
+// errAlreadyMergeable is returned by enableAutoMerge when Github won't enable auto-merge because the PR can be merged now
+var errAlreadyMergeable = errors.New("the PR can already be merged, so Github won't enable auto-merge for it")
+
+// validateMergeMethod checks method is one of Github's merge methods
+func validateMergeMethod(method string) error {
+	switch method {
+	case MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+		return nil
+	}
+	return fmt.Errorf("unknown merge method %q, expected %s, %s, or %s", method, MergeMethodMerge, MergeMethodSquash, MergeMethodRebase)
+}
+
+// prNodeID is the PR's GraphQL ID, which the vendored go-github doesn't decode, so the PR is read again for it
+func prNodeID(ctx context.Context, client *github.Client, owner string, name string, number int, githubLimiter ratelimit.Limiter) (string, error) {
+	var pr struct {
+		NodeID string `json:"node_id"`
+	}
+	githubLimiter.Wait()
+	resp, err := githubclient.Do(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/pulls/%d", owner, name, number), "", nil, &pr)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return "", err
+	}
+	if pr.NodeID == "" {
+		return "", fmt.Errorf("no node ID for %s/%s#%d", owner, name, number)
+	}
+	return pr.NodeID, nil
+}
+
+// enableAutoMerge turns on Github's auto-merge for the PR, so it merges itself with method once required checks pass.
+// There's no REST API for it, only a GraphQL mutation.
+func enableAutoMerge(ctx context.Context, client *github.Client, owner string, name string, pr *github.PullRequest, method string, githubLimiter ratelimit.Limiter) error {
+	nodeID, err := prNodeID(ctx, client, owner, name, pr.GetNumber(), githubLimiter)
+	if err != nil {
+		return fmt.Errorf("could not enable auto-merge for %s/%s#%d: %s", owner, name, pr.GetNumber(), err)
+	}
+	err = graphQL(ctx, client, enableAutoMergeMutation, map[string]interface{}{
+		"pullRequestId": nodeID,
+		"mergeMethod":   strings.ToUpper(method),
+	}, nil, githubLimiter)
+	if gqlErr, ok := err.(*graphQLError); ok {
+		lower := strings.ToLower(gqlErr.Message)
+		switch {
+		case strings.Contains(lower, "auto merge is not allowed") || strings.Contains(lower, "auto-merge is not allowed"):
+			return fmt.Errorf("%s/%s doesn't allow auto-merge, turn on \"Allow auto-merge\" in the repo's settings", owner, name)
+		case strings.Contains(lower, "clean status"):
+			return errAlreadyMergeable
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not enable auto-merge for %s/%s#%d: %s", owner, name, pr.GetNumber(), err)
+	}
+	return nil
+}
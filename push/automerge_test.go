@@ -0,0 +1,52 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableAutoMerge(t *testing.T) {
+	graphqlErrors := ""
+	var request struct {
+		Query     string
+		Variables map[string]interface{}
+	}
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/repos/Clever/svc/pulls/7":
+			fmt.Fprint(w, `{"number": 7, "node_id": "PR_kwDO"}`)
+		case r.Method == "POST" && r.URL.Path == "/api/graphql":
+			json.NewDecoder(r.Body).Decode(&request)
+			fmt.Fprintf(w, `{"data": {}, "errors": [%s]}`, graphqlErrors)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	client.BaseURL, _ = url.Parse(server.URL + "/api/v3/")
+	limiter := ratelimit.NewTicker(time.Millisecond)
+	pr := &github.PullRequest{Number: github.Int(7)}
+
+	assert.NoError(t, enableAutoMerge(context.Background(), client, "Clever", "svc", pr, MergeMethodSquash, limiter))
+	assert.Contains(t, request.Query, "enablePullRequestAutoMerge")
+	assert.Equal(t, map[string]interface{}{"pullRequestId": "PR_kwDO", "mergeMethod": "SQUASH"}, request.Variables)
+
+	graphqlErrors = `{"message": "Auto merge is not allowed for this repository"}`
+	err := enableAutoMerge(context.Background(), client, "Clever", "svc", pr, MergeMethodSquash, limiter)
+	assert.EqualError(t, err, `Clever/svc doesn't allow auto-merge, turn on "Allow auto-merge" in the repo's settings`)
+
+	graphqlErrors = `{"message": "Pull request Pull request is in clean status"}`
+	assert.Equal(t, errAlreadyMergeable, enableAutoMerge(context.Background(), client, "Clever", "svc", pr, MergeMethodSquash, limiter))
+
+	assert.Error(t, validateMergeMethod("fast-forward"))
+	assert.NoError(t, validateMergeMethod(MergeMethodRebase))
+}
@@ -0,0 +1,39 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+)
+
+// PRBodyData is available to Input.PRBodyTemplatePath's template, e.g. {{.RepoName}}
+type PRBodyData struct {
+	RepoName   string
+	RepoOwner  string
+	BranchName string
+	// CommitSHA is the pushed commit, e.g. for a link to https://github.com/{{.RepoOwner}}/{{.RepoName}}/commit/{{.CommitSHA}}
+	CommitSHA string
+}
+
+// LoadPRBodyTemplate reads and parses a PR body template file, naming the file in any error
+func LoadPRBodyTemplate(path string) (*template.Template, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read PR body template %s: %s", path, err)
+	}
+	tmpl, err := template.New(path).Parse(string(bs))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse PR body template %s: %s", path, err)
+	}
+	return tmpl, nil
+}
+
+// renderPRBody renders the PR body template for a repo
+func renderPRBody(tmpl *template.Template, data PRBodyData) (string, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render PR body template %s: %s", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,30 @@
+package push
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRBodyTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bodytemplate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "body.md")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("Updates {{.RepoOwner}}/{{.RepoName}} on {{.BranchName}}, see https://github.com/{{.RepoOwner}}/{{.RepoName}}/commit/{{.CommitSHA}}"), 0644))
+	tmpl, err := LoadPRBodyTemplate(path)
+	assert.NoError(t, err)
+	body, err := renderPRBody(tmpl, PRBodyData{RepoName: "svc", RepoOwner: "Clever", BranchName: "codemod", CommitSHA: "abc123"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Updates Clever/svc on codemod, see https://github.com/Clever/svc/commit/abc123", body)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("Updates {{.RepoName"), 0644))
+	_, err = LoadPRBodyTemplate(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "could not parse PR body template "+path)
+	}
+}
@@ -0,0 +1,113 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// invalidBranchChars can't appear anywhere in a git ref, see `git help check-ref-format`
+const invalidBranchChars = " ~^:?*[\\"
+
+// validateBranch checks a branch name against git's ref format rules
+func validateBranch(name string) error {
+	if name == "" {
+		return fmt.Errorf("branch name is empty")
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			return fmt.Errorf("invalid branch name %q: contains control character %q", name, c)
+		}
+		if strings.ContainsRune(invalidBranchChars, c) {
+			return fmt.Errorf("invalid branch name %q: contains %q", name, c)
+		}
+	}
+	for _, sequence := range []string{"..", "@{", "//"} {
+		if strings.Contains(name, sequence) {
+			return fmt.Errorf("invalid branch name %q: contains %q", name, sequence)
+		}
+	}
+	if name == "@" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") {
+		return fmt.Errorf("invalid branch name %q: can't be \"@\", start with \"-\", or end with \"/\" or \".\"", name)
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("invalid branch name %q: path components can't start with \".\" or end with \".lock\"", name)
+		}
+	}
+	return nil
+}
+
+// sanitizeBranch replaces anything git doesn't allow in a branch name with "-"
+func sanitizeBranch(name string) string {
+	name = strings.Map(func(c rune) rune {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(invalidBranchChars, c) {
+			return '-'
+		}
+		return c
+	}, name)
+	for _, sequence := range []string{"..", "@{", "//"} {
+		for strings.Contains(name, sequence) {
+			name = strings.Replace(name, sequence, "-", -1)
+		}
+	}
+
+	components := []string{}
+	for _, component := range strings.Split(name, "/") {
+		component = strings.TrimLeft(component, ".")
+		for strings.HasSuffix(component, ".lock") {
+			component = strings.TrimSuffix(component, ".lock")
+		}
+		if component != "" {
+			components = append(components, component)
+		}
+	}
+	name = strings.TrimLeft(strings.Join(components, "/"), "-")
+	name = strings.TrimRight(name, ".")
+	if name == "" || name == "@" {
+		return "microplane"
+	}
+	return name
+}
+
+// validateHeadAndBase catches a head branch which is also the base, or is the repo's default branch so that head and
+// base look swapped. Github rejects the first with a confusing 422, and pushing the second would overwrite the default branch.
+// A fork's branch can share its name with the base, since it's in a different repo.
+func validateHeadAndBase(head string, base string, defaultBase string, fork bool) error {
+	if fork {
+		return nil
+	}
+	if head == base {
+		return fmt.Errorf("the PR's head branch %s is also its base, so head and base must be misconfigured", head)
+	}
+	if head == defaultBase {
+		return fmt.Errorf("the PR's head branch %s is the repo's default branch, so head and base look swapped: pushing would overwrite %s", head, head)
+	}
+	return nil
+}
+
+// verifyBaseExists checks the base branch exists on Github, so a typo'd base fails clearly rather than with a 422
+func verifyBaseExists(ctx context.Context, client *github.Client, owner string, name string, base string, githubLimiter ratelimit.Limiter) error {
+	exists, err := branchExists(ctx, client, owner, name, base, githubLimiter)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("base branch %s doesn't exist in %s/%s", base, owner, name)
+	}
+	return nil
+}
+
+// branchExists checks whether the repo has the branch
+func branchExists(ctx context.Context, client *github.Client, owner string, name string, branch string, githubLimiter ratelimit.Limiter) (bool, error) {
+	githubLimiter.Wait()
+	_, resp, err := client.Git.GetRef(ctx, owner, name, "heads/"+branch)
+	githubLimiter.Observe(resp)
+	if refNotFound(resp, err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,91 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBranch(t *testing.T) {
+	assert.NoError(t, validateBranch("microplane/go-1.10"))
+
+	for _, invalid := range []string{"", "has space", "a..b", "a~b", "topic:b", "a/.hidden", "a.lock", "a/", "a.", "-a", "@", "a@{b"} {
+		assert.Error(t, validateBranch(invalid), invalid)
+	}
+}
+
+func TestSanitizeBranch(t *testing.T) {
+	for _, name := range []string{"has space", "a..b", "a~b^c:d", "a/.hidden", "a.lock", "a/", "a.", "-a", "@", "a@{b", "a//b"} {
+		sanitized := sanitizeBranch(name)
+		assert.NoError(t, validateBranch(sanitized), "%s sanitized to %s", name, sanitized)
+	}
+	assert.Equal(t, "eng-reorg-team-name", sanitizeBranch("eng reorg:team name"))
+}
+
+func TestValidateHeadAndBase(t *testing.T) {
+	assert.NoError(t, validateHeadAndBase("microplane/go-1.10", "master", "master", false))
+	assert.NoError(t, validateHeadAndBase("microplane/go-1.10", "release", "master", false))
+
+	err := validateHeadAndBase("master", "master", "master", false)
+	if assert.Error(t, err, "head == base") {
+		assert.Contains(t, err.Error(), "is also its base")
+	}
+	err = validateHeadAndBase("master", "microplane/go-1.10", "master", false)
+	if assert.Error(t, err, "swapped head and base") {
+		assert.Contains(t, err.Error(), "look swapped")
+	}
+	assert.NoError(t, validateHeadAndBase("master", "master", "master", true), "a fork's master is a different branch")
+}
+
+func TestForcePushProtected(t *testing.T) {
+	assert.True(t, forcePushProtected(`remote: error: GH006: Protected branch update failed for refs/heads/mp/bump-deps.
+remote: error: Cannot force-push to this branch
+To github.com:Clever/svc.git
+ ! [remote rejected] mp/bump-deps -> mp/bump-deps (protected branch hook declined)`))
+	assert.True(t, forcePushProtected(`remote: error: GH013: Repository rule violations found for refs/heads/mp/bump-deps.
+remote: - Cannot force-push to this branch`))
+	assert.False(t, forcePushProtected(`remote: error: GH006: Protected branch update failed for refs/heads/mp/bump-deps.
+remote: error: Required status check "ci" is expected.`))
+	assert.False(t, forcePushProtected(" ! [rejected]        mp/bump-deps -> mp/bump-deps (non-fast-forward)"))
+}
+
+func TestFallbackBranch(t *testing.T) {
+	assert.Equal(t, "mp/bump-deps-fallback", fallbackBranch("mp/bump-deps"))
+}
+
+func TestBranchExists(t *testing.T) {
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/svc/git/refs/heads/mp/bump-deps-fallback":
+			fmt.Fprint(w, `{"ref": "refs/heads/mp/bump-deps-fallback", "object": {"sha": "abc"}}`)
+		case "/repos/Clever/svc/git/refs/heads/mp/bump":
+			// there's no exact match, so Github lists the refs with the prefix
+			fmt.Fprint(w, `[{"ref": "refs/heads/mp/bump-deps-fallback", "object": {"sha": "abc"}}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	exists, err := branchExists(context.Background(), client, "Clever", "svc", "mp/bump-deps-fallback", limiter)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = branchExists(context.Background(), client, "Clever", "svc", "mp/other-fallback", limiter)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = branchExists(context.Background(), client, "Clever", "svc", "mp/bump", limiter)
+	assert.NoError(t, err)
+	assert.False(t, exists, "a prefix of another branch isn't a branch")
+
+	assert.EqualError(t, verifyBaseExists(context.Background(), client, "Clever", "svc", "mp/bump", limiter), "base branch mp/bump doesn't exist in Clever/svc")
+	assert.NoError(t, verifyBaseExists(context.Background(), client, "Clever", "svc", "mp/bump-deps-fallback", limiter))
+}
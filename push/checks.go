@@ -0,0 +1,75 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// checkRun is a run from the Checks API
+type checkRun struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	HTMLURL    string `json:"html_url"`
+	DetailsURL string `json:"details_url"`
+}
+
+// listCheckRuns lists the check runs for ref, e.g. from Github Actions
+func listCheckRuns(ctx context.Context, client *github.Client, owner string, name string, ref string, githubLimiter ratelimit.Limiter) ([]checkRun, error) {
+	runs := []checkRun{}
+	page := 1
+	for {
+		u := fmt.Sprintf("repos/%s/%s/commits/%s/check-runs?per_page=100&page=%d", owner, name, ref, page)
+		var result struct {
+			CheckRuns []checkRun `json:"check_runs"`
+		}
+		// the Checks API is a preview feature
+		githubLimiter.Wait()
+		resp, err := githubclient.Do(ctx, client, "GET", u, "application/vnd.github.antiope-preview+json", nil, &result)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, result.CheckRuns...)
+		if resp.NextPage == 0 {
+			return runs, nil
+		}
+		page = resp.NextPage
+	}
+}
+
+// state maps the check run to a commit status state: pending, success, or failure
+func (r checkRun) state() string {
+	if r.Status != "completed" {
+		return "pending"
+	}
+	switch r.Conclusion {
+	case "success", "neutral", "skipped":
+		return "success"
+	}
+	return "failure"
+}
+
+// url is the check run's link, preferring the CI provider's own page
+func (r checkRun) url() string {
+	if r.DetailsURL != "" {
+		return r.DetailsURL
+	}
+	return r.HTMLURL
+}
+
+// withCheckRuns adds the check runs' states to the statuses' states. A status wins over a check run of the same name.
+func withCheckRuns(states map[string]string, runs []checkRun) map[string]string {
+	merged := map[string]string{}
+	for _, r := range runs {
+		merged[r.Name] = r.state()
+	}
+	for context, state := range states {
+		merged[context] = state
+	}
+	return merged
+}
@@ -0,0 +1,65 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// committerCandidates bounds how many recent commits lastCommitter looks up on Github
+const committerCandidates = 5
+
+// committerPaths bounds how many of the changed files lastCommitter passes to `git log`, for very large changes
+const committerPaths = 100
+
+// lastCommitter finds the Github login of whoever most recently changed files on ref.
+// The PR's author (skip) and bots are passed over, as are commit authors without a Github account.
+func lastCommitter(ctx context.Context, client *github.Client, owner string, name string, dir string, ref string, files []string, skip string, githubLimiter ratelimit.Limiter) (string, error) {
+	if len(files) > committerPaths {
+		files = files[:committerPaths]
+	}
+	args := append([]string{"log", "--format=%H", "-n", "20", ref, "--"}, files...)
+	gitLog := exec.CommandContext(ctx, "git", args...)
+	gitLog.Dir = dir
+	output, err := gitLog.CombinedOutput()
+	if err != nil {
+		return "", errors.New(string(output))
+	}
+
+	looked := 0
+	for _, sha := range strings.Fields(string(output)) {
+		if looked == committerCandidates {
+			break
+		}
+		looked++
+		githubLimiter.Wait()
+		commit, resp, err := client.Repositories.GetCommit(ctx, owner, name, sha)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return "", err
+		}
+		if login := commit.GetAuthor().GetLogin(); isCommitter(login, skip) {
+			return login, nil
+		}
+	}
+	return "", errors.New("no recent committer of the changed files has a Github account")
+}
+
+// isCommitter checks that login is someone who could be assigned, rather than the PR's author or a bot
+func isCommitter(login string, skip string) bool {
+	return login != "" && !strings.EqualFold(login, skip) && !strings.HasSuffix(login, "[bot]")
+}
+
+// committerOf finds the last committer of the files the push changes, see lastCommitter
+func committerOf(ctx context.Context, client *github.Client, input Input, base string, source string, author string, githubLimiter ratelimit.Limiter) (string, error) {
+	baseRef := input.remote() + "/" + base
+	files, err := localChangedFiles(ctx, input.PlanDir, baseRef, source)
+	if err != nil {
+		return "", err
+	}
+	return lastCommitter(ctx, client, input.RepoOwner, input.RepoName, input.PlanDir, baseRef, files, author, githubLimiter)
+}
@@ -0,0 +1,14 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCommitter(t *testing.T) {
+	assert.True(t, isCommitter("alice", "microplane-bot"))
+	assert.False(t, isCommitter("Microplane-Bot", "microplane-bot"), "the PR's author is skipped")
+	assert.False(t, isCommitter("dependabot[bot]", "microplane-bot"))
+	assert.False(t, isCommitter("", "microplane-bot"), "commit authors without a Github account are skipped")
+}
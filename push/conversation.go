@@ -0,0 +1,37 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// lockConversation locks the PR's conversation with reason, unless it's already locked
+func lockConversation(ctx context.Context, client *github.Client, owner string, name string, number int, reason string, githubLimiter ratelimit.Limiter) error {
+	githubLimiter.Wait()
+	issue, resp, err := client.Issues.Get(ctx, owner, name, number)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	if issue.GetLocked() {
+		return nil
+	}
+
+	body := map[string]string{}
+	if reason != "" {
+		body["lock_reason"] = reason
+	}
+	u := fmt.Sprintf("repos/%s/%s/issues/%d/lock", owner, name, number)
+	// lock reasons are a preview feature
+	githubLimiter.Wait()
+	resp, err = githubclient.Do(ctx, client, "PUT", u, "application/vnd.github.sailor-v-preview+json", body, nil)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return fmt.Errorf("could not lock conversation: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package push
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// prDisabledErrors are fragments of Github's messages when a repo doesn't accept PRs at all,
+// as opposed to the token lacking permission to open them
+var prDisabledErrors = []string{
+	"pull requests are disabled",
+	"pull request creation is disabled",
+	"repository was archived",
+	"has limited interactions",
+	"interaction limit",
+}
+
+// prDisabled checks whether creating a PR failed because the repo doesn't accept PRs, and if so why
+func prDisabled(err error) (string, bool) {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil {
+		return "", false
+	}
+	if e.Response.StatusCode != http.StatusForbidden && e.Response.StatusCode != http.StatusUnprocessableEntity {
+		return "", false
+	}
+	messages := []string{e.Message}
+	for _, detail := range e.Errors {
+		messages = append(messages, detail.Message)
+	}
+	for _, message := range messages {
+		lower := strings.ToLower(message)
+		for _, fragment := range prDisabledErrors {
+			if strings.Contains(lower, fragment) {
+				return message, true
+			}
+		}
+	}
+	return "", false
+}
+
+// prInvalid checks whether creating or editing a PR failed Github's validation (a 422), e.g. a bot enforcing required
+// fields in the body, and if so returns the details. PRs which already exist, or can't be opened at all, aren't invalid.
+func prInvalid(err error) (string, bool) {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil || e.Response.StatusCode != http.StatusUnprocessableEntity {
+		return "", false
+	}
+	if _, disabled := prDisabled(err); disabled {
+		return "", false
+	}
+	details := []string{e.Message}
+	for _, detail := range e.Errors {
+		if strings.Contains(strings.ToLower(detail.Message), "pull request already exists") {
+			return "", false
+		}
+		if detail.Message != "" {
+			details = append(details, detail.Message)
+		} else {
+			details = append(details, fmt.Sprintf("%s %s %s", detail.Resource, detail.Field, detail.Code))
+		}
+	}
+	return strings.Join(details, "; "), true
+}
+
+// minimalBody is the PR body cut down to its title and microplane's hidden markers, for repos which reject the full body
+func minimalBody(title string, body string) string {
+	minimal := title
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "<!-- microplane-") {
+			minimal = withMarker(minimal, line)
+		}
+	}
+	return minimal
+}
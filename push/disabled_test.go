@@ -0,0 +1,67 @@
+package push
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRDisabled(t *testing.T) {
+	disabled := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusForbidden},
+		Message:  "Repository was archived so is read-only.",
+	}
+	reason, ok := prDisabled(disabled)
+	assert.True(t, ok)
+	assert.Equal(t, "Repository was archived so is read-only.", reason)
+
+	validation := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity},
+		Message:  "Validation Failed",
+		Errors:   []github.Error{{Message: "Pull requests are disabled for this repository"}},
+	}
+	_, ok = prDisabled(validation)
+	assert.True(t, ok)
+
+	// missing permissions are still failures
+	forbidden := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusForbidden},
+		Message:  "Resource not accessible by integration",
+	}
+	_, ok = prDisabled(forbidden)
+	assert.False(t, ok)
+
+	_, ok = prDisabled(errors.New("pull requests are disabled"))
+	assert.False(t, ok)
+}
+
+func TestPRInvalid(t *testing.T) {
+	invalid := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity},
+		Message:  "Validation Failed",
+		Errors:   []github.Error{{Message: "body must include a ticket link"}, {Resource: "PullRequest", Field: "body", Code: "invalid"}},
+	}
+	details, ok := prInvalid(invalid)
+	assert.True(t, ok)
+	assert.Equal(t, "Validation Failed; body must include a ticket link; PullRequest body invalid", details)
+
+	disabled := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity},
+		Message:  "Validation Failed",
+		Errors:   []github.Error{{Message: "Pull requests are disabled for this repository"}},
+	}
+	_, ok = prInvalid(disabled)
+	assert.False(t, ok, "disabled PRs are handled separately")
+
+	_, ok = prInvalid(errors.New("connection reset"))
+	assert.False(t, ok)
+}
+
+func TestMinimalBody(t *testing.T) {
+	body := "Bumps deps.\n\nSee the campaign doc.\n\n<!-- microplane-run-id: abc -->"
+	assert.Equal(t, "Bump deps\n\n<!-- microplane-run-id: abc -->", minimalBody("Bump deps", body))
+	assert.Equal(t, "Bump deps", minimalBody("Bump deps", "Bumps deps."))
+}
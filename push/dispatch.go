@@ -0,0 +1,44 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// WorkflowDispatch triggers a Github Actions workflow once the PR exists
+type WorkflowDispatch struct {
+	// Workflow is the workflow's file name, e.g. "validate.yml"
+	Workflow string
+	// Inputs are passed to the workflow as-is
+	Inputs map[string]string
+	// PRNumberInput, if set, is the name of an extra input that receives the PR number
+	PRNumberInput string
+}
+
+// dispatchWorkflow sends a workflow_dispatch event for the workflow on ref
+func dispatchWorkflow(ctx context.Context, client *github.Client, owner string, name string, ref string, prNumber int, dispatch WorkflowDispatch, githubLimiter ratelimit.Limiter) error {
+	inputs := map[string]string{}
+	for k, v := range dispatch.Inputs {
+		inputs[k] = v
+	}
+	if dispatch.PRNumberInput != "" {
+		inputs[dispatch.PRNumberInput] = strconv.Itoa(prNumber)
+	}
+
+	u := fmt.Sprintf("repos/%s/%s/actions/workflows/%s/dispatches", owner, name, dispatch.Workflow)
+	githubLimiter.Wait()
+	resp, err := githubclient.Do(ctx, client, "POST", u, "", map[string]interface{}{
+		"ref":    ref,
+		"inputs": inputs,
+	}, nil)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return fmt.Errorf("could not dispatch workflow %s: %s", dispatch.Workflow, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// draftPreview is the media type for draft PRs
+const draftPreview = "application/vnd.github.shadow-cat-preview+json"
+
+// draftPullRequest is a PR along with its draft state
+type draftPullRequest struct {
+	github.PullRequest
+	Draft bool `json:"draft"`
+}
+
+// createPR opens the PR, as a draft if draft is set
+func createPR(ctx context.Context, client *github.Client, owner string, name string, pull *github.NewPullRequest, draft bool) (*github.PullRequest, *github.Response, error) {
+	if !draft {
+		return client.PullRequests.Create(ctx, owner, name, pull)
+	}
+	body := struct {
+		*github.NewPullRequest
+		Draft bool `json:"draft"`
+	}{pull, true}
+	created := &draftPullRequest{}
+	resp, err := githubclient.Do(ctx, client, "POST", fmt.Sprintf("repos/%s/%s/pulls", owner, name), draftPreview, body, created)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &created.PullRequest, resp, nil
+}
+
+// isDraft checks whether the PR is still a draft
+func isDraft(ctx context.Context, client *github.Client, owner string, name string, number int, githubLimiter ratelimit.Limiter) (bool, error) {
+	pr := &draftPullRequest{}
+	githubLimiter.Wait()
+	resp, err := githubclient.Do(ctx, client, "GET", fmt.Sprintf("repos/%s/%s/pulls/%d", owner, name, number), draftPreview, nil, pr)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return false, err
+	}
+	return pr.Draft, nil
+}
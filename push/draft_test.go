@@ -0,0 +1,27 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDraftPR(t *testing.T) {
+	var sent map[string]interface{}
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.github.shadow-cat-preview+json", r.Header.Get("Accept"))
+		json.NewDecoder(r.Body).Decode(&sent)
+		fmt.Fprint(w, `{"number": 7, "draft": true}`)
+	})
+	defer server.Close()
+
+	pr, _, err := createPR(context.Background(), client, "Clever", "svc", &github.NewPullRequest{Title: github.String("Update")}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, pr.GetNumber())
+	assert.Equal(t, map[string]interface{}{"title": "Update", "draft": true}, sent)
+}
@@ -0,0 +1,156 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// FileCheck looks for files a codemod probably shouldn't have committed, e.g. build artifacts
+type FileCheck struct {
+	// MaxSize flags added or modified files larger than this many bytes. Zero disables the check.
+	MaxSize int64
+	// Binary flags added or modified binary files
+	Binary bool
+	// Strict fails the push when files are flagged, rather than warning
+	Strict bool
+}
+
+func (c FileCheck) enabled() bool {
+	return c.MaxSize > 0 || c.Binary
+}
+
+// flaggedFiles lists the files changed between ref and source which fail the check, with the reason
+func flaggedFiles(ctx context.Context, dir string, ref string, source string, check FileCheck) ([]string, error) {
+	// deleted files are fine, --no-renames keeps paths simple, and -z leaves them unquoted
+	gitDiff := exec.CommandContext(ctx, "git", "diff", "--numstat", "-z", "--no-renames", "--diff-filter=d", fmt.Sprintf("%s...%s", ref, source))
+	gitDiff.Dir = dir
+	output, err := gitDiff.CombinedOutput()
+	if err != nil {
+		return nil, errors.New(string(output))
+	}
+
+	flagged := []string{}
+	sized := []string{}
+	for _, record := range strings.Split(string(output), "\x00") {
+		// <added>\t<deleted>\t<path>, where binary files have "-" for both counts
+		fields := strings.SplitN(record, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := fields[2]
+		if check.Binary && fields[0] == "-" && fields[1] == "-" {
+			flagged = append(flagged, fmt.Sprintf("%s (binary)", path))
+			continue
+		}
+		if check.MaxSize > 0 {
+			sized = append(sized, path)
+		}
+	}
+	if len(sized) == 0 {
+		return flagged, nil
+	}
+
+	sizes, err := blobSizes(ctx, dir, source, sized)
+	if err != nil {
+		return nil, err
+	}
+	for i, path := range sized {
+		if sizes[i] > check.MaxSize {
+			flagged = append(flagged, fmt.Sprintf("%s (%d bytes)", path, sizes[i]))
+		}
+	}
+	sort.Strings(flagged)
+	return flagged, nil
+}
+
+// blobSizes is the size in bytes of each of paths at rev, looked up with a single git process
+func blobSizes(ctx context.Context, dir string, rev string, paths []string) ([]int64, error) {
+	objects := []string{}
+	for _, path := range paths {
+		// batch-check reads one object per line, so a path with a newline can't be looked up
+		if strings.Contains(path, "\n") {
+			return nil, fmt.Errorf("could not check the size of %q, its name has a newline", path)
+		}
+		objects = append(objects, fmt.Sprintf("%s:%s", rev, path))
+	}
+	gitCatFile := exec.CommandContext(ctx, "git", "cat-file", "--batch-check=%(objectsize)")
+	gitCatFile.Dir = dir
+	gitCatFile.Stdin = strings.NewReader(strings.Join(objects, "\n") + "\n")
+	output, err := gitCatFile.CombinedOutput()
+	if err != nil {
+		return nil, errors.New(string(output))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if len(lines) != len(objects) {
+		return nil, fmt.Errorf("expected %d sizes from git cat-file, got: %s", len(objects), output)
+	}
+	sizes := []int64{}
+	for i, line := range lines {
+		// a submodule's path is a commit in another repo, so it's missing here, and has no size of its own
+		if strings.HasSuffix(line, " missing") {
+			sizes = append(sizes, 0)
+			continue
+		}
+		size, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not check the size of %s: %s", objects[i], line)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// Sources for Output.ChangedFiles, see Input.ChangedFiles
+const (
+	// ChangedFilesLocal lists the files from the local diff, without any API calls
+	ChangedFilesLocal = "local"
+	// ChangedFilesAPI lists the files Github shows on the PR
+	ChangedFilesAPI = "api"
+)
+
+// localChangedFiles lists the files changed between ref and source
+func localChangedFiles(ctx context.Context, dir string, ref string, source string) ([]string, error) {
+	gitDiff := exec.CommandContext(ctx, "git", "diff", "--name-only", "-z", fmt.Sprintf("%s...%s", ref, source))
+	gitDiff.Dir = dir
+	output, err := gitDiff.CombinedOutput()
+	if err != nil {
+		return nil, errors.New(string(output))
+	}
+	files := []string{}
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// prChangedFiles lists the files changed by the PR, according to Github
+func prChangedFiles(ctx context.Context, client *github.Client, owner string, name string, number int, githubLimiter ratelimit.Limiter) ([]string, error) {
+	files := []string{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		githubLimiter.Wait()
+		page, resp, err := client.PullRequests.ListFiles(ctx, owner, name, number, opt)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range page {
+			files = append(files, f.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,47 @@
+package push
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlaggedFiles(t *testing.T) {
+	dir, git := newTestRepo(t)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("hi\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "old.bin"), []byte{0, 1, 2}, 0644))
+	git("add", ".")
+	// an unpopulated submodule is an empty directory
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "vendor", "lib"), 0755))
+	git("update-index", "--add", "--cacheinfo", "160000,1111111111111111111111111111111111111111,vendor/lib")
+	git("commit", "-q", "-m", "base")
+	git("tag", "base")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("hello\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.bin"), []byte{0, 1, 2, 3}, 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Repeat("x\n", 100)), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "größer.txt"), []byte(strings.Repeat("x\n", 60)), 0644))
+	git("rm", "-q", "old.bin")
+	git("add", ".")
+	// bump the submodule, whose commits aren't in this repo
+	git("update-index", "--cacheinfo", "160000,2222222222222222222222222222222222222222,vendor/lib")
+	git("commit", "-q", "-m", "change")
+
+	flagged, err := flaggedFiles(context.Background(), dir, "base", "HEAD", FileCheck{MaxSize: 100, Binary: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app.bin (binary)", "big.txt (200 bytes)", "größer.txt (120 bytes)"}, flagged, "deleted binaries aren't flagged")
+
+	flagged, err = flaggedFiles(context.Background(), dir, "base", "HEAD", FileCheck{MaxSize: 1000})
+	assert.NoError(t, err)
+	assert.Empty(t, flagged)
+
+	changed, err := localChangedFiles(context.Background(), dir, "base", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"README.md", "app.bin", "big.txt", "größer.txt", "old.bin", "vendor/lib"}, changed)
+}
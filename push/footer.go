@@ -0,0 +1,56 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultBodyFooterTemplate is a footer with the run's provenance, for Input.BodyFooterTemplate
+const DefaultBodyFooterTemplate = `---
+Opened by [microplane]({{.DocsURL}}) {{.Version}}{{if .RunID}}, run {{.RunID}}{{end}}, at {{.Timestamp.Format "2006-01-02 15:04 MST"}}`
+
+// DocsURL is microplane's documentation, for footers
+const DocsURL = "https://github.com/Clever/microplane"
+
+// footerMarker starts the footer, so it can be told apart from the rest of the body
+const footerMarker = "<!-- microplane-footer -->"
+
+// FooterData is available to Input.BodyFooterTemplate, e.g. {{.RunID}}
+type FooterData struct {
+	Org       string
+	Repo      string
+	RunID     string
+	Version   string
+	Timestamp time.Time
+	DocsURL   string
+}
+
+// withFooter renders the footer template and appends it to the body, after the footer marker.
+// A hidden footer is wrapped in an HTML comment, so it's only visible in the body's source.
+func withFooter(body string, footerTemplate string, hidden bool, data FooterData) (string, error) {
+	tmpl, err := template.New("body footer").Parse(footerTemplate)
+	if err != nil {
+		return "", fmt.Errorf("could not parse body footer %q: %s", footerTemplate, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render body footer %q: %s", footerTemplate, err)
+	}
+	footer := b.String()
+	if hidden {
+		footer = "<!--\n" + footer + "\n-->"
+	}
+	return withMarker(withoutFooter(body), footerMarker+"\n"+footer), nil
+}
+
+// withoutFooter strips the footer from the body. Footers change from run to run, e.g. their timestamp,
+// so they're ignored when deciding whether an existing PR needs its body updated.
+func withoutFooter(body string) string {
+	if i := strings.Index(body, footerMarker); i >= 0 {
+		return strings.TrimRight(body[:i], "\n")
+	}
+	return body
+}
@@ -0,0 +1,29 @@
+package push
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFooter(t *testing.T) {
+	data := FooterData{RunID: "run-1", Version: "v1.2.0", Timestamp: time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC), DocsURL: DocsURL}
+	body, err := withFooter("Bump deps", DefaultBodyFooterTemplate, false, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bump deps\n\n"+footerMarker+"\n---\nOpened by [microplane](https://github.com/Clever/microplane) v1.2.0, run run-1, at 2020-01-02 03:04 UTC", body)
+
+	data.Timestamp = data.Timestamp.Add(time.Hour)
+	later, err := withFooter("Bump deps", DefaultBodyFooterTemplate, false, data)
+	assert.NoError(t, err)
+	assert.False(t, different(bodyWithoutFooter(&body), bodyWithoutFooter(&later)), "a new timestamp alone doesn't update the body")
+	assert.True(t, different(bodyWithoutFooter(&body), bodyWithoutFooter(github.String("Bump all deps"))))
+
+	hidden, err := withFooter("Bump deps", "{{.RunID}}", true, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bump deps\n\n"+footerMarker+"\n<!--\nrun-1\n-->", hidden)
+
+	_, err = withFooter("Bump deps", "{{.Nope}}", false, data)
+	assert.Error(t, err)
+}
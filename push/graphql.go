@@ -0,0 +1,43 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// graphQLError is the first error Github's GraphQL API reported for a request which otherwise succeeded
+type graphQLError struct {
+	Message string
+}
+
+func (e *graphQLError) Error() string {
+	return e.Message
+}
+
+// graphQL runs a query or mutation against Github's GraphQL API, decoding its data into data
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, data interface{}, githubLimiter ratelimit.Limiter) error {
+	var result struct {
+		Data   json.RawMessage
+		Errors []graphQLError
+	}
+	githubLimiter.Wait()
+	resp, err := githubclient.Do(ctx, client, "POST", "../graphql", "", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}, &result)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return &result.Errors[0]
+	}
+	if data == nil || len(result.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(result.Data, data)
+}
@@ -0,0 +1,60 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// handoffComment mentions users when a PR is handed from its assignees to new owners
+func handoffComment(mentions []string, from []string, to []string) string {
+	return fmt.Sprintf("%s: this PR has been handed off from %s to %s",
+		strings.Join(userMentions(mentions), " "), strings.Join(userMentions(from), " "), strings.Join(userMentions(to), " "))
+}
+
+// postHandoff comments on the PR with the handoff message, unless an identical comment was already posted
+func postHandoff(ctx context.Context, client *github.Client, owner string, name string, number int, body string, retry RetryPolicy, githubLimiter ratelimit.Limiter) error {
+	_, err := postCommentOnce(ctx, client, owner, name, number, body, func(c string) bool { return c == body }, retry, githubLimiter)
+	return err
+}
+
+// postCommentOnce comments on the PR, unless it already has a comment which matches, e.g. from a previous run.
+// It reports whether it posted the comment.
+func postCommentOnce(ctx context.Context, client *github.Client, owner string, name string, number int, body string, matches func(string) bool, retry RetryPolicy, githubLimiter ratelimit.Limiter) (bool, error) {
+	posted := func() (bool, error) {
+		return hasComment(ctx, client, owner, name, number, matches, githubLimiter)
+	}
+	if found, err := posted(); err != nil || found {
+		return false, err
+	}
+	err := retryAPI(ctx, retry, githubLimiter, opCreateComment(posted), func() (resp *github.Response, err error) {
+		_, resp, err = client.Issues.CreateComment(ctx, owner, name, number, &github.IssueComment{Body: &body})
+		return resp, err
+	})
+	return err == nil, err
+}
+
+// hasComment checks whether the PR has a comment which matches
+func hasComment(ctx context.Context, client *github.Client, owner string, name string, number int, matches func(string) bool, githubLimiter ratelimit.Limiter) (bool, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		githubLimiter.Wait()
+		comments, resp, err := client.Issues.ListComments(ctx, owner, name, number, opts)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range comments {
+			if matches(c.GetBody()) {
+				return true, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return false, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,13 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandoffComment(t *testing.T) {
+	assert.Equal(t, "@carol @dave: this PR has been handed off from @alice to @bob @erin",
+		handoffComment([]string{"carol", "@dave", "carol", ""}, []string{"alice"}, []string{"bob", "@erin"}))
+	assert.Equal(t, "@alice,@bob", Output{PullRequestAssignee: "alice,bob"}.assignees(AssigneeMention))
+}
@@ -0,0 +1,80 @@
+package push
+
+import (
+	"context"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// SyncFailureLabel adds the label to a PR whose status is failure, and removes it once the status is success.
+// It's a no-op if the label is already in the desired state, or the status is pending.
+func SyncFailureLabel(ctx context.Context, owner string, name string, number int, status string, label string, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) error {
+	if status != "failure" && status != "success" {
+		return nil
+	}
+
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return err
+	}
+
+	githubLimiter.Wait()
+	labels, resp, err := client.Issues.ListLabelsByIssue(ctx, owner, name, number, &github.ListOptions{PerPage: 100})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	hasLabel := false
+	for _, l := range labels {
+		if l.GetName() == label {
+			hasLabel = true
+			break
+		}
+	}
+
+	if status == "failure" && !hasLabel {
+		githubLimiter.Wait()
+		_, resp, err = client.Issues.AddLabelsToIssue(ctx, owner, name, number, []string{label})
+		githubLimiter.Observe(resp)
+		return err
+	}
+	if status == "success" && hasLabel {
+		githubLimiter.Wait()
+		resp, err = client.Issues.RemoveLabelForIssue(ctx, owner, name, number, label)
+		githubLimiter.Observe(resp)
+		return err
+	}
+	return nil
+}
+
+// addLabels adds the labels the PR doesn't have yet, so re-running push doesn't add duplicates
+func addLabels(ctx context.Context, client *github.Client, owner string, name string, number int, labels []string, retry RetryPolicy, githubLimiter ratelimit.Limiter) error {
+	githubLimiter.Wait()
+	current, resp, err := client.Issues.ListLabelsByIssue(ctx, owner, name, number, &github.ListOptions{PerPage: 100})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	currentNames := []string{}
+	for _, l := range current {
+		currentNames = append(currentNames, l.GetName())
+	}
+
+	// label names are case insensitive on Github
+	missing := []string{}
+	for _, label := range uniqueLogins(labels...) {
+		if !containsLogin(currentNames, label) {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return retryAPI(ctx, retry, githubLimiter, opAddLabels, func() (resp *github.Response, err error) {
+		_, resp, err = client.Issues.AddLabelsToIssue(ctx, owner, name, number, missing)
+		return resp, err
+	})
+}
@@ -0,0 +1,164 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// branchLock is an advisory lock on a branch, so concurrent operators don't force-push over each other.
+// It's stored in the repo as refs/microplane/locks/<branch>, pointing at a parentless commit
+// whose message records who holds the lock and since when.
+type branchLock struct {
+	client        *github.Client
+	githubLimiter ratelimit.Limiter
+	owner         string
+	name          string
+	ref           string
+}
+
+// lockHolder is parsed from a lock commit's message
+type lockHolder struct {
+	Operator string
+	Acquired time.Time
+}
+
+func (h lockHolder) message() string {
+	return fmt.Sprintf("microplane lock\n\noperator: %s\nacquired: %s\n", h.Operator, h.Acquired.UTC().Format(time.RFC3339))
+}
+
+func parseLockHolder(message string) (lockHolder, error) {
+	var h lockHolder
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "operator: ") {
+			h.Operator = strings.TrimPrefix(line, "operator: ")
+		} else if strings.HasPrefix(line, "acquired: ") {
+			acquired, err := time.Parse(time.RFC3339, strings.TrimPrefix(line, "acquired: "))
+			if err != nil {
+				return h, err
+			}
+			h.Acquired = acquired
+		}
+	}
+	if h.Operator == "" || h.Acquired.IsZero() {
+		return h, errors.New("malformed lock commit")
+	}
+	return h, nil
+}
+
+// acquireLock takes the lock on branch for the authenticated user, unless another operator has held it for less than ttl.
+// Locks older than ttl are stale, and are taken over. Github can't update a ref only if it still points at the commit
+// we read, so a stale lock is deleted and then created afresh: of two operators taking it over at once, only one
+// creates the ref, and the other loses the race.
+func acquireLock(ctx context.Context, client *github.Client, owner string, name string, branch string, planDir string, baseRef string, ttl time.Duration, githubLimiter ratelimit.Limiter) (*branchLock, error) {
+	lock := &branchLock{
+		client:        client,
+		githubLimiter: githubLimiter,
+		owner:         owner,
+		name:          name,
+		ref:           "refs/microplane/locks/" + branch,
+	}
+
+	githubLimiter.Wait()
+	user, resp, err := client.Users.Get(ctx, "")
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return nil, err
+	}
+	holder := lockHolder{Operator: user.GetLogin(), Acquired: time.Now()}
+
+	// Is someone else holding the lock?
+	githubLimiter.Wait()
+	existing, resp, err := client.Git.GetRef(ctx, owner, name, lock.ref)
+	githubLimiter.Observe(resp)
+	exists := err == nil
+	if err != nil && !refNotFound(resp, err) {
+		return nil, err
+	}
+	if exists {
+		githubLimiter.Wait()
+		commit, resp, err := client.Git.GetCommit(ctx, owner, name, existing.GetObject().GetSHA())
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		current, err := parseLockHolder(commit.GetMessage())
+		if err == nil && current.Operator != holder.Operator && time.Since(current.Acquired) < ttl {
+			return nil, fmt.Errorf("branch %s is locked by %s since %s", branch, current.Operator, current.Acquired.Format(time.RFC3339))
+		}
+	}
+
+	// The lock commit needs a tree which exists on Github, so borrow the base branch's
+	gitRevParse := exec.CommandContext(ctx, "git", "rev-parse", baseRef+"^{tree}")
+	gitRevParse.Dir = planDir
+	output, err := gitRevParse.CombinedOutput()
+	if err != nil {
+		return nil, errors.New(string(output))
+	}
+	tree := strings.TrimSpace(string(output))
+
+	message := holder.message()
+	githubLimiter.Wait()
+	commit, resp, err := client.Git.CreateCommit(ctx, owner, name, &github.Commit{
+		Message: &message,
+		Tree:    &github.Tree{SHA: &tree},
+	})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		// another operator taking over the stale lock too may have deleted it already
+		if err := lock.release(ctx); err != nil && !refGone(err) {
+			return nil, err
+		}
+	}
+
+	ref := &github.Reference{Ref: &lock.ref, Object: &github.GitObject{SHA: commit.SHA}}
+	githubLimiter.Wait()
+	_, resp, err = client.Git.CreateRef(ctx, owner, name, ref)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+			// another operator created the lock between our read and write
+			return nil, fmt.Errorf("branch %s was just locked by another operator", branch)
+		}
+		return nil, err
+	}
+	return lock, nil
+}
+
+// release deletes the lock ref
+func (l *branchLock) release(ctx context.Context) error {
+	l.githubLimiter.Wait()
+	resp, err := l.client.Git.DeleteRef(ctx, l.owner, l.name, l.ref)
+	l.githubLimiter.Observe(resp)
+	return err
+}
+
+// refGone checks for a DeleteRef error meaning the ref was already deleted
+func refGone(err error) bool {
+	errResp, ok := err.(*github.ErrorResponse)
+	if !ok || errResp.Response == nil {
+		return false
+	}
+	return errResp.Response.StatusCode == http.StatusNotFound ||
+		(errResp.Response.StatusCode == http.StatusUnprocessableEntity && strings.Contains(errResp.Message, "Reference does not exist"))
+}
+
+// refNotFound checks for a GetRef error meaning there's no ref with exactly that name
+func refNotFound(resp *github.Response, err error) bool {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return true
+	}
+	// Github returns the refs with that prefix when there's no exact match
+	return err != nil && strings.Contains(err.Error(), "no exact match found")
+}
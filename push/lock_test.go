@@ -0,0 +1,64 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireLockTakesOverStaleLock(t *testing.T) {
+	dir, git := newTestRepo(t)
+	defer os.RemoveAll(dir)
+	git("commit", "-q", "--allow-empty", "-m", "base")
+
+	stale := lockHolder{Operator: "bob", Acquired: time.Now().Add(-2 * time.Hour)}.message()
+	var requests []string
+	createStatus := http.StatusCreated
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/user":
+			fmt.Fprint(w, `{"login": "alice"}`)
+		case r.Method == "GET" && r.URL.Path == "/repos/Clever/svc/git/refs/microplane/locks/main":
+			fmt.Fprint(w, `{"ref": "refs/microplane/locks/main", "object": {"sha": "stale"}}`)
+		case r.Method == "GET" && r.URL.Path == "/repos/Clever/svc/git/commits/stale":
+			json.NewEncoder(w).Encode(map[string]string{"sha": "stale", "message": stale})
+		case r.Method == "POST" && r.URL.Path == "/repos/Clever/svc/git/commits":
+			fmt.Fprint(w, `{"sha": "fresh"}`)
+		case r.Method == "DELETE" && r.URL.Path == "/repos/Clever/svc/git/refs/microplane/locks/main":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST" && r.URL.Path == "/repos/Clever/svc/git/refs":
+			w.WriteHeader(createStatus)
+			fmt.Fprint(w, `{"message": "Reference already exists"}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	_, err := acquireLock(context.Background(), client, "Clever", "svc", "main", dir, "HEAD", time.Hour, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"GET /user",
+		"GET /repos/Clever/svc/git/refs/microplane/locks/main",
+		"GET /repos/Clever/svc/git/commits/stale",
+		"POST /repos/Clever/svc/git/commits",
+		"DELETE /repos/Clever/svc/git/refs/microplane/locks/main",
+		"POST /repos/Clever/svc/git/refs",
+	}, requests, "the stale lock is deleted and created afresh, never force-updated")
+
+	createStatus = http.StatusUnprocessableEntity
+	_, err = acquireLock(context.Background(), client, "Clever", "svc", "main", dir, "HEAD", time.Hour, limiter)
+	assert.EqualError(t, err, "branch main was just locked by another operator", "another operator took over the stale lock first")
+
+	_, err = acquireLock(context.Background(), client, "Clever", "svc", "main", dir, "HEAD", 3*time.Hour, limiter)
+	assert.Contains(t, err.Error(), "branch main is locked by bob since")
+}
@@ -0,0 +1,171 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// What to do when the plan's PR is on another branch, see Input.RenamedBranch
+const (
+	// RenamedBranchAdopt pushes to the PR's branch, so the existing PR is updated rather than orphaned
+	RenamedBranchAdopt = "adopt"
+	// RenamedBranchWarn pushes to BranchName, opening a new PR, and reports the old one in Output.OrphanedPRURL
+	RenamedBranchWarn = "warn"
+)
+
+// runIDMarker is a hidden comment in the PR body which identifies the run that opened it
+func runIDMarker(runID string) string {
+	return fmt.Sprintf("<!-- microplane-run-id: %s -->", runID)
+}
+
+// configHashMarker is a hidden comment in the PR body which identifies the config that produced it
+func configHashMarker(hash string) string {
+	return fmt.Sprintf("<!-- microplane-config-hash: %s -->", hash)
+}
+
+// planMarker is a hidden comment in the PR body which identifies the plan it was opened for
+func planMarker(planName string) string {
+	return fmt.Sprintf("<!-- microplane: %s -->", planName)
+}
+
+// withRunIDMarker appends the run's marker to the body, unless it's already there
+func withRunIDMarker(body string, runID string) string {
+	return withMarker(body, runIDMarker(runID))
+}
+
+// withMarker appends a hidden marker to the body, unless it's already there.
+// It's deterministic, so re-runs don't see a different body and edit the PR for nothing.
+func withMarker(body string, marker string) string {
+	if strings.Contains(body, marker) {
+		return body
+	}
+	if body == "" {
+		return marker
+	}
+	return body + "\n\n" + marker
+}
+
+// findPRByMarker looks for an open PR whose body has the marker, regardless of its head branch.
+// It returns nil if there isn't one.
+func findPRByMarker(ctx context.Context, client *github.Client, owner string, name string, marker string, githubLimiter ratelimit.Limiter) (*github.PullRequest, error) {
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		githubLimiter.Wait()
+		prs, resp, err := client.PullRequests.List(ctx, owner, name, opts)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			// a PR from a fork can't be pushed to as if it were our branch
+			if pr.GetHead().GetRepo().GetOwner().GetLogin() != owner {
+				continue
+			}
+			if strings.Contains(pr.GetBody(), marker) {
+				return pr, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// findPRByMarkers looks for the PR by the run's marker, then by the plan's. byPlan is set when it was found by the plan's.
+func findPRByMarkers(ctx context.Context, client *github.Client, input Input, githubLimiter ratelimit.Limiter) (pr *github.PullRequest, byPlan bool, err error) {
+	if input.RunID != "" {
+		pr, err := findPRByMarker(ctx, client, input.RepoOwner, input.RepoName, runIDMarker(input.RunID), githubLimiter)
+		if err != nil || pr != nil {
+			return pr, false, err
+		}
+	}
+	if input.PlanName == "" {
+		return nil, false, nil
+	}
+	pr, err = findPRByMarker(ctx, client, input.RepoOwner, input.RepoName, planMarker(input.PlanName), githubLimiter)
+	return pr, pr != nil, err
+}
+
+// markers are the hidden markers this push records in the PR body
+func (input Input) markers() []string {
+	markers := []string{}
+	if input.RunID != "" {
+		markers = append(markers, runIDMarker(input.RunID))
+	}
+	if input.PlanName != "" {
+		markers = append(markers, planMarker(input.PlanName))
+	}
+	if input.ConfigHash != "" {
+		markers = append(markers, configHashMarker(input.ConfigHash))
+	}
+	return markers
+}
+
+// ownsPR is whether the PR's body has one of this push's markers, so it was opened for the same campaign
+func (input Input) ownsPR(pr *github.PullRequest) bool {
+	for _, marker := range input.markers() {
+		if strings.Contains(pr.GetBody(), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isolatedBranch is the branch a push with Input.StrictMarkers uses when another campaign's PR is on BranchName.
+// It's suffixed with the run ID, plan name, or config hash, so re-runs of the same campaign pick the same branch.
+func isolatedBranch(input Input) string {
+	suffix := input.ConfigHash
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	if input.RunID != "" {
+		suffix = input.RunID
+	} else if input.PlanName != "" {
+		suffix = input.PlanName
+	}
+	return input.BranchName + "-" + suffix
+}
+
+// isolateBranch moves the push to isolatedBranch when BranchName's open PR doesn't have any of the push's markers.
+// It returns the other PR's URL, or "" if the push stays on BranchName.
+func isolateBranch(ctx context.Context, client *github.Client, input *Input, base string, githubLimiter ratelimit.Limiter) (string, error) {
+	if len(input.markers()) == 0 {
+		return "", fmt.Errorf("StrictMarkers needs a RunID, PlanName, or ConfigHash to recognize its PRs")
+	}
+	pr, err := findOpenPR(ctx, client, input.RepoOwner, input.RepoName, input.head(), base, githubLimiter)
+	if err != nil || pr == nil || input.ownsPR(pr) {
+		return "", err
+	}
+
+	branch := isolatedBranch(*input)
+	if err := validateBranch(branch); err != nil {
+		return "", fmt.Errorf("could not move off branch %s, which %s is open from: %s", input.BranchName, pr.GetHTMLURL(), err)
+	}
+	isolated := *input
+	isolated.BranchName = branch
+	other, err := findOpenPR(ctx, client, input.RepoOwner, input.RepoName, isolated.head(), base, githubLimiter)
+	if err != nil {
+		return "", err
+	} else if other != nil && !input.ownsPR(other) {
+		return "", fmt.Errorf("PRs from another campaign are open from both %s and %s: %s, %s", input.BranchName, branch, pr.GetHTMLURL(), other.GetHTMLURL())
+	}
+	input.BranchName = branch
+	return pr.GetHTMLURL(), nil
+}
+
+// findUnchangedPR returns the open PR for head if its body has the config hash's marker, or else nil
+func findUnchangedPR(ctx context.Context, client *github.Client, owner string, name string, head string, base string, configHash string, githubLimiter ratelimit.Limiter) (*github.PullRequest, error) {
+	pr, err := findOpenPR(ctx, client, owner, name, head, base, githubLimiter)
+	if err != nil || pr == nil {
+		return nil, err
+	}
+	if !strings.Contains(pr.GetBody(), configHashMarker(configHash)) {
+		return nil, nil
+	}
+	return pr, nil
+}
@@ -0,0 +1,87 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRunIDMarker(t *testing.T) {
+	body := withRunIDMarker("For the eng reorg", "run-1")
+	assert.Equal(t, "For the eng reorg\n\n<!-- microplane-run-id: run-1 -->", body)
+
+	// already marked
+	assert.Equal(t, body, withRunIDMarker(body, "run-1"))
+
+	assert.Equal(t, "<!-- microplane-run-id: run-1 -->", withRunIDMarker("", "run-1"))
+}
+
+func TestConfigHashMarkerIsStable(t *testing.T) {
+	body := withMarker("For the eng reorg", configHashMarker("abc123"))
+	// re-running with the same config produces the same body, so the PR isn't edited
+	assert.False(t, different(&body, github.String(withMarker("For the eng reorg", configHashMarker("abc123")))))
+	assert.True(t, different(&body, github.String(withMarker("For the eng reorg", configHashMarker("def456")))))
+}
+
+func TestFindPRByMarkers(t *testing.T) {
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"number": 3, "body": "Bump deps\n\n<!-- microplane: bump-deps -->", "head": {"ref": "old", "repo": {"owner": {"login": "someone"}}}},
+			{"number": 4, "body": "Bump deps\n\n<!-- microplane: bump-deps -->", "head": {"ref": "bump-deps", "repo": {"owner": {"login": "Clever"}}}},
+			{"number": 5, "body": "<!-- microplane-run-id: run-1 -->", "head": {"ref": "renamed", "repo": {"owner": {"login": "Clever"}}}}
+		]`)
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	pr, byPlan, err := findPRByMarkers(context.Background(), client, Input{RepoOwner: "Clever", RepoName: "svc", RunID: "run-1", PlanName: "bump-deps"}, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, pr.GetNumber(), "the run's marker is preferred")
+	assert.False(t, byPlan)
+
+	pr, byPlan, err = findPRByMarkers(context.Background(), client, Input{RepoOwner: "Clever", RepoName: "svc", RunID: "run-2", PlanName: "bump-deps"}, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, pr.GetNumber(), "PRs from forks are skipped")
+	assert.True(t, byPlan)
+
+	pr, _, err = findPRByMarkers(context.Background(), client, Input{RepoOwner: "Clever", RepoName: "svc", PlanName: "other"}, limiter)
+	assert.NoError(t, err)
+	assert.Nil(t, pr)
+}
+
+func TestIsolateBranch(t *testing.T) {
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("head") {
+		case "Clever:mp/ours":
+			fmt.Fprint(w, `[{"number": 3, "body": "<!-- microplane-run-id: run-1 -->"}]`)
+		case "Clever:mp/shared":
+			fmt.Fprint(w, `[{"number": 4, "body": "Another campaign", "html_url": "https://github.com/Clever/svc/pull/4"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	input := Input{RepoOwner: "Clever", RepoName: "svc", BranchName: "mp/ours", RunID: "run-1"}
+	shared, err := isolateBranch(context.Background(), client, &input, "master", limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "", shared)
+	assert.Equal(t, "mp/ours", input.BranchName, "the branch's PR has the run's marker")
+
+	input = Input{RepoOwner: "Clever", RepoName: "svc", BranchName: "mp/shared", ConfigHash: "0123456789abcdef"}
+	shared, err = isolateBranch(context.Background(), client, &input, "master", limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/Clever/svc/pull/4", shared)
+	assert.Equal(t, "mp/shared-01234567", input.BranchName)
+
+	input = Input{RepoOwner: "Clever", RepoName: "svc", BranchName: "mp/shared"}
+	_, err = isolateBranch(context.Background(), client, &input, "master", limiter)
+	assert.Error(t, err, "there's no marker to recognize the campaign's PRs by")
+}
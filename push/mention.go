@@ -0,0 +1,93 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// DefaultMentionTemplate is the comment mentioning Input.MentionTeams, for Input.MentionTemplate
+const DefaultMentionTemplate = "{{.Teams}} FYI"
+
+// mentionMarker identifies the team mention comment, so re-runs don't post it again even if its text changed
+const mentionMarker = "<!-- microplane-team-mention -->"
+
+// Results of mentioning teams, see Output.TeamMention
+const (
+	// TeamMentionPosted is a mention comment posted by this run
+	TeamMentionPosted = "posted"
+	// TeamMentionExisting is a mention comment already posted by a previous run
+	TeamMentionExisting = "existing"
+)
+
+// MentionData is available to Input.MentionTemplate, e.g. {{.Teams}}
+type MentionData struct {
+	// Teams mentions each team, e.g. "@Clever/platform @Clever/security"
+	Teams    string
+	Org      string
+	Repo     string
+	PRNumber int
+}
+
+// teamMentions are @-mentions of teams, which are in the repo owner's org unless given as "org/team"
+func teamMentions(owner string, teams []string) string {
+	seen := map[string]bool{}
+	mentions := []string{}
+	for _, t := range teams {
+		t = strings.TrimPrefix(t, "@")
+		if t == "" {
+			continue
+		}
+		if !strings.Contains(t, "/") {
+			t = owner + "/" + t
+		}
+		if seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		mentions = append(mentions, "@"+t)
+	}
+	return strings.Join(mentions, " ")
+}
+
+// userMentions are @-mentions of each user, e.g. "@alice", dropping empty and repeated logins
+func userMentions(logins []string) []string {
+	mentions := []string{}
+	for _, login := range logins {
+		login = strings.TrimPrefix(login, "@")
+		if login != "" && !containsLogin(mentions, "@"+login) {
+			mentions = append(mentions, "@"+login)
+		}
+	}
+	return mentions
+}
+
+// mentionComment renders the comment mentioning the teams, with the marker
+func mentionComment(mentionTemplate string, data MentionData) (string, error) {
+	tmpl, err := template.New("mention").Parse(mentionTemplate)
+	if err != nil {
+		return "", fmt.Errorf("could not parse team mention %q: %s", mentionTemplate, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render team mention %q: %s", mentionTemplate, err)
+	}
+	return withMarker(b.String(), mentionMarker), nil
+}
+
+// mentionTeams comments on the PR mentioning the teams, unless a previous run already did
+func mentionTeams(ctx context.Context, client *github.Client, owner string, name string, number int, body string, retry RetryPolicy, githubLimiter ratelimit.Limiter) (string, error) {
+	hasMarker := func(c string) bool { return strings.Contains(c, mentionMarker) }
+	posted, err := postCommentOnce(ctx, client, owner, name, number, body, hasMarker, retry, githubLimiter)
+	if err != nil {
+		return "", err
+	} else if !posted {
+		return TeamMentionExisting, nil
+	}
+	return TeamMentionPosted, nil
+}
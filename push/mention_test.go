@@ -0,0 +1,53 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamMentions(t *testing.T) {
+	assert.Equal(t, "@Clever/platform @other/security", teamMentions("Clever", []string{"platform", "@other/security", "Clever/Platform", ""}))
+
+	body, err := mentionComment(DefaultMentionTemplate, MentionData{Teams: "@Clever/platform", Org: "Clever", Repo: "svc", PRNumber: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, "@Clever/platform FYI\n\n"+mentionMarker, body)
+}
+
+func TestMentionTeams(t *testing.T) {
+	existing := `[{"body": "LGTM"}]`
+	posted := []string{}
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/Clever/svc/issues/7/comments" && r.Method == "GET":
+			fmt.Fprint(w, existing)
+		case r.URL.Path == "/repos/Clever/svc/issues/7/comments" && r.Method == "POST":
+			var c github.IssueComment
+			json.NewDecoder(r.Body).Decode(&c)
+			posted = append(posted, c.GetBody())
+			fmt.Fprint(w, `{"id": 1}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	result, err := mentionTeams(context.Background(), client, "Clever", "svc", 7, "@Clever/platform FYI\n\n"+mentionMarker, RetryPolicy{}, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, TeamMentionPosted, result)
+	assert.Equal(t, []string{"@Clever/platform FYI\n\n" + mentionMarker}, posted)
+
+	existing = `[{"body": "@Clever/platform heads up\n\n<!-- microplane-team-mention -->"}]`
+	result, err = mentionTeams(context.Background(), client, "Clever", "svc", 7, "@Clever/platform FYI\n\n"+mentionMarker, RetryPolicy{}, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, TeamMentionExisting, result, "a re-run doesn't post again, even with different text")
+	assert.Len(t, posted, 1)
+}
@@ -0,0 +1,39 @@
+package push
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// mergeability re-reads the PR until Github has computed whether it can be merged, which it does asynchronously
+// after the PR is opened or pushed to. After polls tries, or if the PR can't be read, the PR's mergeability may still
+// be unknown (nil): it's only reported, so it isn't worth failing the push over. The only error is ctx's.
+func mergeability(ctx context.Context, client *github.Client, owner string, name string, pr *github.PullRequest, polls int, interval time.Duration, githubLimiter ratelimit.Limiter) (*bool, string, error) {
+	for poll := 0; poll < polls && pr.Mergeable == nil; poll++ {
+		if poll > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, "", ctx.Err()
+			case <-timer.C:
+			}
+		}
+		githubLimiter.Wait()
+		next, resp, err := client.PullRequests.Get(ctx, owner, name, pr.GetNumber())
+		githubLimiter.Observe(resp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			log.Printf("%s/%s - could not check whether PR #%d has conflicts: %s", owner, name, pr.GetNumber(), err)
+			return nil, "", nil
+		}
+		pr = next
+	}
+	return pr.Mergeable, pr.GetMergeableState(), nil
+}
@@ -0,0 +1,55 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeability(t *testing.T) {
+	gets := 0
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/Clever/svc/pulls/8" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/repos/Clever/svc/pulls/9" {
+			fmt.Fprint(w, `{"number": 9, "mergeable": null, "mergeable_state": "unknown"}`)
+			return
+		}
+		assert.Equal(t, "/repos/Clever/svc/pulls/7", r.URL.Path)
+		gets++
+		if gets < 2 {
+			fmt.Fprint(w, `{"number": 7, "mergeable": null, "mergeable_state": "unknown"}`)
+			return
+		}
+		fmt.Fprint(w, `{"number": 7, "mergeable": false, "mergeable_state": "dirty"}`)
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	mergeable, state, err := mergeability(context.Background(), client, "Clever", "svc", &github.PullRequest{Number: github.Int(7)}, 3, time.Millisecond, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, github.Bool(false), mergeable)
+	assert.Equal(t, "dirty", state)
+	assert.Equal(t, 2, gets, "stops polling once mergeability is known")
+
+	mergeable, _, err = mergeability(context.Background(), client, "Clever", "svc", &github.PullRequest{Number: github.Int(7)}, 0, time.Millisecond, limiter)
+	assert.NoError(t, err)
+	assert.Nil(t, mergeable)
+
+	mergeable, _, err = mergeability(context.Background(), client, "Clever", "svc", &github.PullRequest{Number: github.Int(8)}, 3, time.Millisecond, limiter)
+	assert.NoError(t, err, "a PR which can't be read has unknown mergeability")
+	assert.Nil(t, mergeable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err = mergeability(ctx, client, "Clever", "svc", &github.PullRequest{Number: github.Int(9)}, 3, time.Hour, limiter)
+	assert.Equal(t, context.DeadlineExceeded, err, "doesn't sleep through a cancellation")
+}
@@ -0,0 +1,47 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// setMilestone attaches the PR to the repo's open milestone with the given title
+func setMilestone(ctx context.Context, client *github.Client, owner string, name string, pr *github.PullRequest, title string, githubLimiter ratelimit.Limiter) error {
+	if pr.GetMilestone().GetTitle() == title {
+		return nil
+	}
+	number, err := milestoneNumber(ctx, client, owner, name, title, githubLimiter)
+	if err != nil {
+		return err
+	}
+	githubLimiter.Wait()
+	_, resp, err := client.Issues.Edit(ctx, owner, name, pr.GetNumber(), &github.IssueRequest{Milestone: &number})
+	githubLimiter.Observe(resp)
+	return err
+}
+
+// milestoneNumber finds the number of the repo's open milestone with the given title.
+// Milestones are per repo, so one missing from a repo is an error naming the repo, rather than being skipped.
+func milestoneNumber(ctx context.Context, client *github.Client, owner string, name string, title string, githubLimiter ratelimit.Limiter) (int, error) {
+	opt := &github.MilestoneListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		githubLimiter.Wait()
+		milestones, resp, err := client.Issues.ListMilestones(ctx, owner, name, opt)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range milestones {
+			if m.GetTitle() == title {
+				return m.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, fmt.Errorf("%s/%s has no open milestone %q", owner, name, title)
+		}
+		opt.Page = resp.NextPage
+	}
+}
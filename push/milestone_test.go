@@ -0,0 +1,41 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetMilestone(t *testing.T) {
+	var edited map[string]interface{}
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/Clever/svc/milestones":
+			assert.Equal(t, "open", r.URL.Query().Get("state"))
+			fmt.Fprint(w, `[{"number": 3, "title": "Go 1.10"}, {"number": 4, "title": "Node 8"}]`)
+		case r.URL.Path == "/repos/Clever/svc/issues/7" && r.Method == "PATCH":
+			json.NewDecoder(r.Body).Decode(&edited)
+			fmt.Fprint(w, `{"number": 7}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+	pr := &github.PullRequest{Number: github.Int(7)}
+
+	assert.NoError(t, setMilestone(context.Background(), client, "Clever", "svc", pr, "Node 8", limiter))
+	assert.Equal(t, map[string]interface{}{"milestone": float64(4)}, edited)
+
+	err := setMilestone(context.Background(), client, "Clever", "svc", pr, "Python 3", limiter)
+	if assert.Error(t, err) {
+		assert.Equal(t, `Clever/svc has no open milestone "Python 3"`, err.Error())
+	}
+}
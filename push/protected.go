@@ -0,0 +1,18 @@
+package push
+
+import "strings"
+
+// forcePushProtected checks whether `git push -f` was rejected because the branch is protected against force-pushes,
+// e.g. by a branch protection rule or ruleset which only lets humans force-push. Git's output doesn't say who the rule
+// exempts, so any such rejection counts.
+func forcePushProtected(pushOutput string) bool {
+	lower := strings.ToLower(pushOutput)
+	return strings.Contains(lower, "cannot force-push") ||
+		(strings.Contains(lower, "protected branch") && strings.Contains(lower, "force"))
+}
+
+// fallbackBranch is the branch Input.ForcePushFallback pushes to. It's the same on every run, so a re-run pushes to
+// the fallback branch again and updates its PR, rather than opening yet another one.
+func fallbackBranch(branch string) string {
+	return branch + "-fallback"
+}
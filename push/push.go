@@ -1,17 +1,28 @@
 package push
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
+	"io/ioutil"
+	"log"
+	"net/http"
 	"os"
 	"os/exec"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
 	"time"
 
-	"golang.org/x/oauth2"
+	"golang.org/x/sync/semaphore"
 
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
 	"github.com/google/go-github/github"
 )
 
@@ -35,12 +46,250 @@ type Input struct {
 	CommitMessage string
 	// PRBody is the body of the PR submitted to Github
 	PRBody string
-	// PRAssignee is the user who will be assigned the PR
+	// PRBodyTemplatePath, if set, is a text/template file of PRBodyData rendered for each repo as the PR body.
+	// It takes precedence over PRBody, which takes precedence over the remainder of the commit message.
+	PRBodyTemplatePath string
+	// MaxTitleLength, if set, truncates longer PR titles with an ellipsis, moving the rest of the title into the body
+	MaxTitleLength int
+	// UpdateTitle and UpdateBody, if set, replace the PR's title and body when an existing PR is reused,
+	// e.g. to note that it was refreshed by a re-run. Otherwise the title and body are the same as on creation.
+	UpdateTitle string
+	UpdateBody  string
+	// RetryWithMinimalBody retries opening a PR which Github rejects as invalid (a 422), e.g. because a bot enforces
+	// required fields in the body, with just the title and microplane's markers as its body. See Output.InvalidBodyError.
+	RetryWithMinimalBody bool
+	// Draft opens new PRs as drafts. Existing PRs are left as they are.
+	Draft bool
+	// DryRun computes the commit, and the PR's title, body, and base, without pushing or changing anything on Github.
+	// The PR isn't opened, so Output only has what would be pushed, see Output.DryRun.
+	// The plan's commits aren't squashed, signed off, or given a new author either, so CommitSHA is the plan's own commit.
+	DryRun bool
+	// Milestone, if set, is the title of the open milestone to attach the PR to. Each repo must have it.
+	Milestone string
+	// Labels are added to the PR, if it doesn't have them already
+	Labels []string
+	// Reviewers are users to request reviews from
+	Reviewers []string
+	// ReconcileReviewers removes reviewers requested by a previous run (PreviousReviewers) who are no longer in Reviewers
+	ReconcileReviewers bool
+	// PreviousReviewers is Output.RequestedReviewers from the previous run, if any
+	PreviousReviewers []string
+	// TeamReviewers are slugs of teams in the repo's org to request reviews from.
+	// They're reconciled like Reviewers, with PreviousTeamReviewers from Output.RequestedTeamReviewers.
+	TeamReviewers         []string
+	PreviousTeamReviewers []string
+	// PRAssignees are the users who will be assigned the PR
+	PRAssignees []string
+	// PRAssignee is appended to PRAssignees.
+	// Deprecated: use PRAssignees.
 	PRAssignee string
+	// AssignToCommitter assigns the PR to whoever most recently changed the PR's files on the base branch,
+	// falling back to PRAssignees, then FallbackAssignee, when they can't be found or assigned
+	AssignToCommitter bool
+	// FallbackAssignee is assigned instead when none of PRAssignees can be, e.g. because they aren't collaborators on the repo
+	FallbackAssignee string
+	// StrictAssignee fails the push when nobody could be assigned, rather than warning
+	StrictAssignee bool
+	// UserAgent, if set, identifies microplane's requests to Github
+	UserAgent string
+	// GithubToken authenticates requests to Github. It's required, e.g. from GITHUB_API_TOKEN or the gh CLI's login.
+	GithubToken string
+	// GithubBaseURL, if set, is the API of a Github Enterprise server, e.g. "https://github.example.com/api/v3/".
+	// The uploads URL is derived from it. Defaults to github.com.
+	GithubBaseURL string
 	// RepoOwner is the name of the user who owns the Github repo
 	RepoOwner string
 	// BranchName is the branch name in Git
 	BranchName string
+	// BuildURLHosts limits which hosts Output.CIBuildURL may point to, so internal CI URLs aren't shared
+	BuildURLHosts HostFilter
+	// CIContext is the status context or check run name (or glob) of the build to link in Output.CIBuildURL.
+	// Defaults to DefaultCIContext.
+	CIContext string
+	// CheckRuns includes check runs, e.g. from Github Actions, in the PR's status and in finding its build
+	CheckRuns bool
+	// IgnoreContexts are status contexts (or globs) which don't count towards the effective status
+	IgnoreContexts []string
+	// StatusAggregation is how the contexts' states are combined into the PR's status when they're mixed:
+	// StatusAggregationStrict or StatusAggregationLenient. Defaults to StatusAggregationGithub.
+	StatusAggregation string
+	// PreferDefaultBranch opens the PR against the repo's default branch when the resolved base differs from it,
+	// retargeting an already open PR. Otherwise the difference is only reported in Output.BaseWarning.
+	PreferDefaultBranch bool
+	// DiffBase is the ref that Output.DiffSummary compares HEAD against, e.g. the previous release tag.
+	// It defaults to the PR's base, and is fetched from the remote if it isn't available locally.
+	DiffBase string
+	// FetchBase fetches the base branch into shallow clones, so that diffs against it can be computed
+	FetchBase bool
+	// LockTTL, if set, takes an advisory lock on the branch while pushing, so concurrent operators don't
+	// force-push over each other. Another operator's lock older than LockTTL is considered stale and taken over.
+	LockTTL time.Duration
+	// Dispatch, if its Workflow is set, triggers a Github Actions workflow on the branch once the PR exists
+	Dispatch WorkflowDispatch
+	// Validate, if its Workflow is set, runs a Github Actions workflow on the pushed branch and only opens (or updates)
+	// the PR once it passes. When it doesn't, the PR is skipped, see Output.ValidationFailed.
+	Validate Validation
+	// LockConversation locks the PR's conversation once it's open, e.g. for purely informational PRs
+	LockConversation bool
+	// LockReason is Github's reason for the lock: "off-topic", "too heated", "resolved", or "spam". Optional.
+	LockReason string
+	// HandoffMentions are users to mention in a comment when an existing PR is assigned to someone other than PRAssignees.
+	// The comment hands the PR off to PRAssignees instead of reassigning it, so its assignees are left as they are.
+	HandoffMentions []string
+	// MentionTeams are teams to mention in a comment on the PR, without requesting their review, e.g. "platform" or
+	// "Clever/platform". Teams without an org are in the repo owner's. It's only posted once, even if re-run.
+	MentionTeams []string
+	// MentionTemplate is a text/template of MentionData for the MentionTeams comment. Defaults to DefaultMentionTemplate.
+	MentionTemplate string
+	// BodyFooterTemplate, if set, is a text/template of FooterData appended to the PR body, e.g. DefaultBodyFooterTemplate.
+	// It's ignored when checking whether an existing PR's body needs updating, so a new timestamp alone doesn't edit it.
+	BodyFooterTemplate string
+	// BodyFooterHidden hides the footer in an HTML comment
+	BodyFooterHidden bool
+	// Version is microplane's version, for the footer
+	Version string
+	// RunID, if set, is recorded as a hidden marker in the PR body. Re-runs find the PR by its marker,
+	// so a PR whose branch was renamed on Github is reused, with the commit pushed to its new branch name.
+	RunID string
+	// PlanName, if set, is recorded as a hidden marker in the PR body, e.g. "<!-- microplane: bump-deps -->". Re-runs
+	// which don't find the PR by RunID find it by its plan, so the plan's PR is found even after BranchName changed.
+	PlanName string
+	// RenamedBranch is what to do when the plan's PR is on a branch other than BranchName: RenamedBranchAdopt or
+	// RenamedBranchWarn. Defaults to RenamedBranchAdopt.
+	RenamedBranch string
+	// StrictMarkers only reuses the open PR from BranchName if its body has this push's RunID, PlanName, or ConfigHash
+	// marker, so campaigns whose branch names overlap don't update each other's PRs. Otherwise the push moves to a branch
+	// suffixed with the first of those that's set, opening a new PR, see Output.SharedBranchPRURL. At least one must be set.
+	StrictMarkers bool
+	// SanitizeBranch replaces characters git doesn't allow in BranchName, instead of failing the push
+	SanitizeBranch bool
+	// ForcePush force-pushes the branch, overwriting whatever is there. The CLI defaults it to true.
+	// Without it, pushing to a branch which has commits that aren't in the plan fails.
+	ForcePush bool
+	// ForcePushFallback, when a force-push is rejected because the branch is protected against it, pushes to a fallback
+	// branch and opens a new PR from it instead of failing, see Output.FallbackBranch. Once the fallback branch exists,
+	// later runs push straight to it. The previous PR is left open, see Output.SupersededPRURL.
+	ForcePushFallback bool
+	// RemoteName is the plan dir's git remote for the repo, "origin" if unset
+	RemoteName string
+	// HeadOwner, if set, is the owner of the fork the branch is pushed to, so the PR is opened from HeadOwner:BranchName
+	// against RepoOwner/RepoName. RemoteName should then be the fork's remote. Defaults to RepoOwner.
+	// The fork has the same name as the repo. The branch's lock, and the Dispatch and Validate workflows, are in the
+	// fork, since that's where the branch is.
+	HeadOwner string
+	// StatusSHA, if set, is the commit whose status is reported, e.g. a merge-base which is gated on, instead of the PR's head.
+	// It must be a full SHA.
+	StatusSHA string
+	// GitTimeout, if set, bounds how long each git command (e.g. `git log` or `git push`) may take, so one repo stuck on a
+	// credential prompt or a dead connection fails rather than holding up the run
+	GitTimeout time.Duration
+	// MergeablePolls is how many times to read the PR while waiting for Github to compute whether it can be merged,
+	// MergeablePollInterval apart. Zero doesn't wait, so Output.Mergeable may be unknown.
+	MergeablePolls        int
+	MergeablePollInterval time.Duration
+	// GitSlots and APISlots, if set, are shared by concurrent pushes to bound how many are running `git push`, and making
+	// Github API calls, at once. A push holds one slot at a time, so git pushes for some repos run while API calls for
+	// others are in flight. An API slot is only held while making API calls, not while waiting on a validation workflow
+	// or for Github to work out whether the PR can be merged.
+	GitSlots *semaphore.Weighted
+	APISlots *semaphore.Weighted
+	// Retry retries the whole push on transient errors
+	Retry RetryPolicy
+	// APIRetry retries the Github API calls which open, find, edit, assign, label, and comment on the PR, and read its
+	// status, when they fail with a rate limit error or a 5xx response, rather than failing the push. Comments aren't
+	// idempotent, so they're only posted again if the failed attempt didn't post them, see apiOperation.
+	APIRetry RetryPolicy
+	// OptOutFile, if set, is a file which repos add to opt out of automated changes, e.g. ".microplane-ignore".
+	// Repos with it are skipped, reporting Output.OptedOut.
+	OptOutFile string
+	// SkipPRDisabled skips repos which don't accept PRs, e.g. archived repos, reporting Output.PRDisabled
+	// rather than failing. The branch has already been pushed by then.
+	SkipPRDisabled bool
+	// SkipReadOnly skips repos the token can read but not push to, reporting Output.ReadOnly rather than failing, e.g. for
+	// audit runs in a fleet with mixed permissions. It checks the token's permission before pushing, at the cost of an
+	// API request, and also skips repos whose push or PR is denied.
+	SkipReadOnly bool
+	// ConfigHash, if set, identifies the config which produced this change, and is recorded as a hidden marker in the PR body
+	ConfigHash string
+	// SkipUnchangedConfig doesn't push again when the open PR's body has the same ConfigHash
+	SkipUnchangedConfig bool
+	// AutoMerge turns on Github's auto-merge for the PR, so it merges itself with MergeMethod once required checks pass,
+	// without running the merge step. The repo must allow auto-merge in its settings.
+	AutoMerge bool
+	// MergeMethod is how AutoMerge merges the PR: MergeMethodMerge, MergeMethodSquash, or MergeMethodRebase
+	MergeMethod string
+	// IgnoreWhitespace treats a change which only touches whitespace as no change, e.g. for formatting-agnostic
+	// campaigns, reporting Output.NoChanges
+	IgnoreWhitespace bool
+	// SkipUpToDate reuses an open PR as-is, without updating its title and body,
+	// when the branch was already up to date (see Output.Unchanged)
+	SkipUpToDate bool
+	// SourceBranch, if set, is the local branch with the change, which is pushed instead of HEAD
+	SourceBranch string
+	// SquashBeforePush replaces the plan's commits with a single commit with CommitMessage, keeping the latest commit's author.
+	// The base is fetched if it isn't available locally, e.g. in a shallow clone.
+	SquashBeforePush bool
+	// ChangedFiles, if set, records Output.ChangedFiles from the local diff against DiffBase (ChangedFilesLocal),
+	// or from Github (ChangedFilesAPI), which is an extra request but reflects the actual PR
+	ChangedFiles string
+	// FileCheck warns about, or with Strict blocks, binary or large files in the change
+	FileCheck FileCheck
+	// SignOff adds a Signed-off-by trailer for the configured git user to the commit, like `git commit -s`
+	SignOff bool
+	// AuthorName and AuthorEmail override the author of the commit on HEAD, e.g. so commits pushed from CI aren't
+	// attributed to the runner's git config. Empty fields keep the commit's author.
+	AuthorName  string
+	AuthorEmail string
+	// CommitterName and CommitterEmail override the ambient git config for commits amended by the push, e.g. by
+	// AuthorName, SquashBeforePush, or SignOff. Empty fields use the ambient git config.
+	CommitterName  string
+	CommitterEmail string
+	// Progress, if set, is called as the push moves through each phase
+	Progress func(phase string)
+	// Tracer, if set, traces the push with a span for each phase. Otherwise the push isn't traced.
+	Tracer Tracer
+	// BaseResolver, if set, chooses the base branch for a repo, given as "owner/name", e.g. by looking it up in a
+	// service catalog. It takes precedence over BaseFromTopics and BaseBranches, which are only used when it
+	// returns "". An error fails the push. PreferDefaultBranch still applies to the branch it chooses.
+	BaseResolver func(repo string) (string, error)
+	// BaseFromTopics derives the base branch from a repo topic like "mp-base-develop",
+	// falling back to the repo's default branch. It takes precedence over BaseBranches.
+	BaseFromTopics bool
+	// BaseBranches are candidate branches to open the PR against, in order of preference.
+	// The first that exists in the repo is used. Defaults to "master".
+	BaseBranches []string
+}
+
+// remote is RemoteName, defaulting to origin
+func (input Input) remote() string {
+	if input.RemoteName == "" {
+		return "origin"
+	}
+	return input.RemoteName
+}
+
+// headOwner owns the repo the branch is pushed to, a fork of the same name when HeadOwner is set
+func (input Input) headOwner() string {
+	if input.HeadOwner != "" {
+		return input.HeadOwner
+	}
+	return input.RepoOwner
+}
+
+// head is the PR's head, qualified by the owner of the repo the branch is in, e.g. "fork-owner:branch"
+func (input Input) head() string {
+	return fmt.Sprintf("%s:%s", input.headOwner(), input.BranchName)
+}
+
+// assignees are PRAssignees, with the deprecated PRAssignee
+func (input Input) assignees() []string {
+	return uniqueLogins(append(append([]string{}, input.PRAssignees...), input.PRAssignee)...)
+}
+
+func (input Input) progress(phase string) {
+	if input.Progress != nil {
+		input.Progress(phase)
+	}
 }
 
 // Output from Push()
@@ -50,148 +299,1163 @@ type Output struct {
 	PullRequestURL            string
 	PullRequestNumber         int
 	PullRequestCombinedStatus string // failure, pending, or success
-	PullRequestAssignee       string
-	CircleCIBuildURL          string
+	// PullRequestEffectiveStatus is the combined status, excluding Input.IgnoreContexts
+	PullRequestEffectiveStatus string
+	// PullRequestContextStatuses maps each status context to its state
+	PullRequestContextStatuses map[string]string
+	// Statuses are the PR's commit statuses, with their target URLs
+	Statuses []StatusDetail
+	// StatusAggregation is Input.StatusAggregation, for recomputing the effective status later
+	StatusAggregation string
+	// IgnoreContexts is Input.IgnoreContexts, so Format can leave them out
+	IgnoreContexts []string
+	// CheckRuns is Input.CheckRuns, for reading the status again later, see GetEffectiveStatus
+	CheckRuns bool
+	// PullRequestAssignee is who the PR was actually assigned to, comma separated. It's Input.FallbackAssignee
+	// when none of Input.PRAssignees could be assigned, or empty when nobody could.
+	PullRequestAssignee string
+	// AssigneeWarning is set when any of Input.PRAssignees couldn't be assigned
+	AssigneeWarning  string
+	CircleCIBuildURL string
+	// CIBuildURL is the URL of the build matching Input.CIContext, from any CI provider
+	CIBuildURL string
+	BaseBranch string
+	// BaseWarning is set when BaseBranch isn't the repo's default branch
+	BaseWarning string
+	// Attempts is how many times the push was tried, see Input.Retry
+	Attempts int
+	// DryRun is set when nothing was pushed, see Input.DryRun. PullRequestHead, PullRequestTitle, and PullRequestBody
+	// are what the PR would have been opened with.
+	DryRun           bool
+	PullRequestHead  string
+	PullRequestTitle string
+	PullRequestBody  string
+	// Draft is set when the PR is still a draft, see Input.Draft
+	Draft bool
+	// InvalidBodyError is why Github rejected the PR's full body, when it was opened with a minimal body instead, see Input.RetryWithMinimalBody
+	InvalidBodyError string
+	// StatusSHA is the commit the PR's status was read from, see Input.StatusSHA
+	StatusSHA string
+	// Mergeable is whether the PR can be merged without conflicts, nil if Github hadn't worked it out yet, see Input.MergeablePolls.
+	// MergeableState is Github's more detailed state, e.g. "clean", "dirty" (conflicts), "blocked", or "behind".
+	Mergeable      *bool
+	MergeableState string
+	// Milestone is Input.Milestone, which the PR is attached to
+	Milestone string
+	// Labels are Input.Labels, which the PR has
+	Labels []string
+	// RequestedReviewers are the reviewers microplane is responsible for, see Input.ReconcileReviewers
+	RequestedReviewers []string
+	// FilteredReviewers weren't requested, since they authored the PR
+	FilteredReviewers []string
+	// ReviewerWarning is set when Github refused to request a review from the PR's author anyway
+	ReviewerWarning string
+	// RequestedTeamReviewers are the team reviewers microplane is responsible for, see Input.TeamReviewers
+	RequestedTeamReviewers []string
+	// UnknownTeamReviewers weren't requested, since they aren't teams in the repo's org
+	UnknownTeamReviewers []string
+	// WorkflowDispatched is set when Input.Dispatch's workflow was triggered
+	WorkflowDispatched bool
+	// ConversationLocked is set when the PR's conversation is locked, see Input.LockConversation
+	ConversationLocked bool
+	// AutoMerge is set when Github's auto-merge was turned on for the PR, see Input.AutoMerge
+	AutoMerge bool
+	// AutoMergeWarning is why auto-merge wasn't turned on, when that's not an error, e.g. the PR can already be merged
+	AutoMergeWarning string
+	// TeamMention is TeamMentionPosted or TeamMentionExisting when Input.MentionTeams are mentioned
+	TeamMention string
+	// ChangedFiles are the files the PR changed, see Input.ChangedFiles
+	ChangedFiles []string
+	// FlaggedFiles are files in the change which failed Input.FileCheck
+	FlaggedFiles []string
+	// DiffSummary is the `git diff --shortstat` of HEAD against DiffBase
+	DiffSummary string
+	DiffBase    string
+	// NoChanges is set when there is no diff against the base branch, or no commits ahead of it, so nothing was
+	// pushed and no PR was opened. It's the skip flag for re-runs, rather than a separate field.
+	NoChanges       bool
+	NoChangesReason string
+	// Unchanged is set when the branch was already up to date, so the push didn't change anything
+	Unchanged bool
+	// ConfigHash is Input.ConfigHash, and ConfigUnchanged is set when the open PR already had it, so the push was skipped
+	ConfigHash      string
+	ConfigUnchanged bool
+	// OptedOut is set when the repo has Input.OptOutFile, so it was skipped
+	OptedOut       bool
+	OptedOutReason string
+	// PRDisabled is set when the repo doesn't accept PRs, so none was opened, see Input.SkipPRDisabled
+	PRDisabled       bool
+	PRDisabledReason string
+	// ReadOnly is set when the token can't push to the repo, so it was skipped, see Input.SkipReadOnly
+	ReadOnly       bool
+	ReadOnlyReason string
+	// ValidationFailed is set when Input.Validate's workflow didn't pass, so no PR was opened
+	ValidationFailed     bool
+	ValidationConclusion string
+	// ValidationURL is the validation workflow's run
+	ValidationURL string
+	// BranchRenamedFrom is set when the PR was found by Input.RunID or Input.PlanName on a branch renamed from this one
+	BranchRenamedFrom string
+	// OrphanedPRURL is the plan's PR on another branch, left open when Input.RenamedBranch is RenamedBranchWarn
+	OrphanedPRURL string
+	// SharedBranchPRURL is another campaign's PR from Input.BranchName, which Input.StrictMarkers pushed around
+	SharedBranchPRURL string
+	// FallbackBranch is the branch pushed to when Input.BranchName was protected against force-pushes, see
+	// Input.ForcePushFallback
+	FallbackBranch string
+	// SupersededPRURL is the open PR from Input.BranchName, left open when the commit was pushed to FallbackBranch
+	SupersededPRURL string
+	// Pacing is how long the push's Github requests waited on rate limits, if the caller tracked it
+	Pacing ratelimit.Waits
+}
+
+// outputJSON is Output with snake_case keys, for ToJSON. push.json keeps Output's field names, so earlier runs' outputs
+// still load. It must have the same fields as Output, in the same order, so that Output converts to it.
+type outputJSON struct {
+	Success                    bool              `json:"success"`
+	CommitSHA                  string            `json:"commit_sha"`
+	PullRequestURL             string            `json:"pull_request_url"`
+	PullRequestNumber          int               `json:"pull_request_number"`
+	PullRequestCombinedStatus  string            `json:"pull_request_combined_status"`
+	PullRequestEffectiveStatus string            `json:"pull_request_effective_status"`
+	PullRequestContextStatuses map[string]string `json:"pull_request_context_statuses"`
+	Statuses                   []StatusDetail    `json:"statuses"`
+	StatusAggregation          string            `json:"status_aggregation"`
+	IgnoreContexts             []string          `json:"ignore_contexts"`
+	CheckRuns                  bool              `json:"check_runs"`
+	PullRequestAssignee        string            `json:"pull_request_assignee"`
+	AssigneeWarning            string            `json:"assignee_warning"`
+	CircleCIBuildURL           string            `json:"circle_ci_build_url"`
+	CIBuildURL                 string            `json:"ci_build_url"`
+	BaseBranch                 string            `json:"base_branch"`
+	BaseWarning                string            `json:"base_warning"`
+	Attempts                   int               `json:"attempts"`
+	DryRun                     bool              `json:"dry_run"`
+	PullRequestHead            string            `json:"pull_request_head"`
+	PullRequestTitle           string            `json:"pull_request_title"`
+	PullRequestBody            string            `json:"pull_request_body"`
+	Draft                      bool              `json:"draft"`
+	InvalidBodyError           string            `json:"invalid_body_error"`
+	StatusSHA                  string            `json:"status_sha"`
+	Mergeable                  *bool             `json:"mergeable"`
+	MergeableState             string            `json:"mergeable_state"`
+	Milestone                  string            `json:"milestone"`
+	Labels                     []string          `json:"labels"`
+	RequestedReviewers         []string          `json:"requested_reviewers"`
+	FilteredReviewers          []string          `json:"filtered_reviewers"`
+	ReviewerWarning            string            `json:"reviewer_warning"`
+	RequestedTeamReviewers     []string          `json:"requested_team_reviewers"`
+	UnknownTeamReviewers       []string          `json:"unknown_team_reviewers"`
+	WorkflowDispatched         bool              `json:"workflow_dispatched"`
+	ConversationLocked         bool              `json:"conversation_locked"`
+	AutoMerge                  bool              `json:"auto_merge"`
+	AutoMergeWarning           string            `json:"auto_merge_warning"`
+	TeamMention                string            `json:"team_mention"`
+	ChangedFiles               []string          `json:"changed_files"`
+	FlaggedFiles               []string          `json:"flagged_files"`
+	DiffSummary                string            `json:"diff_summary"`
+	DiffBase                   string            `json:"diff_base"`
+	NoChanges                  bool              `json:"no_changes"`
+	NoChangesReason            string            `json:"no_changes_reason"`
+	Unchanged                  bool              `json:"unchanged"`
+	ConfigHash                 string            `json:"config_hash"`
+	ConfigUnchanged            bool              `json:"config_unchanged"`
+	OptedOut                   bool              `json:"opted_out"`
+	OptedOutReason             string            `json:"opted_out_reason"`
+	PRDisabled                 bool              `json:"pr_disabled"`
+	PRDisabledReason           string            `json:"pr_disabled_reason"`
+	ReadOnly                   bool              `json:"read_only"`
+	ReadOnlyReason             string            `json:"read_only_reason"`
+	ValidationFailed           bool              `json:"validation_failed"`
+	ValidationConclusion       string            `json:"validation_conclusion"`
+	ValidationURL              string            `json:"validation_url"`
+	BranchRenamedFrom          string            `json:"branch_renamed_from"`
+	OrphanedPRURL              string            `json:"orphaned_pr_url"`
+	SharedBranchPRURL          string            `json:"shared_branch_pr_url"`
+	FallbackBranch             string            `json:"fallback_branch"`
+	SupersededPRURL            string            `json:"superseded_pr_url"`
+	Pacing                     ratelimit.Waits   `json:"pacing"`
 }
 
 func (o Output) String() string {
-	s := "status:"
-	switch o.PullRequestCombinedStatus {
-	case "failure":
-		s += "❌"
-	case "pending":
-		s += "🕐"
-	case "success":
-		s += "✅"
-	default:
-		s += "?"
+	return o.Format(AssigneePlain, false)
+}
+
+// ToJSON serializes the output for machines, e.g. a CI pipeline's dashboard. Its snake_case keys are stable.
+func (o Output) ToJSON() ([]byte, error) {
+	return json.Marshal(outputJSON(o))
+}
+
+// Format is String, with the assignee shown as AssigneePlain or AssigneeMention.
+// PullRequestAssignee itself is always the plain login. With contexts, the status contexts which haven't succeeded,
+// except IgnoreContexts, are listed after the status, e.g. "status:❌ (❌ ci/circleci, 🕐 lint)".
+func (o Output) Format(assigneeFormat string, contexts bool) string {
+	if o.NoChanges {
+		return "no changes: " + o.NoChangesReason
+	}
+	if o.PRDisabled {
+		return "PRs disabled: " + o.PRDisabledReason
+	}
+	if o.ReadOnly {
+		return "read only: " + o.ReadOnlyReason
+	}
+	if o.ValidationFailed {
+		return fmt.Sprintf("validation %s: %s", o.ValidationConclusion, o.ValidationURL)
+	}
+	if o.OptedOut {
+		return "opted out: " + o.OptedOutReason
+	}
+	if o.DryRun {
+		return fmt.Sprintf("dry run: would push %s to %s and open %q against %s, assigned to %s", o.CommitSHA, o.PullRequestHead, o.PullRequestTitle, o.BaseBranch, o.assignees(assigneeFormat))
+	}
+
+	status := o.PullRequestEffectiveStatus
+	if status == "" {
+		status = o.PullRequestCombinedStatus
 	}
 
-	s += fmt.Sprintf("  assignee:%s %s", o.PullRequestAssignee, o.PullRequestURL)
-	if o.CircleCIBuildURL != "" {
+	s := "status:" + stateEmoji(status)
+	if unsuccessful := unsuccessfulContexts(o.Statuses, o.IgnoreContexts); contexts && unsuccessful != "" {
+		s += fmt.Sprintf(" (%s)", unsuccessful)
+	}
+
+	if o.Draft {
+		s += " 📝"
+	}
+	if o.Mergeable != nil && !*o.Mergeable {
+		s += " ⚠️ conflict"
+	}
+	s += fmt.Sprintf("  assignee:%s", o.assignees(assigneeFormat))
+	if reviewers := o.reviewers(); len(reviewers) > 0 {
+		s += fmt.Sprintf(" reviewers:%s", strings.Join(reviewers, ","))
+	}
+	if len(o.Labels) > 0 {
+		s += fmt.Sprintf(" labels:%s", strings.Join(o.Labels, ","))
+	}
+	s += " " + o.PullRequestURL
+	if o.CIBuildURL != "" {
+		s += fmt.Sprintf(" %s", o.CIBuildURL)
+	} else if o.CircleCIBuildURL != "" {
 		s += fmt.Sprintf(" %s", o.CircleCIBuildURL)
 	}
 	return s
 }
 
-// Push pushes the commit to Github and opens a pull request
-func Push(ctx context.Context, input Input, githubLimiter *time.Ticker, pushLimiter *time.Ticker) (Output, error) {
-	// Get the commit SHA from the last commit
-	cmd := Command{Path: "git", Args: []string{"log", "-1", "--pretty=format:%H"}}
-	gitLog := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-	gitLog.Dir = input.PlanDir
-	gitLogOutput, err := gitLog.CombinedOutput()
+// Formats for the assignee in Output.Format
+const (
+	// AssigneePlain shows the assignee's login as is
+	AssigneePlain = "plain"
+	// AssigneeMention shows the assignee as an @mention, which links (and notifies) them when posted to Github
+	AssigneeMention = "mention"
+)
+
+// assignees is PullRequestAssignee, formatted with AssigneePlain or AssigneeMention
+func (o Output) assignees(format string) string {
+	if format != AssigneeMention || o.PullRequestAssignee == "" {
+		return o.PullRequestAssignee
+	}
+	return strings.Join(userMentions(strings.Split(o.PullRequestAssignee, ",")), ",")
+}
+
+// reviewers are the users and teams (as "team:slug") review was requested from
+func (o Output) reviewers() []string {
+	reviewers := []string{}
+	for _, login := range o.RequestedReviewers {
+		if !containsLogin(o.FilteredReviewers, login) {
+			reviewers = append(reviewers, login)
+		}
+	}
+	for _, slug := range o.RequestedTeamReviewers {
+		if !containsLogin(o.UnknownTeamReviewers, slug) {
+			reviewers = append(reviewers, "team:"+slug)
+		}
+	}
+	return reviewers
+}
+
+// Push pushes the commit to Github and opens a pull request.
+// It's traced with Input.Tracer, with a span for each phase, under any span in ctx.
+func Push(ctx context.Context, input Input, githubLimiter ratelimit.Limiter, pushLimiter *time.Ticker) (Output, error) {
+	repo := fmt.Sprintf("%s/%s", input.RepoOwner, input.RepoName)
+	ctx, span := input.tracer().Start(ctx, "push", map[string]string{"repo": repo})
+	phases := &phaseTracer{ctx: ctx, tracer: input.tracer(), repo: repo}
+	progress := input.Progress
+	input.Progress = func(phase string) {
+		phases.start(phase)
+		if progress != nil {
+			progress(phase)
+		}
+	}
+
+	finish := func(output Output, err error) (Output, error) {
+		phases.end(err)
+		span.SetAttributes(map[string]string{"outcome": outcome(output, err), "attempts": strconv.Itoa(output.Attempts)})
+		span.End(err)
+		return output, err
+	}
+	backoff := input.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		output, err := push(ctx, input, githubLimiter, pushLimiter)
+		output.Attempts = attempt
+		if err == nil || attempt >= input.Retry.MaxAttempts || !isTransient(err) {
+			return finish(output, err)
+		}
+		input.progress(fmt.Sprintf("retrying after transient error: %s", err))
+		select {
+		case <-ctx.Done():
+			return finish(output, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// push makes a single attempt at Push. Since an existing PR is found rather than recreated, it's safe to retry.
+func push(ctx context.Context, input Input, githubLimiter ratelimit.Limiter, pushLimiter *time.Ticker) (Output, error) {
+	if input.OptOutFile != "" {
+		if reason, ok, err := optedOut(input.PlanDir, input.OptOutFile); err != nil {
+			return Output{Success: false}, err
+		} else if ok {
+			return Output{Success: true, OptedOut: true, OptedOutReason: reason}, nil
+		}
+	}
+
+	if input.SanitizeBranch {
+		input.BranchName = sanitizeBranch(input.BranchName)
+	} else if err := validateBranch(input.BranchName); err != nil {
+		return Output{Success: false}, err
+	}
+	var bodyTemplate *template.Template
+	if input.PRBodyTemplatePath != "" {
+		tmpl, err := LoadPRBodyTemplate(input.PRBodyTemplatePath)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		bodyTemplate = tmpl
+	}
+	if input.AutoMerge {
+		if err := validateMergeMethod(input.MergeMethod); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	if input.StatusSHA != "" && !isFullSHA(input.StatusSHA) {
+		return Output{Success: false}, fmt.Errorf("status SHA %q isn't a full commit SHA", input.StatusSHA)
+	}
+
+	source := "HEAD"
+	if input.SourceBranch != "" {
+		if input.SignOff || input.SquashBeforePush || input.overridesIdentity() {
+			return Output{Success: false}, errors.New("can only sign off, squash, or set the author or committer of commits on HEAD, not on a source branch")
+		}
+		if err := verifyLocalBranch(ctx, input.PlanDir, input.SourceBranch); err != nil {
+			return Output{Success: false}, err
+		}
+		source = input.SourceBranch
+	}
+
+	if input.GithubToken == "" {
+		return Output{Success: false}, errors.New("no Github token to authenticate with, see Input.GithubToken")
+	}
+
+	// A plan which made no commits on the base has nothing to push, so skip it without touching Github.
+	// When the base can only be chosen through Github, the check waits until chooseBase has asked, below.
+	base, baseKnown, err := knownBase(input)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	if baseKnown {
+		if output, ok := withoutCommits(ctx, input, base, source); ok {
+			return output, nil
+		}
+	}
+
+	// Create Github Client
+	client, err := githubclient.New(ctx, input.GithubToken, input.GithubBaseURL, input.UserAgent)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+
+	releaseAPI, err := acquire(ctx, input.APISlots)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	defer releaseAPI()
+
+	if input.SkipReadOnly {
+		input.progress("checking permission")
+		reason, ok, err := readOnly(ctx, client, input.RepoOwner, input.RepoName, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		} else if ok {
+			return Output{Success: true, ReadOnly: true, ReadOnlyReason: reason}, nil
+		}
+	}
+
+	branchRenamedFrom := ""
+	orphanedPRURL := ""
+	if input.RunID != "" || input.PlanName != "" {
+		input.progress("finding PR by marker")
+		pr, byPlan, err := findPRByMarkers(ctx, client, input, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		if pr != nil && pr.GetHead().GetRef() != input.BranchName {
+			if byPlan && input.RenamedBranch == RenamedBranchWarn {
+				orphanedPRURL = pr.GetHTMLURL()
+			} else {
+				branchRenamedFrom = input.BranchName
+				input.BranchName = pr.GetHead().GetRef()
+			}
+		}
+	}
+
+	if !baseKnown {
+		input.progress("resolving base branch")
+		if base, err = chooseBase(ctx, client, input, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+		// these lookups only read from Github, so skipping here still leaves the repo's branches and PRs alone
+		if output, ok := withoutCommits(ctx, input, base, source); ok {
+			output.BranchRenamedFrom = branchRenamedFrom
+			return output, nil
+		}
+	}
+
+	defaultBase, err := defaultBranch(ctx, client, input.RepoOwner, input.RepoName, githubLimiter)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	baseWarning := ""
+	if base != defaultBase {
+		if input.PreferDefaultBranch {
+			head := input.head()
+			if !input.DryRun {
+				if err := retargetPR(ctx, client, input.RepoOwner, input.RepoName, head, base, defaultBase, githubLimiter); err != nil {
+					return Output{Success: false}, err
+				}
+			}
+			baseWarning = fmt.Sprintf("retargeted from %s to default branch %s", base, defaultBase)
+			base = defaultBase
+		} else {
+			baseWarning = fmt.Sprintf("base %s is not the default branch %s", base, defaultBase)
+		}
+	}
+	fork := input.HeadOwner != "" && input.HeadOwner != input.RepoOwner
+	if err := validateHeadAndBase(input.BranchName, base, defaultBase, fork); err != nil {
+		return Output{Success: false}, err
+	}
+	if base != defaultBase {
+		if err := verifyBaseExists(ctx, client, input.RepoOwner, input.RepoName, base, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	releaseAPI()
+
+	if (input.FetchBase || input.SquashBeforePush) && isShallow(input.PlanDir) {
+		if err := fetchBase(ctx, input, base); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	// Skip the PR if the plan left no real diff against the base, e.g. a codemod that reformats then reverts
+	input.progress("checking diff")
+	baseRef := input.remote() + "/" + base
+	changed, err := hasDiff(ctx, input.PlanDir, baseRef, source, false)
 	if err != nil {
+		return Output{Success: false}, err
+	}
+	noChangesReason := fmt.Sprintf("no diff between %s and %s", baseRef, source)
+	if changed && input.IgnoreWhitespace {
+		changed, err = hasDiff(ctx, input.PlanDir, baseRef, source, true)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		noChangesReason = fmt.Sprintf("only whitespace changes between %s and %s", baseRef, source)
+	}
+	if !changed {
+		return Output{
+			Success:           true,
+			BaseBranch:        base,
+			BaseWarning:       baseWarning,
+			NoChanges:         true,
+			NoChangesReason:   noChangesReason,
+			BranchRenamedFrom: branchRenamedFrom,
+		}, nil
+	}
+
+	// Squashing, setting the author, and signing off rewrite the plan's commits, which a dry run leaves alone
+	if input.SquashBeforePush && !input.DryRun {
+		input.progress("squashing commits")
+		if err := squash(ctx, input.PlanDir, baseRef, input.CommitMessage, identityArgs(input.CommitterName, input.CommitterEmail)); err != nil {
+			return Output{Success: false}, fmt.Errorf("could not squash commits: %s", err)
+		}
+	}
+
+	if input.overridesIdentity() && !input.DryRun {
+		input.progress("setting author")
+		if err := setAuthor(ctx, input.PlanDir, baseRef, input); err != nil {
+			return Output{Success: false}, fmt.Errorf("could not set the commit's author: %s", err)
+		}
+	}
+
+	var flagged []string
+	if input.FileCheck.enabled() {
+		input.progress("checking files")
+		flagged, err = flaggedFiles(ctx, input.PlanDir, baseRef, source, input.FileCheck)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		if len(flagged) > 0 && input.FileCheck.Strict {
+			return Output{Success: false, FlaggedFiles: flagged}, fmt.Errorf("refusing to push binary or large files: %s", strings.Join(flagged, ", "))
+		}
+	}
+
+	if input.SignOff && !input.DryRun {
+		if err := signOff(ctx, input.PlanDir, identityArgs(input.CommitterName, input.CommitterEmail)); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	// Get the commit SHA from the last commit
+	input.progress("reading commit")
+	cmd := Command{Path: "git", Args: []string{"log", "-1", "--pretty=format:%H", source}}
+	gitLogOutput, err := runGit(ctx, input, cmd)
+	if err == errGitTimeout {
+		return Output{Success: false}, fmt.Errorf("git log timed out after %s for %s/%s", input.GitTimeout, input.RepoOwner, input.RepoName)
+	} else if err != nil {
 		return Output{Success: false}, errors.New(string(gitLogOutput))
 	}
 
-	// Push the commit
-	gitHeadBranch := fmt.Sprintf("HEAD:%s", input.BranchName)
-	cmd = Command{Path: "git", Args: []string{"push", "-f", "origin", gitHeadBranch}}
-	gitPush := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-	gitPush.Dir = input.PlanDir
-	if output, err := gitPush.CombinedOutput(); err != nil {
-		return Output{Success: false}, errors.New(string(output))
+	diffBase := input.DiffBase
+	if diffBase == "" {
+		diffBase = baseRef
+	}
+	diffBaseRef, err := ensureRef(ctx, input, diffBase)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	diffSummary, err := diffShortstat(ctx, input.PlanDir, diffBaseRef, source)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	var changedFiles []string
+	if input.ChangedFiles == ChangedFilesLocal {
+		changedFiles, err = localChangedFiles(ctx, input.PlanDir, diffBaseRef, source)
+		if err != nil {
+			return Output{Success: false}, err
+		}
 	}
 
-	// Create Github Client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_API_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	releaseAPI, err = acquire(ctx, input.APISlots)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	defer releaseAPI()
+	sharedBranchPRURL := ""
+	if input.StrictMarkers {
+		input.progress("checking PR markers")
+		if sharedBranchPRURL, err = isolateBranch(ctx, client, &input, base, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
 
 	// Open a pull request, if one doesn't exist already
-	head := fmt.Sprintf("%s:%s", input.RepoOwner, input.BranchName)
-	base := "master"
+	head := input.head()
+
+	var unchangedPR *github.PullRequest
+	unchanged := false
+	if input.ConfigHash != "" && input.SkipUnchangedConfig {
+		input.progress("comparing config hash")
+		unchangedPR, err = findUnchangedPR(ctx, client, input.RepoOwner, input.RepoName, head, base, input.ConfigHash, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	// fallback is set when pushing to the fallback branch instead, and supersededHead is then the protected PR head
+	fallback := ""
+	supersededHead := ""
+	if unchangedPR == nil && !input.DryRun && input.ForcePush && input.ForcePushFallback {
+		exists, err := branchExists(ctx, client, input.headOwner(), input.RepoName, fallbackBranch(input.BranchName), githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		// a previous run fell back already, so pushing to the protected branch would only be rejected again
+		if exists {
+			supersededHead = head
+			fallback = fallbackBranch(input.BranchName)
+			input.BranchName = fallback
+			head = input.head()
+		}
+	}
+	releaseAPI()
+
+	// lockBranch locks the branch about to be pushed to, until the push is done, see Input.LockTTL
+	var locks []*branchLock
+	lockBranch := func() error {
+		if input.LockTTL <= 0 {
+			return nil
+		}
+		input.progress("locking branch")
+		releaseAPI, err := acquire(ctx, input.APISlots)
+		if err != nil {
+			return err
+		}
+		defer releaseAPI()
+		lock, err := acquireLock(ctx, client, input.headOwner(), input.RepoName, input.BranchName, input.PlanDir, baseRef, input.LockTTL, githubLimiter)
+		if err != nil {
+			return err
+		}
+		locks = append(locks, lock)
+		return nil
+	}
+	defer func() {
+		for _, lock := range locks {
+			if err := lock.release(ctx); err != nil {
+				// the lock goes stale after LockTTL, so the next push isn't blocked for long
+				log.Printf("could not release lock %s in %s/%s, it goes stale in %s: %s", lock.ref, lock.owner, lock.name, input.LockTTL, err)
+			}
+		}
+	}()
+
+	if unchangedPR == nil && !input.DryRun {
+		if err := lockBranch(); err != nil {
+			return Output{Success: false}, err
+		}
+
+		// Push the commit
+		input.progress("pushing branch")
+		release, err := acquire(ctx, input.GitSlots)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		output, err := runGit(ctx, input, pushCommand(input, source, input.BranchName))
+		release()
+		if err != nil && err != errGitTimeout && fallback == "" && input.ForcePush && input.ForcePushFallback && forcePushProtected(string(output)) {
+			supersededHead = head
+			fallback = fallbackBranch(input.BranchName)
+			input.BranchName = fallback
+			head = input.head()
+			if err := lockBranch(); err != nil {
+				return Output{Success: false}, err
+			}
+			input.progress("pushing fallback branch")
+			if release, err = acquire(ctx, input.GitSlots); err != nil {
+				return Output{Success: false}, err
+			}
+			output, err = runGit(ctx, input, pushCommand(input, source, input.BranchName))
+			release()
+		}
+		if err == errGitTimeout {
+			return Output{Success: false}, fmt.Errorf("git push timed out after %s for %s/%s, maybe it's waiting on credentials or a stuck connection", input.GitTimeout, input.RepoOwner, input.RepoName)
+		} else if err != nil {
+			if reason, ok := pushDenied(string(output)); ok && input.SkipReadOnly {
+				return Output{Success: true, BaseBranch: base, ReadOnly: true, ReadOnlyReason: reason, BranchRenamedFrom: branchRenamedFrom}, nil
+			}
+			if !input.ForcePush && nonFastForward(string(output)) {
+				return Output{Success: false}, fmt.Errorf("branch %s has diverged: it has commits which aren't in the plan, maybe someone else pushed to it. Pull them into the plan, or push with force", input.BranchName)
+			}
+			return Output{Success: false}, errors.New(string(output))
+		}
+		unchanged = upToDate(string(output))
+	}
 
 	// Determine PR title and body
 	// Title is first line of commit message.
-	// Body is given by body-file if it exists or is the remainder of the commit message after title.
-	title := input.CommitMessage
-	body := ""
-	splitMsg := strings.SplitN(input.CommitMessage, "\n", 2)
-	if len(splitMsg) == 2 {
-		title = splitMsg[0]
-		if input.PRBody == "" {
-			body = splitMsg[1]
+	// Body is the rendered body template, or given by body-file if it exists, or is the remainder of the commit message after title.
+	prBody := input.PRBody
+	if bodyTemplate != nil {
+		prBody, err = renderPRBody(bodyTemplate, PRBodyData{
+			RepoName:   input.RepoName,
+			RepoOwner:  input.RepoOwner,
+			BranchName: input.BranchName,
+			CommitSHA:  strings.TrimSpace(string(gitLogOutput)),
+		})
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	title, body := titleAndBody(input.CommitMessage, prBody, input.MaxTitleLength)
+	updateTitle, updateBody := title, body
+	if input.UpdateTitle != "" {
+		updateTitle = input.UpdateTitle
+	}
+	if input.UpdateBody != "" {
+		updateBody = input.UpdateBody
+	}
+	if input.RunID != "" {
+		body = withRunIDMarker(body, input.RunID)
+		updateBody = withRunIDMarker(updateBody, input.RunID)
+	}
+	if input.PlanName != "" {
+		body = withMarker(body, planMarker(input.PlanName))
+		updateBody = withMarker(updateBody, planMarker(input.PlanName))
+	}
+	if input.ConfigHash != "" {
+		body = withMarker(body, configHashMarker(input.ConfigHash))
+		updateBody = withMarker(updateBody, configHashMarker(input.ConfigHash))
+	}
+	if input.BodyFooterTemplate != "" {
+		data := FooterData{
+			Org:       input.RepoOwner,
+			Repo:      input.RepoName,
+			RunID:     input.RunID,
+			Version:   input.Version,
+			Timestamp: time.Now(),
+			DocsURL:   DocsURL,
+		}
+		if body, err = withFooter(body, input.BodyFooterTemplate, input.BodyFooterHidden, data); err != nil {
+			return Output{Success: false}, err
+		}
+		if updateBody, err = withFooter(updateBody, input.BodyFooterTemplate, input.BodyFooterHidden, data); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	if input.DryRun {
+		return Output{
+			Success:             true,
+			DryRun:              true,
+			CommitSHA:           strings.TrimSpace(string(gitLogOutput)),
+			PullRequestHead:     head,
+			PullRequestTitle:    title,
+			PullRequestBody:     body,
+			PullRequestAssignee: strings.Join(input.assignees(), ","),
+			RequestedReviewers:  input.Reviewers,
+			Labels:              input.Labels,
+			Milestone:           input.Milestone,
+			Draft:               input.Draft,
+			BaseBranch:          base,
+			BaseWarning:         baseWarning,
+			DiffSummary:         diffSummary,
+			DiffBase:            diffBase,
+			ChangedFiles:        changedFiles,
+			FlaggedFiles:        flagged,
+			BranchRenamedFrom:   branchRenamedFrom,
+			OrphanedPRURL:       orphanedPRURL,
+			SharedBranchPRURL:   sharedBranchPRURL,
+			FallbackBranch:      fallback,
+			ConfigHash:          input.ConfigHash,
+			ConfigUnchanged:     unchangedPR != nil,
+		}, nil
+	}
+
+	pr := unchangedPR
+	if pr == nil && unchanged && input.SkipUpToDate {
+		// nothing was pushed, so an open PR is already up to date
+		pr, err = findOpenPR(ctx, client, input.RepoOwner, input.RepoName, head, base, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
 		}
 	}
-	pr, err := findOrCreatePR(ctx, client, input.RepoOwner, input.RepoName, &github.NewPullRequest{
-		Title: &title,
-		Body:  &body,
-		Head:  &head,
-		Base:  &base,
-	}, githubLimiter, pushLimiter)
+	validationURL := ""
+	if pr == nil && input.Validate.Workflow != "" {
+		input.progress("validating")
+		sha := strings.TrimSpace(string(gitLogOutput))
+		conclusion, runURL, err := validate(ctx, client, input.headOwner(), input.RepoName, input.BranchName, sha, input.Validate, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		validationURL = runURL
+		if conclusion != "success" {
+			return Output{
+				Success:              true,
+				CommitSHA:            sha,
+				BaseBranch:           base,
+				BaseWarning:          baseWarning,
+				DiffSummary:          diffSummary,
+				DiffBase:             diffBase,
+				ValidationFailed:     true,
+				ValidationConclusion: conclusion,
+				ValidationURL:        runURL,
+				BranchRenamedFrom:    branchRenamedFrom,
+			}, nil
+		}
+	}
+	releaseAPI, err = acquire(ctx, input.APISlots)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	defer releaseAPI()
+	if pr == nil {
+		input.progress("opening PR")
+		pr, err = findOrCreatePR(ctx, client, input.RepoOwner, input.RepoName, &github.NewPullRequest{
+			Title: &title,
+			Body:  &body,
+			Head:  &head,
+			Base:  &base,
+		}, input.Draft, &updateTitle, &updateBody, input.APIRetry, githubLimiter, pushLimiter)
+	}
+	invalidBodyError := ""
+	if details, ok := prInvalid(err); ok {
+		if !input.RetryWithMinimalBody {
+			return Output{Success: false}, fmt.Errorf("%s/%s rejected the PR as invalid: %s", input.RepoOwner, input.RepoName, details)
+		}
+		invalidBodyError = details
+		input.progress("opening PR with a minimal body")
+		minimal := minimalBody(title, body)
+		pr, err = findOrCreatePR(ctx, client, input.RepoOwner, input.RepoName, &github.NewPullRequest{
+			Title: &title,
+			Body:  &minimal,
+			Head:  &head,
+			Base:  &base,
+		}, input.Draft, &updateTitle, &minimal, input.APIRetry, githubLimiter, pushLimiter)
+		if details, ok := prInvalid(err); ok {
+			return Output{Success: false}, fmt.Errorf("%s/%s rejected the PR as invalid, even with a minimal body: %s", input.RepoOwner, input.RepoName, details)
+		}
+	}
+	if reason, ok := prDisabled(err); ok && input.SkipPRDisabled {
+		return Output{
+			Success:           true,
+			BaseBranch:        base,
+			BaseWarning:       baseWarning,
+			DiffSummary:       diffSummary,
+			DiffBase:          diffBase,
+			PRDisabled:        true,
+			PRDisabledReason:  reason,
+			BranchRenamedFrom: branchRenamedFrom,
+		}, nil
+	}
+	if reason, ok := writeForbidden(err); ok && input.SkipReadOnly {
+		return Output{
+			Success:           true,
+			BaseBranch:        base,
+			BaseWarning:       baseWarning,
+			DiffSummary:       diffSummary,
+			DiffBase:          diffBase,
+			ReadOnly:          true,
+			ReadOnlyReason:    reason,
+			BranchRenamedFrom: branchRenamedFrom,
+		}, nil
+	}
 	if err != nil {
 		return Output{Success: false}, err
 	}
 
-	if pr.Assignee == nil || pr.Assignee.Login == nil || *pr.Assignee.Login != input.PRAssignee {
-		<-githubLimiter.C
-		_, _, err := client.Issues.AddAssignees(ctx, input.RepoOwner, input.RepoName, *pr.Number, []string{input.PRAssignee})
+	assignees := input.assignees()
+	primary := assignees
+	assigneeWarning := ""
+	if input.AssignToCommitter {
+		input.progress("finding committer")
+		committer, err := committerOf(ctx, client, input, base, source, pr.GetUser().GetLogin(), githubLimiter)
+		if err != nil {
+			assigneeWarning = fmt.Sprintf("could not find a committer to assign: %s", err)
+		} else {
+			primary = []string{committer}
+		}
+	}
+
+	current := logins(pr.Assignees)
+	applied := primary
+	// A new PR has no assignee yet, so this is only a handoff of an existing PR
+	if len(input.HandoffMentions) > 0 && len(current) > 0 && len(primary) > 0 && !containsAll(current, primary) {
+		input.progress("handing off PR")
+		body := handoffComment(input.HandoffMentions, withoutLogins(current, primary), primary)
+		if err := postHandoff(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, body, input.APIRetry, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+		applied = current
+	} else if len(primary) == 0 || !containsAll(current, primary) {
+		input.progress("assigning PR")
+		applied, err = assign(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, current, [][]string{primary, assignees, {input.FallbackAssignee}}, input.APIRetry, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		if len(applied) == 0 {
+			if candidates := uniqueLogins(append(append(primary, assignees...), input.FallbackAssignee)...); len(candidates) > 0 {
+				assigneeWarning = fmt.Sprintf("could not assign %s", strings.Join(candidates, " or "))
+			}
+			if input.StrictAssignee {
+				return Output{Success: false}, errors.New(assigneeWarning)
+			}
+		} else if missing := withoutLogins(primary, applied); len(missing) > 0 {
+			assigneeWarning = fmt.Sprintf("could not assign %s, assigned %s", strings.Join(missing, ", "), strings.Join(applied, ", "))
+		}
+	}
+
+	var reviewers reviewerResult
+	if len(input.Reviewers) > 0 || len(input.TeamReviewers) > 0 ||
+		(input.ReconcileReviewers && (len(input.PreviousReviewers) > 0 || len(input.PreviousTeamReviewers) > 0)) {
+		input.progress("requesting reviewers")
+		reviewers, err = requestReviewers(ctx, client, input, pr, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	teamMention := ""
+	if len(input.MentionTeams) > 0 {
+		input.progress("mentioning teams")
+		mentionTemplate := input.MentionTemplate
+		if mentionTemplate == "" {
+			mentionTemplate = DefaultMentionTemplate
+		}
+		body, err := mentionComment(mentionTemplate, MentionData{
+			Teams:    teamMentions(input.RepoOwner, input.MentionTeams),
+			Org:      input.RepoOwner,
+			Repo:     input.RepoName,
+			PRNumber: *pr.Number,
+		})
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		teamMention, err = mentionTeams(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, body, input.APIRetry, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	workflowDispatched := false
+	if input.Dispatch.Workflow != "" {
+		input.progress("dispatching workflow")
+		if err := dispatchWorkflow(ctx, client, input.headOwner(), input.RepoName, input.BranchName, *pr.Number, input.Dispatch, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+		workflowDispatched = true
+	}
+
+	// An existing PR's draft state isn't changed, it may have been marked ready by hand
+	draft := false
+	if input.Draft {
+		draft, err = isDraft(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if len(input.Labels) > 0 {
+		input.progress("labeling PR")
+		if err := addLabels(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, input.Labels, input.APIRetry, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if input.Milestone != "" {
+		input.progress("setting milestone")
+		if err := setMilestone(ctx, client, input.RepoOwner, input.RepoName, pr, input.Milestone, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if input.LockConversation {
+		input.progress("locking conversation")
+		if err := lockConversation(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, input.LockReason, githubLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	autoMerge := false
+	autoMergeWarning := ""
+	if input.AutoMerge {
+		input.progress("enabling auto-merge")
+		err := enableAutoMerge(ctx, client, input.RepoOwner, input.RepoName, pr, input.MergeMethod, githubLimiter)
+		if err == errAlreadyMergeable {
+			autoMergeWarning = err.Error()
+		} else if err != nil {
+			return Output{Success: false}, err
+		} else {
+			autoMerge = true
+		}
+	}
+
+	if input.ChangedFiles == ChangedFilesAPI {
+		input.progress("listing changed files")
+		changedFiles, err = prChangedFiles(ctx, client, input.RepoOwner, input.RepoName, *pr.Number, githubLimiter)
 		if err != nil {
 			return Output{Success: false}, err
 		}
 	}
 
-	<-githubLimiter.C
-	cs, _, err := client.Repositories.GetCombinedStatus(ctx, input.RepoOwner, input.RepoName, *pr.Head.SHA, nil)
+	supersededPRURL := ""
+	if supersededHead != "" {
+		superseded, err := findOpenPR(ctx, client, input.RepoOwner, input.RepoName, supersededHead, base, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		supersededPRURL = superseded.GetHTMLURL()
+	}
+	releaseAPI()
+
+	input.progress("checking mergeability")
+	mergeable, mergeableState, err := mergeability(ctx, client, input.RepoOwner, input.RepoName, pr, input.MergeablePolls, input.MergeablePollInterval, githubLimiter)
 	if err != nil {
 		return Output{Success: false}, err
 	}
 
-	var circleCIBuildURL string
-	for _, status := range cs.Statuses {
-		if status.Context != nil && *status.Context == "ci/circleci" && status.TargetURL != nil {
-			circleCIBuildURL = *status.TargetURL
-			// url has lots of ugly tracking query params, get rid of them
-			if parsedURL, err := url.Parse(circleCIBuildURL); err == nil {
-				query := parsedURL.Query()
-				query.Del("utm_campaign")
-				query.Del("utm_medium")
-				query.Del("utm_source")
-				parsedURL.RawQuery = query.Encode()
-				circleCIBuildURL = parsedURL.String()
-			}
+	input.progress("checking status")
+	statusSHA := pr.GetHead().GetSHA()
+	if input.StatusSHA != "" {
+		statusSHA = input.StatusSHA
+	}
+	var cs *github.CombinedStatus
+	err = retryAPI(ctx, input.APIRetry, githubLimiter, opGetStatus, func() (resp *github.Response, err error) {
+		cs, resp, err = client.Repositories.GetCombinedStatus(ctx, input.RepoOwner, input.RepoName, statusSHA, nil)
+		return resp, err
+	})
+	if err != nil {
+		return Output{Success: false}, err
+	}
+
+	states := contextStates(cs.Statuses)
+	combined := cs.GetState()
+	var runs []checkRun
+	if input.CheckRuns {
+		runs, err = listCheckRuns(ctx, client, input.RepoOwner, input.RepoName, statusSHA, githubLimiter)
+		if err != nil {
+			return Output{Success: false}, err
 		}
+		states = withCheckRuns(states, runs)
+		combined = AggregateStatus(states, nil, StatusAggregationGithub)
+	}
+	if input.StatusAggregation == StatusAggregationStrict || input.StatusAggregation == StatusAggregationLenient {
+		combined = AggregateStatus(states, nil, input.StatusAggregation)
+	}
+	ciContext := input.CIContext
+	if ciContext == "" {
+		ciContext = DefaultCIContext
 	}
 
 	return Output{
-		Success:                   true,
-		CommitSHA:                 *pr.Head.SHA,
-		PullRequestNumber:         *pr.Number,
-		PullRequestURL:            *pr.HTMLURL,
-		PullRequestCombinedStatus: *cs.State,
-		PullRequestAssignee:       input.PRAssignee,
-		CircleCIBuildURL:          circleCIBuildURL,
+		Success:                    true,
+		CommitSHA:                  *pr.Head.SHA,
+		StatusSHA:                  statusSHA,
+		PullRequestNumber:          *pr.Number,
+		PullRequestURL:             *pr.HTMLURL,
+		PullRequestCombinedStatus:  combined,
+		PullRequestEffectiveStatus: AggregateStatus(states, input.IgnoreContexts, input.StatusAggregation),
+		StatusAggregation:          input.StatusAggregation,
+		IgnoreContexts:             input.IgnoreContexts,
+		CheckRuns:                  input.CheckRuns,
+		PullRequestContextStatuses: states,
+		Statuses:                   statusDetails(cs.Statuses, input.BuildURLHosts),
+		PullRequestAssignee:        strings.Join(applied, ","),
+		AssigneeWarning:            assigneeWarning,
+		CircleCIBuildURL:           circleCIBuildURL(cs.Statuses, input.BuildURLHosts),
+		CIBuildURL:                 ciBuildURL(cs.Statuses, runs, ciContext, input.BuildURLHosts),
+		BaseBranch:                 base,
+		BaseWarning:                baseWarning,
+		DiffSummary:                diffSummary,
+		DiffBase:                   diffBase,
+		WorkflowDispatched:         workflowDispatched,
+		ValidationURL:              validationURL,
+		RequestedReviewers:         input.Reviewers,
+		FilteredReviewers:          reviewers.filtered,
+		ReviewerWarning:            reviewers.warning,
+		RequestedTeamReviewers:     input.TeamReviewers,
+		UnknownTeamReviewers:       reviewers.unknownTeams,
+		FlaggedFiles:               flagged,
+		Labels:                     input.Labels,
+		Milestone:                  input.Milestone,
+		Draft:                      draft,
+		InvalidBodyError:           invalidBodyError,
+		Mergeable:                  mergeable,
+		MergeableState:             mergeableState,
+		ChangedFiles:               changedFiles,
+		ConversationLocked:         input.LockConversation,
+		TeamMention:                teamMention,
+		AutoMerge:                  autoMerge,
+		AutoMergeWarning:           autoMergeWarning,
+		BranchRenamedFrom:          branchRenamedFrom,
+		OrphanedPRURL:              orphanedPRURL,
+		SharedBranchPRURL:          sharedBranchPRURL,
+		FallbackBranch:             fallback,
+		SupersededPRURL:            supersededPRURL,
+		ConfigHash:                 input.ConfigHash,
+		ConfigUnchanged:            unchangedPR != nil,
+		Unchanged:                  unchanged,
 	}, nil
 }
 
-func findOrCreatePR(ctx context.Context, client *github.Client, owner string, name string, pull *github.NewPullRequest, githubLimiter *time.Ticker, pushLimiter *time.Ticker) (*github.PullRequest, error) {
+// titleAndBody derives the PR title from the commit message, and the body from prBody or else the rest of the commit message
+func titleAndBody(commitMessage string, prBody string, maxTitleLength int) (string, string) {
+	title := commitMessage
+	body := prBody
+	splitMsg := strings.SplitN(commitMessage, "\n", 2)
+	if len(splitMsg) == 2 {
+		title = splitMsg[0]
+		if prBody == "" {
+			body = splitMsg[1]
+		}
+	}
+
+	if runes := []rune(title); maxTitleLength > 0 && len(runes) > maxTitleLength {
+		cut := maxTitleLength - 1
+		if cut < 0 {
+			cut = 0
+		}
+		title = strings.TrimRight(string(runes[:cut]), " ") + "…"
+		overflow := "…" + strings.TrimLeft(string(runes[cut:]), " ")
+		if body == "" {
+			body = overflow
+		} else {
+			body = overflow + "\n\n" + body
+		}
+	}
+	return title, body
+}
+
+// openPR picks the one open PR from head's existing PRs. An old closed PR for the same head and base is ignored.
+func openPR(prs []*github.PullRequest, head string) (*github.PullRequest, error) {
+	open := []*github.PullRequest{}
+	urls := []string{}
+	for _, pr := range prs {
+		urls = append(urls, pr.GetHTMLURL())
+		if pr.GetState() == "open" {
+			open = append(open, pr)
+		}
+	}
+	switch len(open) {
+	case 1:
+		return open[0], nil
+	case 0:
+		if len(prs) == 0 {
+			return nil, fmt.Errorf("found no PR for branch %s", head)
+		}
+		return nil, fmt.Errorf("found no open PR for branch %s, only: %s", head, strings.Join(urls, ", "))
+	default:
+		urls = []string{}
+		for _, pr := range open {
+			urls = append(urls, pr.GetHTMLURL())
+		}
+		return nil, fmt.Errorf("found %d open PRs for branch %s: %s", len(open), head, strings.Join(urls, ", "))
+	}
+}
+
+// findOrCreatePR opens the PR, or if it already exists updates it to updateTitle and updateBody
+func findOrCreatePR(ctx context.Context, client *github.Client, owner string, name string, pull *github.NewPullRequest, draft bool, updateTitle *string, updateBody *string, retry RetryPolicy, githubLimiter ratelimit.Limiter, pushLimiter *time.Ticker) (*github.PullRequest, error) {
 	var pr *github.PullRequest
 	<-pushLimiter.C
-	<-githubLimiter.C
-	newPR, _, err := client.PullRequests.Create(ctx, owner, name, pull)
+	var newPR *github.PullRequest
+	err := retryAPI(ctx, retry, githubLimiter, opCreatePR, func() (resp *github.Response, err error) {
+		newPR, resp, err = createPR(ctx, client, owner, name, pull, draft)
+		return resp, err
+	})
 	if err != nil && strings.Contains(err.Error(), "pull request already exists") {
-		<-githubLimiter.C
-		existingPRs, _, err := client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
-			Head: *pull.Head,
-			Base: *pull.Base,
+		var existingPRs []*github.PullRequest
+		err := retryAPI(ctx, retry, githubLimiter, opListPRs, func() (resp *github.Response, err error) {
+			existingPRs, resp, err = client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
+				Head: *pull.Head,
+				Base: *pull.Base,
+			})
+			return resp, err
 		})
 		if err != nil {
 			return nil, err
-		} else if len(existingPRs) != 1 {
-			return nil, errors.New("unexpected: found more than 1 PR for branch")
 		}
-		pr = existingPRs[0]
+		pr, err = openPR(existingPRs, *pull.Head)
+		if err != nil {
+			return nil, err
+		}
 
 		// If needed, update PR title and body
-		if different(pr.Title, pull.Title) || different(pr.Body, pull.Body) {
-			pr.Title = pull.Title
-			pr.Body = pull.Body
-			<-githubLimiter.C
-			pr, _, err = client.PullRequests.Edit(ctx, owner, name, *pr.Number, pr)
+		if different(pr.Title, updateTitle) || different(bodyWithoutFooter(pr.Body), bodyWithoutFooter(updateBody)) {
+			pr.Title = updateTitle
+			pr.Body = updateBody
+			edit := pr
+			err = retryAPI(ctx, retry, githubLimiter, opEditPR, func() (resp *github.Response, err error) {
+				pr, resp, err = client.PullRequests.Edit(ctx, owner, name, *edit.Number, edit)
+				return resp, err
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -205,6 +1469,472 @@ func findOrCreatePR(ctx context.Context, client *github.Client, owner string, na
 	return pr, nil
 }
 
+// resolvedBases caches the base branch chosen for each repo, keyed by "owner/name"
+var resolvedBases = struct {
+	sync.Mutex
+	m map[string]string
+}{m: map[string]string{}}
+
+// chooseBase picks the PR's base branch with Input.BaseResolver, Input.BaseFromTopics, or Input.BaseBranches, in that order
+func chooseBase(ctx context.Context, client *github.Client, input Input, githubLimiter ratelimit.Limiter) (string, error) {
+	if base, ok, err := knownBase(input); err != nil || ok {
+		return base, err
+	}
+	if input.BaseFromTopics {
+		return baseFromTopics(ctx, client, input.RepoOwner, input.RepoName, githubLimiter)
+	}
+	return resolveBase(ctx, client, input.RepoOwner, input.RepoName, input.BaseBranches, githubLimiter)
+}
+
+// knownBase is chooseBase for when the base branch can be chosen without asking Github: by Input.BaseResolver,
+// or by Input.BaseBranches naming at most one branch
+func knownBase(input Input) (string, bool, error) {
+	if input.BaseResolver != nil {
+		base, err := input.BaseResolver(fmt.Sprintf("%s/%s", input.RepoOwner, input.RepoName))
+		if err != nil {
+			return "", false, fmt.Errorf("could not resolve base branch: %s", err)
+		}
+		if base != "" {
+			return base, true, nil
+		}
+	}
+	if input.BaseFromTopics {
+		return "", false, nil
+	}
+	switch len(input.BaseBranches) {
+	case 0:
+		return "master", true, nil
+	case 1:
+		return input.BaseBranches[0], true, nil
+	}
+	return "", false, nil
+}
+
+// resolveBase returns the first of the candidate branches that exists in the repo
+func resolveBase(ctx context.Context, client *github.Client, owner string, name string, candidates []string, githubLimiter ratelimit.Limiter) (string, error) {
+	if len(candidates) == 0 {
+		return "master", nil
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+
+	key := fmt.Sprintf("%s/%s", owner, name)
+	resolvedBases.Lock()
+	base, ok := resolvedBases.m[key]
+	resolvedBases.Unlock()
+	if ok {
+		return base, nil
+	}
+
+	for _, candidate := range candidates {
+		githubLimiter.Wait()
+		_, resp, err := client.Git.GetRef(ctx, owner, name, "heads/"+candidate)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return "", err
+		}
+		resolvedBases.Lock()
+		resolvedBases.m[key] = candidate
+		resolvedBases.Unlock()
+		return candidate, nil
+	}
+	return "", fmt.Errorf("none of the base branches exist: %s", strings.Join(candidates, ", "))
+}
+
+// fetchBaseDepth bounds how much of the base branch's history is fetched into a shallow clone
+const fetchBaseDepth = 50
+
+// isShallow reports whether the repo in dir is a shallow clone
+func isShallow(dir string) bool {
+	_, err := os.Stat(path.Join(dir, ".git", "shallow"))
+	return err == nil
+}
+
+// fetchBase fetches the base branch into the remote's remote-tracking branch
+func fetchBase(ctx context.Context, input Input, base string) error {
+	remote := input.remote()
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/%s/%s", base, remote, base)
+	output, err := runGit(ctx, input, Command{Path: "git", Args: []string{"fetch", fmt.Sprintf("--depth=%d", fetchBaseDepth), remote, refspec}})
+	if err == errGitTimeout {
+		return fmt.Errorf("git fetch of base branch %s timed out after %s for %s/%s, maybe it's waiting on credentials or a stuck connection", base, input.GitTimeout, input.RepoOwner, input.RepoName)
+	} else if err != nil {
+		return fmt.Errorf("could not fetch base branch %s into shallow clone: %s", base, string(output))
+	}
+	return nil
+}
+
+// baseTopicPrefix marks a repo topic which declares the repo's base branch, e.g. "mp-base-develop"
+const baseTopicPrefix = "mp-base-"
+
+// repoTopics caches each repo's topics, keyed by "owner/name"
+var repoTopics = struct {
+	sync.Mutex
+	m map[string][]string
+}{m: map[string][]string{}}
+
+// baseFromTopics returns the branch declared by the repo's "mp-base-<branch>" topic, or else its default branch
+func baseFromTopics(ctx context.Context, client *github.Client, owner string, name string, githubLimiter ratelimit.Limiter) (string, error) {
+	key := fmt.Sprintf("%s/%s", owner, name)
+	repoTopics.Lock()
+	topics, ok := repoTopics.m[key]
+	repoTopics.Unlock()
+	if !ok {
+		githubLimiter.Wait()
+		var resp *github.Response
+		var err error
+		topics, resp, err = client.Repositories.ListAllTopics(ctx, owner, name)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return "", err
+		}
+		repoTopics.Lock()
+		repoTopics.m[key] = topics
+		repoTopics.Unlock()
+	}
+
+	for _, topic := range topics {
+		if strings.HasPrefix(topic, baseTopicPrefix) && len(topic) > len(baseTopicPrefix) {
+			return strings.TrimPrefix(topic, baseTopicPrefix), nil
+		}
+	}
+
+	return defaultBranch(ctx, client, owner, name, githubLimiter)
+}
+
+// defaultBranches caches each repo's default branch, keyed by "owner/name"
+var defaultBranches = struct {
+	sync.Mutex
+	m map[string]string
+}{m: map[string]string{}}
+
+// defaultBranch returns the repo's default branch
+func defaultBranch(ctx context.Context, client *github.Client, owner string, name string, githubLimiter ratelimit.Limiter) (string, error) {
+	key := fmt.Sprintf("%s/%s", owner, name)
+	defaultBranches.Lock()
+	branch, ok := defaultBranches.m[key]
+	defaultBranches.Unlock()
+	if ok {
+		return branch, nil
+	}
+
+	githubLimiter.Wait()
+	repo, resp, err := client.Repositories.Get(ctx, owner, name)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return "", err
+	}
+	rememberDefaultBranch(owner, name, repo)
+	return repo.GetDefaultBranch(), nil
+}
+
+// rememberDefaultBranch caches the default branch of a repo read for another reason, so defaultBranch needn't read it again
+func rememberDefaultBranch(owner string, name string, repo *github.Repository) {
+	if repo.GetDefaultBranch() == "" {
+		return
+	}
+	defaultBranches.Lock()
+	defaultBranches.m[fmt.Sprintf("%s/%s", owner, name)] = repo.GetDefaultBranch()
+	defaultBranches.Unlock()
+}
+
+// retargetPR changes the base of the open PR for head, if there is one, so it's found rather than duplicated
+func retargetPR(ctx context.Context, client *github.Client, owner string, name string, head string, from string, to string, githubLimiter ratelimit.Limiter) error {
+	githubLimiter.Wait()
+	existingPRs, resp, err := client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
+		Head: head,
+		Base: from,
+	})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	for _, pr := range existingPRs {
+		githubLimiter.Wait()
+		_, resp, err := client.PullRequests.Edit(ctx, owner, name, pr.GetNumber(), &github.PullRequest{
+			Base: &github.PullRequestBranch{Ref: &to},
+		})
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signOff amends the last commit with a Signed-off-by trailer, unless it already has one for the git user.
+// identity overrides the git user, see identityArgs.
+func signOff(ctx context.Context, dir string, identity []string) error {
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", append(identity, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", errors.New(string(output))
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	name, err := git("config", "user.name")
+	if err != nil {
+		return fmt.Errorf("could not sign off, git user.name is not set: %s", err)
+	}
+	email, err := git("config", "user.email")
+	if err != nil {
+		return fmt.Errorf("could not sign off, git user.email is not set: %s", err)
+	}
+	trailer := fmt.Sprintf("Signed-off-by: %s <%s>", name, email)
+
+	hasTrailer := func() (bool, error) {
+		message, err := git("log", "-1", "--pretty=format:%B")
+		if err != nil {
+			return false, err
+		}
+		for _, line := range strings.Split(message, "\n") {
+			if strings.TrimSpace(line) == trailer {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if signed, err := hasTrailer(); err != nil || signed {
+		return err
+	}
+	if _, err := git("commit", "--amend", "--no-edit", "--signoff"); err != nil {
+		return err
+	}
+	if signed, err := hasTrailer(); err != nil {
+		return err
+	} else if !signed {
+		return fmt.Errorf("commit is missing trailer after sign off: %s", trailer)
+	}
+	return nil
+}
+
+// optedOut checks whether the repo has the opt-out file. The reason is its first line, if any.
+func optedOut(dir string, file string) (string, bool, error) {
+	bs, err := ioutil.ReadFile(path.Join(dir, file))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	reason := strings.TrimSpace(strings.SplitN(string(bs), "\n", 2)[0])
+	if reason == "" {
+		return fmt.Sprintf("has %s", file), true, nil
+	}
+	return fmt.Sprintf("has %s: %s", file, reason), true, nil
+}
+
+// upToDate checks `git push` output for whether the remote branch already matched
+func upToDate(pushOutput string) bool {
+	return strings.Contains(pushOutput, "Everything up-to-date")
+}
+
+// pushCommand pushes source to the remote's branch
+func pushCommand(input Input, source string, branch string) Command {
+	return Command{Path: "git", Args: pushArgs(input.ForcePush, input.remote(), fmt.Sprintf("%s:%s", source, branch))}
+}
+
+// pushArgs are the args to `git push` source:branch to the remote
+func pushArgs(force bool, remote string, refspec string) []string {
+	if force {
+		return []string{"push", "-f", remote, refspec}
+	}
+	return []string{"push", remote, refspec}
+}
+
+// nonFastForward checks whether `git push` was rejected because the remote branch has commits the push doesn't
+func nonFastForward(pushOutput string) bool {
+	return strings.Contains(pushOutput, "non-fast-forward") || strings.Contains(pushOutput, "[rejected]")
+}
+
+// verifyLocalBranch checks that the branch exists in the local repo
+func verifyLocalBranch(ctx context.Context, dir string, branch string) error {
+	gitRevParse := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	gitRevParse.Dir = dir
+	if err := gitRevParse.Run(); err != nil {
+		return fmt.Errorf("source branch %s doesn't exist locally", branch)
+	}
+	return nil
+}
+
+// ensureRef returns a local ref for the given ref, fetching it from the remote if it isn't available locally
+func ensureRef(ctx context.Context, input Input, ref string) (string, error) {
+	gitRevParse := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	gitRevParse.Dir = input.PlanDir
+	if err := gitRevParse.Run(); err == nil {
+		return ref, nil
+	}
+
+	localRef := "refs/microplane/diff-base"
+	output, err := runGit(ctx, input, Command{Path: "git", Args: []string{"fetch", "--no-tags", input.remote(), fmt.Sprintf("+%s:%s", ref, localRef)}})
+	if err == errGitTimeout {
+		return "", fmt.Errorf("git fetch of diff base %s timed out after %s for %s/%s, maybe it's waiting on credentials or a stuck connection", ref, input.GitTimeout, input.RepoOwner, input.RepoName)
+	} else if err != nil {
+		return "", fmt.Errorf("diff base %s isn't available locally and could not be fetched: %s", ref, string(output))
+	}
+	return localRef, nil
+}
+
+// diffShortstat summarizes the changes between ref and source, e.g. "2 files changed, 5 insertions(+)"
+func diffShortstat(ctx context.Context, dir string, ref string, source string) (string, error) {
+	gitDiff := exec.CommandContext(ctx, "git", "diff", "--shortstat", fmt.Sprintf("%s...%s", ref, source))
+	gitDiff.Dir = dir
+	output, err := gitDiff.CombinedOutput()
+	if err != nil {
+		return "", errors.New(string(output))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// hasDiff reports whether source differs from its merge base with the given ref, optionally ignoring whitespace
+func hasDiff(ctx context.Context, dir string, ref string, source string, ignoreWhitespace bool) (bool, error) {
+	args := []string{"diff", "--quiet"}
+	if ignoreWhitespace {
+		args = append(args, "--ignore-all-space")
+	}
+	gitDiff := exec.CommandContext(ctx, "git", append(args, fmt.Sprintf("%s...%s", ref, source))...)
+	gitDiff.Dir = dir
+	output, err := gitDiff.CombinedOutput()
+	if err == nil {
+		return false, nil
+	}
+	// `git diff --quiet` exits non-zero without output when there are differences
+	if _, ok := err.(*exec.ExitError); ok && len(output) == 0 {
+		return true, nil
+	}
+	return false, errors.New(string(output))
+}
+
+// isFullSHA checks that sha is a full SHA-1 or SHA-256 commit hash
+func isFullSHA(sha string) bool {
+	if len(sha) != 40 && len(sha) != 64 {
+		return false
+	}
+	for _, c := range sha {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// errGitTimeout is returned by runGit when the command took longer than Input.GitTimeout
+var errGitTimeout = errors.New("git command timed out")
+
+// runGit runs the git command in the plan dir, killing it after Input.GitTimeout.
+// git fails rather than prompting for credentials or host keys, since nobody is there to answer. It runs in its own
+// process group, which is killed as a whole, so an ssh or credential helper it started doesn't outlive it.
+func runGit(ctx context.Context, input Input, cmd Command) ([]byte, error) {
+	gitCtx := ctx
+	if input.GitTimeout > 0 {
+		var cancel context.CancelFunc
+		gitCtx, cancel = context.WithTimeout(ctx, input.GitTimeout)
+		defer cancel()
+	}
+	git := exec.Command(cmd.Path, cmd.Args...)
+	git.Dir = input.PlanDir
+	// git's output is parsed, e.g. by upToDate, so it mustn't be translated
+	git.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C")
+	// keep any ssh command the user configured in the env
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		git.Env = append(git.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	git.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var output bytes.Buffer
+	git.Stdout = &output
+	git.Stderr = &output
+	if err := git.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- git.Wait() }()
+
+	select {
+	case err := <-done:
+		return output.Bytes(), err
+	case <-gitCtx.Done():
+		syscall.Kill(-git.Process.Pid, syscall.SIGKILL)
+		<-done
+	}
+	// only our own deadline is a timeout, rather than the caller's
+	if gitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return output.Bytes(), errGitTimeout
+	}
+	return output.Bytes(), gitCtx.Err()
+}
+
+// acquire takes one of the slots, if there are any, returning a func to give it back.
+// Only the first call gives it back, so it can be both deferred and called once the slot isn't needed.
+func acquire(ctx context.Context, slots *semaphore.Weighted) (func(), error) {
+	if slots == nil {
+		return func() {}, nil
+	}
+	if err := slots.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(func() { slots.Release(1) }) }, nil
+}
+
+// withoutCommits reports a plan which made no commits on base as NoChanges, which doubles as the flag for a skipped
+// push so that status and merge already pass over it. Clones without the base branch aren't skipped here, and fall
+// back to checking the diff once the base is fetched.
+func withoutCommits(ctx context.Context, input Input, base string, source string) (Output, bool) {
+	ahead, err := commitsAhead(ctx, input.PlanDir, input.remote()+"/"+base, source)
+	if err != nil || ahead != 0 {
+		return Output{}, false
+	}
+	return Output{
+		Success:         true,
+		BaseBranch:      base,
+		NoChanges:       true,
+		NoChangesReason: fmt.Sprintf("no commits ahead of %s/%s", input.remote(), base),
+	}, true
+}
+
+// commitsAhead counts the commits in source which aren't in ref
+func commitsAhead(ctx context.Context, dir string, ref string, source string) (int, error) {
+	gitRevList := exec.CommandContext(ctx, "git", "rev-list", "--count", fmt.Sprintf("%s..%s", ref, source))
+	gitRevList.Dir = dir
+	output, err := gitRevList.CombinedOutput()
+	if err != nil {
+		return 0, errors.New(string(output))
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
 func different(s1, s2 *string) bool {
 	return s1 != nil && s2 != nil && *s1 != *s2
 }
+
+// bodyWithoutFooter is withoutFooter for a possibly nil body
+func bodyWithoutFooter(body *string) *string {
+	if body == nil {
+		return nil
+	}
+	stripped := withoutFooter(*body)
+	return &stripped
+}
+
+// findOpenPR returns the open PR from head into base, or nil if there isn't one
+func findOpenPR(ctx context.Context, client *github.Client, owner string, name string, head string, base string, githubLimiter ratelimit.Limiter) (*github.PullRequest, error) {
+	githubLimiter.Wait()
+	prs, resp, err := client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{
+		Head: head,
+		Base: base,
+	})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(prs) == 0 {
+		return nil, nil
+	}
+	return prs[0], nil
+}
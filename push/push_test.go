@@ -0,0 +1,348 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTitleAndBody(t *testing.T) {
+	title, body := titleAndBody("Update team name\n\nFor the eng reorg", "", 0)
+	assert.Equal(t, "Update team name", title)
+	assert.Equal(t, "\nFor the eng reorg", body)
+
+	// overflow moves into the body
+	title, body = titleAndBody("Update team name in launch.yml\n\nFor the eng reorg", "", 12)
+	assert.Equal(t, "Update team…", title)
+	assert.Equal(t, "…name in launch.yml\n\n\nFor the eng reorg", body)
+
+	// short titles are left alone
+	title, body = titleAndBody("Update", "", 12)
+	assert.Equal(t, "Update", title)
+	assert.Equal(t, "", body)
+
+	// an explicit body takes precedence over the rest of the commit message
+	title, body = titleAndBody("Update team name\n\nFor the eng reorg", "See the RFC", 0)
+	assert.Equal(t, "Update team name", title)
+	assert.Equal(t, "See the RFC", body)
+	_, body = titleAndBody("Update", "See the RFC", 0)
+	assert.Equal(t, "See the RFC", body)
+}
+
+func TestUpToDate(t *testing.T) {
+	assert.True(t, upToDate("Everything up-to-date\n"))
+
+	pushed := `Enumerating objects: 5, done.
+Writing objects: 100% (3/3), 290 bytes | 290.00 KiB/s, done.
+To github.com:Clever/microplane.git
+ + 3f1c2d4...9a8b7c6 HEAD -> update-team (forced update)
+`
+	assert.False(t, upToDate(pushed))
+}
+
+func TestOptedOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "optout")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, ok, err := optedOut(dir, ".microplane-ignore")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".microplane-ignore"), []byte("deprecated, see #42\nmore details\n"), 0644))
+	reason, ok, err := optedOut(dir, ".microplane-ignore")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "has .microplane-ignore: deprecated, see #42", reason)
+}
+
+func TestOutputStringShowsReviewers(t *testing.T) {
+	o := Output{
+		PullRequestEffectiveStatus: "success",
+		PullRequestAssignee:        "alice",
+		PullRequestURL:             "https://github.com/Clever/svc/pull/1",
+		RequestedReviewers:         []string{"bob", "microplane-bot"},
+		FilteredReviewers:          []string{"microplane-bot"},
+		RequestedTeamReviewers:     []string{"owners", "typo"},
+		UnknownTeamReviewers:       []string{"typo"},
+	}
+	assert.Equal(t, "status:✅  assignee:alice reviewers:bob,team:owners https://github.com/Clever/svc/pull/1", o.String())
+
+	o.RequestedReviewers, o.RequestedTeamReviewers = nil, nil
+	assert.Equal(t, "status:✅  assignee:alice https://github.com/Clever/svc/pull/1", o.String())
+}
+
+func TestOutputStringShowsStatusContexts(t *testing.T) {
+	o := Output{
+		PullRequestEffectiveStatus: "failure",
+		PullRequestAssignee:        "alice",
+		PullRequestURL:             "https://github.com/Clever/svc/pull/1",
+		Statuses:                   []StatusDetail{{Context: "ci/circleci", State: "failure"}, {Context: "license/cla", State: "success"}, {Context: "lint", State: "pending"}},
+	}
+	assert.Equal(t, "status:❌  assignee:alice https://github.com/Clever/svc/pull/1", o.String(), "contexts are only listed when asked for")
+	assert.Equal(t, "status:❌ (❌ ci/circleci, 🕐 lint)  assignee:alice https://github.com/Clever/svc/pull/1", o.Format(AssigneePlain, true))
+	o.IgnoreContexts = []string{"ci/*"}
+	assert.Equal(t, "status:❌ (🕐 lint)  assignee:alice https://github.com/Clever/svc/pull/1", o.Format(AssigneePlain, true))
+}
+
+func TestOutputStringShowsLabels(t *testing.T) {
+	o := Output{
+		PullRequestEffectiveStatus: "success",
+		PullRequestAssignee:        "alice",
+		PullRequestURL:             "https://github.com/Clever/svc/pull/1",
+		Labels:                     []string{"automated", "dependencies"},
+	}
+	assert.Equal(t, "status:✅  assignee:alice labels:automated,dependencies https://github.com/Clever/svc/pull/1", o.String())
+}
+
+func TestOutputStringShowsPRState(t *testing.T) {
+	o := Output{
+		PullRequestEffectiveStatus: "success",
+		PullRequestAssignee:        "alice",
+		PullRequestURL:             "https://github.com/Clever/svc/pull/1",
+		Draft:                      true,
+	}
+	assert.Equal(t, "status:✅ 📝  assignee:alice https://github.com/Clever/svc/pull/1", o.String())
+
+	o.Mergeable = github.Bool(false)
+	assert.Equal(t, "status:✅ 📝 ⚠️ conflict  assignee:alice https://github.com/Clever/svc/pull/1", o.String())
+	o.Mergeable = nil
+
+	assert.Equal(t, "status:✅ 📝  assignee:@alice https://github.com/Clever/svc/pull/1", o.Format(AssigneeMention, false))
+	o.PullRequestAssignee = "alice,bob"
+	assert.Equal(t, "status:✅ 📝  assignee:@alice,@bob https://github.com/Clever/svc/pull/1", o.Format(AssigneeMention, false))
+
+	o = Output{DryRun: true, CommitSHA: "abc123", PullRequestHead: "Clever:codemod", PullRequestTitle: "Bump deps", BaseBranch: "main", PullRequestAssignee: "alice"}
+	assert.Equal(t, `dry run: would push abc123 to Clever:codemod and open "Bump deps" against main, assigned to alice`, o.String())
+}
+
+func TestChooseBaseWithResolver(t *testing.T) {
+	input := Input{
+		RepoOwner:    "Clever",
+		RepoName:     "svc",
+		BaseBranches: []string{"main", "master"},
+		BaseResolver: func(repo string) (string, error) {
+			if repo == "Clever/svc" {
+				return "release", nil
+			}
+			return "", nil
+		},
+	}
+	// the resolver wins, without asking Github
+	base, err := chooseBase(context.Background(), nil, input, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "release", base)
+
+	input.BaseResolver = func(repo string) (string, error) { return "", fmt.Errorf("catalog is down") }
+	_, err = chooseBase(context.Background(), nil, input, nil)
+	assert.EqualError(t, err, "could not resolve base branch: catalog is down")
+}
+
+func TestPushArgs(t *testing.T) {
+	assert.Equal(t, []string{"push", "-f", "origin", "HEAD:codemod"}, pushArgs(true, "origin", "HEAD:codemod"))
+	assert.Equal(t, []string{"push", "upstream", "HEAD:codemod"}, pushArgs(false, "upstream", "HEAD:codemod"))
+
+	assert.True(t, nonFastForward(" ! [rejected]        HEAD -> codemod (non-fast-forward)\nerror: failed to push some refs"))
+	assert.True(t, nonFastForward(" ! [rejected]        HEAD -> codemod (fetch first)"))
+	assert.False(t, nonFastForward(" ! [remote rejected] HEAD -> codemod (pre-receive hook declined)"))
+	assert.Equal(t, "origin", Input{}.remote())
+	assert.Equal(t, "Clever:codemod", Input{RepoOwner: "Clever", BranchName: "codemod"}.head())
+	assert.Equal(t, "forker:codemod", Input{RepoOwner: "Clever", HeadOwner: "forker", BranchName: "codemod"}.head())
+}
+
+func TestPushSkipsPlansWithoutCommits(t *testing.T) {
+	dir, git := newTestRepo(t)
+	defer os.RemoveAll(dir)
+	git("commit", "-q", "--allow-empty", "-m", "base")
+	git("update-ref", "refs/remotes/origin/develop", "HEAD")
+
+	// the base is resolved without Github, and there's no Github server, so this would fail if it got as far as Github
+	base := func(string) (string, error) { return "develop", nil }
+	input := Input{PlanDir: dir, BranchName: "codemod", GithubToken: "token", GithubBaseURL: "http://127.0.0.1:1/", BaseResolver: base}
+	output, err := push(context.Background(), input, ratelimit.NewTicker(time.Millisecond), nil)
+	assert.NoError(t, err)
+	assert.True(t, output.NoChanges)
+	assert.Equal(t, "develop", output.BaseBranch)
+	assert.Equal(t, "no commits ahead of origin/develop", output.NoChangesReason)
+
+	// a single candidate base is known up front too, so the skip comes before the permission and marker lookups
+	named := Input{PlanDir: dir, BranchName: "codemod", GithubToken: "token", GithubBaseURL: "http://127.0.0.1:1/",
+		BaseBranches: []string{"develop"}, SkipReadOnly: true, RunID: "run-1"}
+	output, err = push(context.Background(), named, ratelimit.NewTicker(time.Millisecond), nil)
+	assert.NoError(t, err)
+	assert.True(t, output.NoChanges)
+	assert.Equal(t, "develop", output.BaseBranch)
+
+	// the clone's HEAD has commits the base doesn't, so there's something to push even though the plan made no commits
+	git("commit", "-q", "--allow-empty", "-m", "change")
+	git("update-ref", "refs/remotes/origin/HEAD", "HEAD")
+	ahead, err := commitsAhead(context.Background(), dir, "origin/develop", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ahead)
+	_, err = push(context.Background(), input, ratelimit.NewTicker(time.Millisecond), nil)
+	assert.Error(t, err, "went on to Github")
+}
+
+func TestIsFullSHA(t *testing.T) {
+	assert.True(t, isFullSHA("0123456789abcdef0123456789ABCDEF01234567"))
+	assert.True(t, isFullSHA(strings.Repeat("a", 64)))
+	assert.False(t, isFullSHA("0123456"), "abbreviated SHAs are ambiguous")
+	assert.False(t, isFullSHA("master"))
+	assert.False(t, isFullSHA(strings.Repeat("g", 40)))
+}
+
+func TestOutputToJSON(t *testing.T) {
+	o := Output{
+		Success:                   true,
+		PullRequestNumber:         7,
+		PullRequestURL:            "https://github.com/Clever/svc/pull/7",
+		PullRequestCombinedStatus: "success",
+		PullRequestAssignee:       "alice",
+		CIBuildURL:                "https://ci.example.com/builds/1",
+	}
+	b, err := o.ToJSON()
+	assert.NoError(t, err)
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &fields))
+	assert.Equal(t, float64(7), fields["pull_request_number"])
+	assert.Equal(t, "https://github.com/Clever/svc/pull/7", fields["pull_request_url"])
+	assert.Equal(t, "success", fields["pull_request_combined_status"])
+	assert.Equal(t, "alice", fields["pull_request_assignee"])
+	assert.Equal(t, "https://ci.example.com/builds/1", fields["ci_build_url"])
+
+	// push.json keeps the field names, so outputs written by earlier versions still load
+	persisted, err := json.Marshal(o)
+	assert.NoError(t, err)
+	assert.Contains(t, string(persisted), `"PullRequestURL":"https://github.com/Clever/svc/pull/7"`)
+	var decoded Output
+	assert.NoError(t, json.Unmarshal(persisted, &decoded))
+	assert.Equal(t, o, decoded)
+}
+
+func TestRunGitTimeout(t *testing.T) {
+	_, err := runGit(context.Background(), Input{GitTimeout: 10 * time.Millisecond}, Command{Path: "sleep", Args: []string{"5"}})
+	assert.Equal(t, errGitTimeout, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = runGit(ctx, Input{GitTimeout: time.Minute}, Command{Path: "sleep", Args: []string{"5"}})
+	assert.Error(t, err)
+	assert.NotEqual(t, errGitTimeout, err, "the caller's deadline isn't a git timeout")
+}
+
+func TestOpenPR(t *testing.T) {
+	pr := func(state string, number int) *github.PullRequest {
+		url := fmt.Sprintf("https://github.com/Clever/svc/pull/%d", number)
+		return &github.PullRequest{State: &state, Number: &number, HTMLURL: &url}
+	}
+
+	open, err := openPR([]*github.PullRequest{pr("closed", 1), pr("open", 2)}, "Clever:mp-change")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, open.GetNumber(), "an old closed PR for the branch is ignored")
+
+	_, err = openPR([]*github.PullRequest{pr("open", 1), pr("open", 2)}, "Clever:mp-change")
+	assert.EqualError(t, err, "found 2 open PRs for branch Clever:mp-change: https://github.com/Clever/svc/pull/1, https://github.com/Clever/svc/pull/2")
+
+	_, err = openPR([]*github.PullRequest{pr("closed", 1)}, "Clever:mp-change")
+	assert.EqualError(t, err, "found no open PR for branch Clever:mp-change, only: https://github.com/Clever/svc/pull/1")
+}
+
+func TestHasDiffIgnoringWhitespace(t *testing.T) {
+	dir, git := newTestRepo(t)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("func main() {\n\tfmt.Println(\"hi\")\n}\n"), 0644))
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	git("tag", "base")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("func main()  {\n    fmt.Println(\"hi\")\n}\n"), 0644))
+	git("commit", "-q", "-am", "reformat")
+
+	changed, err := hasDiff(context.Background(), dir, "base", "HEAD", false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = hasDiff(context.Background(), dir, "base", "HEAD", true)
+	assert.NoError(t, err)
+	assert.False(t, changed, "a whitespace-only change isn't a change")
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("func main()  {\n    fmt.Println(\"hello\")\n}\n"), 0644))
+	git("commit", "-q", "-am", "change")
+	changed, err = hasDiff(context.Background(), dir, "base", "HEAD", true)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestEnsureRefFetchTimesOut(t *testing.T) {
+	dir, git := newTestRepo(t)
+	defer os.RemoveAll(dir)
+	git("commit", "-q", "--allow-empty", "-m", "base")
+	git("remote", "add", "origin", dir)
+
+	_, err := ensureRef(context.Background(), Input{RepoOwner: "Clever", RepoName: "svc", PlanDir: dir}, "refs/heads/missing")
+	assert.Contains(t, err.Error(), "diff base refs/heads/missing isn't available locally and could not be fetched")
+
+	_, err = ensureRef(context.Background(), Input{RepoOwner: "Clever", RepoName: "svc", PlanDir: dir, GitTimeout: time.Nanosecond}, "refs/heads/missing")
+	assert.Contains(t, err.Error(), "git fetch of diff base refs/heads/missing timed out after 1ns for Clever/svc")
+}
+
+func TestRunGitKillsProcessGroup(t *testing.T) {
+	// the backgrounded sleep holds the output open, like an ssh started by git would, until its group is killed
+	start := time.Now()
+	_, err := runGit(context.Background(), Input{GitTimeout: 50 * time.Millisecond}, Command{Path: "sh", Args: []string{"-c", "sleep 5 & wait"}})
+	assert.Equal(t, errGitTimeout, err)
+	assert.True(t, time.Since(start) < 2*time.Second, "took %s", time.Since(start))
+
+	output, err := runGit(context.Background(), Input{}, Command{Path: "sh", Args: []string{"-c", "echo $GIT_TERMINAL_PROMPT $LC_ALL"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "0 C\n", string(output))
+}
+
+func TestHeadOwner(t *testing.T) {
+	input := Input{RepoOwner: "Clever", RepoName: "svc", BranchName: "mp/bump"}
+	assert.Equal(t, "Clever", input.headOwner())
+	assert.Equal(t, "Clever:mp/bump", input.head())
+
+	input.HeadOwner = "bot"
+	assert.Equal(t, "bot", input.headOwner())
+	assert.Equal(t, "bot:mp/bump", input.head())
+}
+
+// newTestClient is a client for a fake Github API served by handler. The caller closes the server.
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*github.Client, *httptest.Server) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, server
+}
+
+// newTestRepo is a new git repo with a function to run git in it, which returns git's trimmed output.
+// The caller removes the repo.
+func newTestRepo(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "microplane")
+	assert.NoError(t, err)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=mp", "-c", "user.email=mp@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q")
+	return dir, git
+}
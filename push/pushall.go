@@ -0,0 +1,43 @@
+package push
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+)
+
+// PushAll pushes each input with Push, concurrency at a time, sharing the limiters so Github calls stay paced.
+// Outputs and errors line up with inputs. One repo failing doesn't stop the others, but once ctx is done, inputs which
+// haven't started fail with ctx's error.
+func PushAll(ctx context.Context, inputs []Input, concurrency int, githubLimiter ratelimit.Limiter, pushLimiter *time.Ticker) ([]Output, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	outputs := make([]Output, len(inputs))
+	errs := make([]error, len(inputs))
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for i, input := range inputs {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		case slots <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int, input Input) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			outputs[i], errs[i] = Push(ctx, input, githubLimiter, pushLimiter)
+		}(i, input)
+	}
+	wg.Wait()
+	return outputs, errs
+}
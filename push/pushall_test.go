@@ -0,0 +1,40 @@
+package push
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pushall")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".microplane-ignore"), []byte("deprecated\n"), 0644))
+
+	inputs := []Input{
+		{RepoName: "bad", PlanDir: dir, BranchName: "bad..branch"},
+		{RepoName: "ignored", PlanDir: dir, BranchName: "mp/change", OptOutFile: ".microplane-ignore"},
+		{RepoName: "empty", PlanDir: dir, BranchName: ""},
+	}
+	limiter := ratelimit.NewTicker(time.Millisecond)
+	outputs, errs := PushAll(context.Background(), inputs, 2, limiter, time.NewTicker(time.Millisecond))
+	assert.Len(t, outputs, 3)
+	assert.Error(t, errs[0])
+	assert.NoError(t, errs[1], "one repo failing doesn't stop the others")
+	assert.True(t, outputs[1].OptedOut)
+	assert.EqualError(t, errs[2], "branch name is empty")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, errs = PushAll(ctx, inputs, 2, limiter, time.NewTicker(time.Millisecond))
+	for _, err := range errs {
+		assert.Equal(t, context.Canceled, err)
+	}
+}
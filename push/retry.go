@@ -0,0 +1,147 @@
+package push
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// RetryPolicy retries a whole Push on transient failures, e.g. network timeouts and Github 5xx responses
+type RetryPolicy struct {
+	// MaxAttempts caps the number of tries, including the first. Zero or one means no retries.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled before each later retry
+	Backoff time.Duration
+}
+
+// transientGitErrors are fragments of `git push` output for failures worth retrying
+var transientGitErrors = []string{
+	"could not resolve host",
+	"connection reset",
+	"connection timed out",
+	"the remote end hung up unexpectedly",
+	"rpc failed",
+	"internal server error",
+	"service unavailable",
+}
+
+// isTransient classifies errors which may succeed if the push is tried again
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case *github.ErrorResponse:
+		return e.Response != nil && e.Response.StatusCode >= 500
+	case *url.Error:
+		// the request was cancelled, or ran out of time, on purpose
+		if e.Err == context.Canceled || e.Err == context.DeadlineExceeded {
+			return false
+		}
+		return e.Timeout() || e.Temporary()
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range transientGitErrors {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiOperation describes a Github API call to retryAPI, which only repeats it when that's safe
+type apiOperation struct {
+	// Idempotent calls have the same effect however many times they're made, so they're retried after any failure
+	Idempotent bool
+	// Done checks whether a failed call which isn't idempotent took effect anyway, e.g. Github posted a comment but
+	// responded with a 502, in which case it isn't repeated. Calls which aren't idempotent and have no Done are only
+	// retried after rate limit errors, since Github rejects those before doing anything.
+	Done func() (bool, error)
+}
+
+// The Github API calls push retries. Reads are idempotent, as are writes which set state rather than add to it.
+var (
+	// opCreatePR is idempotent, since Github rejects a second PR for the same head and base, which findOrCreatePR then finds
+	opCreatePR  = apiOperation{Idempotent: true}
+	opListPRs   = apiOperation{Idempotent: true}
+	opEditPR    = apiOperation{Idempotent: true}
+	opGetStatus = apiOperation{Idempotent: true}
+	// opAddAssignees and opAddLabels are idempotent, since adding an assignee or label the PR already has is a no-op
+	opAddAssignees = apiOperation{Idempotent: true}
+	opAddLabels    = apiOperation{Idempotent: true}
+)
+
+// opCreateComment isn't idempotent, since each call posts another comment. posted checks whether a failed call posted it.
+func opCreateComment(posted func() (bool, error)) apiOperation {
+	return apiOperation{Done: posted}
+}
+
+// retryAPI makes a Github API call, retrying it per policy on rate limit errors and 5xx responses, as op allows.
+// Abuse (secondary) rate limits wait out their Retry-After, and primary rate limits wait until they reset.
+func retryAPI(ctx context.Context, policy RetryPolicy, githubLimiter ratelimit.Limiter, op apiOperation, call func() (*github.Response, error)) error {
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		githubLimiter.Wait()
+		resp, err := call()
+		githubLimiter.Observe(resp)
+		if err == nil || attempt >= policy.MaxAttempts {
+			return err
+		}
+		wait, ok := apiRetryWait(err, backoff, time.Now())
+		if !ok {
+			return err
+		}
+		// after a 5xx, the call may or may not have taken effect
+		ambiguous := !rateLimited(err)
+		if ambiguous && !op.Idempotent && op.Done == nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		// checked after waiting, since what the call did may take a moment to show up
+		if ambiguous && !op.Idempotent {
+			if done, doneErr := op.Done(); doneErr != nil {
+				return err
+			} else if done {
+				return nil
+			}
+		}
+		backoff *= 2
+	}
+}
+
+// rateLimited checks whether Github rejected a call for exceeding a rate limit, so it wasn't processed
+func rateLimited(err error) bool {
+	switch err.(type) {
+	case *github.AbuseRateLimitError, *github.RateLimitError:
+		return true
+	}
+	return false
+}
+
+// apiRetryWait is how long to wait before retrying an API call which failed with err, if it's worth retrying
+func apiRetryWait(err error, backoff time.Duration, now time.Time) (time.Duration, bool) {
+	switch e := err.(type) {
+	case *github.AbuseRateLimitError:
+		if e.RetryAfter != nil {
+			return *e.RetryAfter, true
+		}
+		return backoff, true
+	case *github.RateLimitError:
+		if wait := e.Rate.Reset.Time.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return backoff, true
+	case *github.ErrorResponse:
+		return backoff, e.Response != nil && e.Response.StatusCode >= 500
+	}
+	return 0, false
+}
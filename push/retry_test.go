@@ -0,0 +1,123 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIRetryWait(t *testing.T) {
+	now := time.Now()
+	retryAfter := time.Minute
+	wait, ok := apiRetryWait(&github.AbuseRateLimitError{RetryAfter: &retryAfter}, time.Second, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, wait, "abuse rate limits honor Retry-After")
+
+	wait, ok = apiRetryWait(&github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: now.Add(time.Hour)}}}, time.Second, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, wait, "rate limits wait until they reset")
+
+	wait, ok = apiRetryWait(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}, time.Second, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	_, ok = apiRetryWait(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}}, time.Second, now)
+	assert.False(t, ok, "client errors aren't retried")
+}
+
+func TestRetryAPI(t *testing.T) {
+	calls := 0
+	err := retryAPI(context.Background(), RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, ratelimit.NewTicker(time.Millisecond), opEditPR, func() (*github.Response, error) {
+		calls++
+		if calls < 3 {
+			return nil, &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}
+		}
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = retryAPI(context.Background(), RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}, ratelimit.NewTicker(time.Millisecond), opEditPR, func() (*github.Response, error) {
+		calls++
+		return nil, &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls, "gives up after MaxAttempts")
+}
+
+func TestRetryAPINonIdempotent(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	limiter := ratelimit.NewTicker(time.Millisecond)
+	badGateway := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}
+
+	calls := 0
+	err := retryAPI(context.Background(), policy, limiter, apiOperation{}, func() (*github.Response, error) {
+		calls++
+		return nil, badGateway
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "a call which isn't idempotent isn't repeated after a 5xx")
+
+	calls = 0
+	err = retryAPI(context.Background(), policy, limiter, apiOperation{}, func() (*github.Response, error) {
+		calls++
+		if calls < 2 {
+			return nil, &github.AbuseRateLimitError{RetryAfter: &policy.Backoff}
+		}
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "rate limited calls weren't processed, so they're safe to repeat")
+
+	calls = 0
+	posted := false
+	err = retryAPI(context.Background(), policy, limiter, opCreateComment(func() (bool, error) { return posted, nil }), func() (*github.Response, error) {
+		calls++
+		posted = true
+		return nil, badGateway
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls, "a comment which was posted despite the error isn't posted again")
+
+	calls = 0
+	err = retryAPI(context.Background(), policy, limiter, opCreateComment(func() (bool, error) { return false, nil }), func() (*github.Response, error) {
+		calls++
+		if calls < 2 {
+			return nil, badGateway
+		}
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "a comment which wasn't posted is tried again")
+}
+
+// netError is a net.Error for testing isTransient
+type netError struct {
+	timeout   bool
+	temporary bool
+}
+
+func (e netError) Error() string   { return "network error" }
+func (e netError) Timeout() bool   { return e.timeout }
+func (e netError) Temporary() bool { return e.temporary }
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(&url.Error{Op: "Get", URL: "https://api.github.com/", Err: netError{timeout: true}}))
+	assert.True(t, isTransient(&url.Error{Op: "Get", URL: "https://api.github.com/", Err: netError{temporary: true}}))
+	assert.False(t, isTransient(&url.Error{Op: "Get", URL: "https://api.github.com/", Err: errors.New("x509: certificate signed by unknown authority")}))
+	assert.False(t, isTransient(&url.Error{Op: "Get", URL: "https://api.github.com/", Err: context.DeadlineExceeded}), "the caller's deadline isn't retried")
+	assert.True(t, isTransient(netError{timeout: true}))
+	assert.False(t, isTransient(netError{}))
+
+	assert.True(t, isTransient(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}))
+	assert.True(t, isTransient(errors.New("fatal: the remote end hung up unexpectedly")))
+	assert.False(t, isTransient(errors.New("! [remote rejected] HEAD -> codemod (protected branch hook declined)")))
+}
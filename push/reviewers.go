@@ -0,0 +1,197 @@
+package push
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// reviewerResult reports what requestReviewers couldn't do, without failing the push
+type reviewerResult struct {
+	// filtered are reviewers skipped because they authored the PR
+	filtered []string
+	// warning is set when Github still refused to request a review from the author
+	warning string
+	// unknownTeams are team slugs that aren't teams in the repo's org, so weren't requested
+	unknownTeams []string
+}
+
+// requestReviewers requests reviews from input.Reviewers who haven't been requested yet, except the PR's author.
+// With input.ReconcileReviewers, it also removes reviewers microplane requested on a previous run
+// who are no longer wanted. Reviewers requested by hand are left alone.
+func requestReviewers(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, githubLimiter ratelimit.Limiter) (reviewerResult, error) {
+	var result reviewerResult
+	number := pr.GetNumber()
+	githubLimiter.Wait()
+	current, resp, err := client.PullRequests.ListReviewers(ctx, input.RepoOwner, input.RepoName, number, &github.ListOptions{PerPage: 100})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return result, err
+	}
+	currentLogins := []string{}
+	for _, u := range current.Users {
+		currentLogins = append(currentLogins, u.GetLogin())
+	}
+	currentTeams := []string{}
+	for _, t := range current.Teams {
+		currentTeams = append(currentTeams, t.GetSlug())
+	}
+
+	// Github refuses to request a review from the PR's author, e.g. when the bot account is also a reviewer
+	var reviewers []string
+	reviewers, result.filtered = withoutAuthor(input.Reviewers, pr.GetUser().GetLogin())
+
+	teams := input.TeamReviewers
+	if len(teams) > 0 {
+		teams, result.unknownTeams, err = knownTeams(ctx, client, input.RepoOwner, teams, githubLimiter)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	add, remove := reviewerChanges(reviewers, currentLogins, input.PreviousReviewers, input.ReconcileReviewers)
+	addTeams, removeTeams := reviewerChanges(teams, currentTeams, input.PreviousTeamReviewers, input.ReconcileReviewers)
+	if len(add) > 0 || len(addTeams) > 0 {
+		githubLimiter.Wait()
+		_, resp, err := client.PullRequests.RequestReviewers(ctx, input.RepoOwner, input.RepoName, number, github.ReviewersRequest{Reviewers: add, TeamReviewers: addTeams})
+		githubLimiter.Observe(resp)
+		if isAuthorReviewError(err) {
+			result.warning = err.Error()
+		} else if err != nil {
+			return result, err
+		}
+	}
+	if len(remove) > 0 || len(removeTeams) > 0 {
+		githubLimiter.Wait()
+		resp, err := client.PullRequests.RemoveReviewers(ctx, input.RepoOwner, input.RepoName, number, github.ReviewersRequest{Reviewers: remove, TeamReviewers: removeTeams})
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// knownTeams splits team slugs into the org's teams and unknown ones.
+// If the org's teams can't be listed, e.g. the owner is a user or the token lacks read:org, all slugs are kept
+// and Github has the final say.
+func knownTeams(ctx context.Context, client *github.Client, org string, slugs []string, githubLimiter ratelimit.Limiter) (known []string, unknown []string, err error) {
+	orgTeams, err := listOrgTeams(ctx, client, org, githubLimiter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if orgTeams == nil {
+		return slugs, nil, nil
+	}
+	known, unknown = splitTeams(slugs, orgTeams)
+	return known, unknown, nil
+}
+
+// orgTeamSlugs caches each org's team slugs, keyed by org. nil means the org's teams can't be listed.
+var orgTeamSlugs = struct {
+	sync.Mutex
+	m map[string][]string
+}{m: map[string][]string{}}
+
+// listOrgTeams returns the slugs of the org's teams, or nil if they can't be listed
+func listOrgTeams(ctx context.Context, client *github.Client, org string, githubLimiter ratelimit.Limiter) ([]string, error) {
+	orgTeamSlugs.Lock()
+	orgTeams, ok := orgTeamSlugs.m[org]
+	orgTeamSlugs.Unlock()
+	if ok {
+		return orgTeams, nil
+	}
+
+	orgTeams = []string{}
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		githubLimiter.Wait()
+		page, resp, err := client.Organizations.ListTeams(ctx, org, opt)
+		githubLimiter.Observe(resp)
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			orgTeams = nil
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range page {
+			orgTeams = append(orgTeams, t.GetSlug())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	orgTeamSlugs.Lock()
+	orgTeamSlugs.m[org] = orgTeams
+	orgTeamSlugs.Unlock()
+	return orgTeams, nil
+}
+
+// splitTeams splits slugs into those in orgTeams and those that aren't
+func splitTeams(slugs []string, orgTeams []string) (known []string, unknown []string) {
+	for _, slug := range slugs {
+		if containsLogin(orgTeams, slug) {
+			known = append(known, slug)
+		} else {
+			unknown = append(unknown, slug)
+		}
+	}
+	return known, unknown
+}
+
+// withoutAuthor splits the PR's author out of reviewers
+func withoutAuthor(reviewers []string, author string) (kept []string, filtered []string) {
+	for _, login := range reviewers {
+		if author != "" && strings.EqualFold(login, author) {
+			filtered = append(filtered, login)
+		} else {
+			kept = append(kept, login)
+		}
+	}
+	return kept, filtered
+}
+
+// isAuthorReviewError checks for Github's 422 when a review is requested from the PR's author
+func isAuthorReviewError(err error) bool {
+	e, ok := err.(*github.ErrorResponse)
+	if !ok || e.Response == nil || e.Response.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	return strings.Contains(strings.ToLower(e.Error()), "review cannot be requested from pull request author")
+}
+
+// reviewerChanges works out which reviewers to request and, when reconciling, which to remove.
+// Reviewers microplane requested before (previous) aren't requested again, since a review clears the request.
+// Only those previous reviewers are ever removed.
+func reviewerChanges(desired []string, current []string, previous []string, reconcile bool) (add []string, remove []string) {
+	for _, login := range desired {
+		if !containsLogin(current, login) && !containsLogin(previous, login) {
+			add = append(add, login)
+		}
+	}
+	if !reconcile {
+		return add, nil
+	}
+	for _, login := range previous {
+		if containsLogin(current, login) && !containsLogin(desired, login) {
+			remove = append(remove, login)
+		}
+	}
+	return add, remove
+}
+
+// containsLogin compares logins like Github does, ignoring case
+func containsLogin(logins []string, login string) bool {
+	for _, l := range logins {
+		if strings.EqualFold(l, login) {
+			return true
+		}
+	}
+	return false
+}
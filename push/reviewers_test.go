@@ -0,0 +1,91 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewerChanges(t *testing.T) {
+	// first run requests everyone
+	add, remove := reviewerChanges([]string{"alice", "bob"}, nil, nil, true)
+	assert.Equal(t, []string{"alice", "bob"}, add)
+	assert.Empty(t, remove)
+
+	// bob was dropped from the campaign, carol was added by hand, alice already reviewed
+	add, remove = reviewerChanges([]string{"alice", "dave"}, []string{"Bob", "carol"}, []string{"alice", "bob"}, true)
+	assert.Equal(t, []string{"dave"}, add)
+	assert.Equal(t, []string{"bob"}, remove)
+
+	// without reconciling, nobody is removed
+	_, remove = reviewerChanges([]string{"alice"}, []string{"bob"}, []string{"bob"}, false)
+	assert.Empty(t, remove)
+}
+
+func TestWithoutAuthor(t *testing.T) {
+	// the bot account which opens the PRs is also on the reviewer list
+	kept, filtered := withoutAuthor([]string{"alice", "Microplane-Bot", "bob"}, "microplane-bot")
+	assert.Equal(t, []string{"alice", "bob"}, kept)
+	assert.Equal(t, []string{"Microplane-Bot"}, filtered)
+
+	kept, filtered = withoutAuthor([]string{"alice"}, "")
+	assert.Equal(t, []string{"alice"}, kept)
+	assert.Empty(t, filtered)
+}
+
+func TestIsAuthorReviewError(t *testing.T) {
+	err := &github.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusUnprocessableEntity, Request: &http.Request{Method: "POST", URL: &url.URL{}}},
+		Message:  "Review cannot be requested from pull request author.",
+	}
+	assert.True(t, isAuthorReviewError(err))
+
+	err.Message = "Reviews may only be requested from collaborators."
+	assert.False(t, isAuthorReviewError(err))
+	assert.False(t, isAuthorReviewError(nil))
+}
+
+func TestSplitTeams(t *testing.T) {
+	known, unknown := splitTeams([]string{"API-Owners", "frontend", "typo-team"}, []string{"api-owners", "frontend", "platform"})
+	assert.Equal(t, []string{"API-Owners", "frontend"}, known)
+	assert.Equal(t, []string{"typo-team"}, unknown)
+}
+
+func TestKnownTeamsListsOrgTeamsOnce(t *testing.T) {
+	lists := 0
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/Cached/teams":
+			lists++
+			fmt.Fprint(w, `[{"slug": "owners"}]`)
+		case "/orgs/someone/teams":
+			lists++
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "Not Found"}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		known, unknown, err := knownTeams(context.Background(), client, "Cached", []string{"owners", "typo"}, limiter)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"owners"}, known)
+		assert.Equal(t, []string{"typo"}, unknown)
+
+		known, unknown, err = knownTeams(context.Background(), client, "someone", []string{"owners"}, limiter)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"owners"}, known, "a user's teams can't be listed, so Github decides")
+		assert.Empty(t, unknown)
+	}
+	assert.Equal(t, 2, lists, "each org's teams are listed once")
+}
@@ -0,0 +1,108 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// ReviewActivity summarizes the review conversation on a PR
+type ReviewActivity struct {
+	// ReviewComments is the number of comments on the PR's diff
+	ReviewComments int
+	// UnresolvedThreads is the number of review threads not yet marked resolved
+	UnresolvedThreads int
+}
+
+// GetReviewActivity counts a PR's review comments, and its unresolved review threads via Github's GraphQL API.
+// Both are paginated, so this costs at least two API requests per PR.
+func GetReviewActivity(ctx context.Context, owner string, name string, number int, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) (ReviewActivity, error) {
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return ReviewActivity{}, err
+	}
+
+	var activity ReviewActivity
+	opts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		githubLimiter.Wait()
+		comments, resp, err := client.PullRequests.ListComments(ctx, owner, name, number, opts)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return activity, err
+		}
+		activity.ReviewComments += len(comments)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	unresolved, err := countUnresolvedThreads(ctx, client, owner, name, number, githubLimiter)
+	if err != nil {
+		return activity, err
+	}
+	activity.UnresolvedThreads = unresolved
+	return activity, nil
+}
+
+const reviewThreadsQuery = `query($owner: String!, $name: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100, after: $after) {
+        nodes { isResolved }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+type reviewThreadsData struct {
+	Repository struct {
+		PullRequest struct {
+			ReviewThreads struct {
+				Nodes []struct {
+					IsResolved bool
+				}
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			}
+		}
+	}
+}
+
+// countUnresolvedThreads pages through the PR's review threads, which are only in the GraphQL API
+func countUnresolvedThreads(ctx context.Context, client *github.Client, owner string, name string, number int, githubLimiter ratelimit.Limiter) (int, error) {
+	unresolved := 0
+	var after *string
+	for {
+		var data reviewThreadsData
+		err := graphQL(ctx, client, reviewThreadsQuery, map[string]interface{}{
+			"owner":  owner,
+			"name":   name,
+			"number": number,
+			"after":  after,
+		}, &data, githubLimiter)
+		if err != nil {
+			return 0, fmt.Errorf("graphql request failed: %s", err)
+		}
+
+		threads := data.Repository.PullRequest.ReviewThreads
+		for _, thread := range threads.Nodes {
+			if !thread.IsResolved {
+				unresolved++
+			}
+		}
+		if !threads.PageInfo.HasNextPage {
+			return unresolved, nil
+		}
+		cursor := threads.PageInfo.EndCursor
+		after = &cursor
+	}
+}
@@ -0,0 +1,50 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// squash replaces the commits on HEAD since it forked from ref with a single commit with the message.
+// The new commit keeps the author of the latest commit. A single commit is left as is.
+// identity overrides the committer, see identityArgs.
+func squash(ctx context.Context, dir string, ref string, message string, identity []string) error {
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", append(identity, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", errors.New(string(output))
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	mergeBase, err := git("merge-base", ref, "HEAD")
+	if err != nil {
+		return err
+	}
+	count, err := git("rev-list", "--count", mergeBase+"..HEAD")
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(count); err != nil || n <= 1 {
+		return err
+	}
+
+	author, err := git("log", "-1", "--pretty=format:%an <%ae>")
+	if err != nil {
+		return err
+	}
+	date, err := git("log", "-1", "--pretty=format:%aD")
+	if err != nil {
+		return err
+	}
+	if _, err := git("reset", "--soft", mergeBase); err != nil {
+		return err
+	}
+	_, err = git("commit", "--no-verify", "-m", message, "--author", author, "--date", date)
+	return err
+}
@@ -0,0 +1,246 @@
+package push
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// contextStates maps each status context (e.g. "ci/circleci") to its state
+func contextStates(statuses []github.RepoStatus) map[string]string {
+	states := map[string]string{}
+	for _, status := range statuses {
+		states[status.GetContext()] = status.GetState()
+	}
+	return states
+}
+
+// StatusDetail is a status context's state, e.g. so a failing PR shows which check failed
+type StatusDetail struct {
+	Context   string `json:"context"`
+	State     string `json:"state"`
+	TargetURL string `json:"target_url"`
+}
+
+// statusDetails lists each status context, sorted by context. Target URLs are cleaned, and dropped if their host isn't
+// allowed by hosts, like the CI build URL.
+func statusDetails(statuses []github.RepoStatus, hosts HostFilter) []StatusDetail {
+	details := []StatusDetail{}
+	for _, status := range statuses {
+		details = append(details, StatusDetail{
+			Context:   status.GetContext(),
+			State:     status.GetState(),
+			TargetURL: allowedBuildURL(cleanBuildURL(status.GetTargetURL()), hosts),
+		})
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Context < details[j].Context })
+	return details
+}
+
+// stateEmoji is how Output.Format shows a state. An error is shown like a failure, since both block the PR.
+func stateEmoji(state string) string {
+	switch state {
+	case "failure", "error":
+		return "❌"
+	case "pending":
+		return "🕐"
+	case "success":
+		return "✅"
+	default:
+		return "?"
+	}
+}
+
+// unsuccessfulContexts lists the contexts which haven't succeeded with their state, e.g. "❌ ci/circleci, 🕐 lint",
+// skipping those matching any of ignoreContexts
+func unsuccessfulContexts(statuses []StatusDetail, ignoreContexts []string) string {
+	contexts := []string{}
+	for _, s := range statuses {
+		if s.State != "success" && !ignored(s.Context, ignoreContexts) {
+			contexts = append(contexts, stateEmoji(s.State)+" "+s.Context)
+		}
+	}
+	return strings.Join(contexts, ", ")
+}
+
+// GetEffectiveStatus reads the PR's status from Github as it is now, rather than as its push recorded it: the status of
+// the PR's head, or of statusSHA if it's set, excluding ignoreContexts and combined with the aggregation policy.
+// checkRuns includes check runs, like Input.CheckRuns.
+func GetEffectiveStatus(ctx context.Context, owner string, name string, number int, statusSHA string, ignoreContexts []string, aggregation string, checkRuns bool, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) (string, error) {
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return "", err
+	}
+
+	if statusSHA == "" {
+		githubLimiter.Wait()
+		pr, resp, err := client.PullRequests.Get(ctx, owner, name, number)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return "", err
+		}
+		statusSHA = pr.GetHead().GetSHA()
+	}
+	githubLimiter.Wait()
+	cs, resp, err := client.Repositories.GetCombinedStatus(ctx, owner, name, statusSHA, nil)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return "", err
+	}
+	states := contextStates(cs.Statuses)
+	if checkRuns {
+		runs, err := listCheckRuns(ctx, client, owner, name, statusSHA, githubLimiter)
+		if err != nil {
+			return "", err
+		}
+		states = withCheckRuns(states, runs)
+	}
+	return AggregateStatus(states, ignoreContexts, aggregation), nil
+}
+
+// Policies for combining the states of each status context, see Input.StatusAggregation
+const (
+	// StatusAggregationGithub uses the combined status as Github reports it, which is the same as strict
+	StatusAggregationGithub = "github"
+	// StatusAggregationStrict is failure as soon as any context fails, even while others are pending
+	StatusAggregationStrict = "strict"
+	// StatusAggregationLenient is pending until every context completes, then failure if any failed
+	StatusAggregationLenient = "lenient"
+)
+
+// EffectiveStatus combines the states of each status context like Github does, but skips
+// contexts matching any of ignoreContexts (which may be globs, e.g. "license/*").
+// It returns failure, pending, or success.
+func EffectiveStatus(states map[string]string, ignoreContexts []string) string {
+	return AggregateStatus(states, ignoreContexts, StatusAggregationStrict)
+}
+
+// AggregateStatus is EffectiveStatus, combining the states with the given policy
+func AggregateStatus(states map[string]string, ignoreContexts []string, policy string) string {
+	pending := false
+	failed := false
+	for context, state := range states {
+		if ignored(context, ignoreContexts) {
+			continue
+		}
+		switch state {
+		case "error", "failure":
+			failed = true
+		case "pending":
+			pending = true
+		}
+	}
+	if failed && (policy != StatusAggregationLenient || !pending) {
+		return "failure"
+	}
+	if pending || len(states) == 0 {
+		return "pending"
+	}
+	return "success"
+}
+
+// HostFilter decides which hosts a build URL may point to, so internal CI URLs aren't shared
+type HostFilter struct {
+	// Allow, if set, lists the only hosts which are allowed
+	Allow []string
+	// Deny lists hosts which aren't allowed, even if they're in Allow
+	Deny []string
+}
+
+func (f HostFilter) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range f.Deny {
+		if strings.ToLower(h) == host {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, h := range f.Allow {
+		if strings.ToLower(h) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultCIContext is the status context of CircleCI builds
+const DefaultCIContext = "ci/circleci"
+
+// circleCIBuildURL finds the CircleCI build's URL, without its tracking params.
+// It's empty if there isn't one, or its host isn't allowed by hosts.
+func circleCIBuildURL(statuses []github.RepoStatus, hosts HostFilter) string {
+	return ciBuildURL(statuses, nil, DefaultCIContext, hosts)
+}
+
+// ciBuildURL finds the URL of the build whose status context or check run name matches ciContext,
+// which may be a glob, e.g. "ci/*". Statuses are preferred over check runs.
+// It's empty if there isn't one, or its host isn't allowed by hosts.
+func ciBuildURL(statuses []github.RepoStatus, runs []checkRun, ciContext string, hosts HostFilter) string {
+	var buildURL string
+	for _, status := range statuses {
+		if !ignored(status.GetContext(), []string{ciContext}) || status.TargetURL == nil {
+			continue
+		}
+		buildURL = allowedBuildURL(cleanBuildURL(status.GetTargetURL()), hosts)
+	}
+	if buildURL != "" {
+		return buildURL
+	}
+	for _, r := range runs {
+		if ignored(r.Name, []string{ciContext}) && r.url() != "" {
+			buildURL = allowedBuildURL(cleanBuildURL(r.url()), hosts)
+		}
+	}
+	return buildURL
+}
+
+// cleanBuildURL removes tracking params (utm_*) from a build URL, keeping any other params as they were.
+// It's empty if the URL isn't an absolute http(s) URL, since there's nothing to link to.
+func cleanBuildURL(raw string) string {
+	parsedURL, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return ""
+	}
+	// params are filtered as is, rather than parsed and re-encoded, so malformed ones aren't silently dropped or reordered
+	params := []string{}
+	for _, param := range strings.Split(parsedURL.RawQuery, "&") {
+		key := strings.SplitN(param, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if param == "" || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			continue
+		}
+		params = append(params, param)
+	}
+	parsedURL.RawQuery = strings.Join(params, "&")
+	parsedURL.ForceQuery = false
+	return parsedURL.String()
+}
+
+// allowedBuildURL blanks the build URL if its host isn't allowed
+func allowedBuildURL(buildURL string, hosts HostFilter) string {
+	parsedURL, err := url.Parse(buildURL)
+	if err != nil || !hosts.allowed(parsedURL.Hostname()) {
+		return ""
+	}
+	return buildURL
+}
+
+func ignored(context string, ignoreContexts []string) bool {
+	for _, pattern := range ignoreContexts {
+		if matched, err := path.Match(pattern, context); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
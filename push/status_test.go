@@ -0,0 +1,141 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectiveStatus(t *testing.T) {
+	states := map[string]string{
+		"ci/circleci": "success",
+		"license/cla": "failure",
+	}
+	assert.Equal(t, "failure", EffectiveStatus(states, nil))
+	assert.Equal(t, "success", EffectiveStatus(states, []string{"license/cla"}))
+	assert.Equal(t, "success", EffectiveStatus(states, []string{"license/*"}))
+
+	// ignoring every context leaves nothing blocking
+	assert.Equal(t, "success", EffectiveStatus(states, []string{"*/*"}))
+
+	// Github reports pending when there are no statuses at all
+	assert.Equal(t, "pending", EffectiveStatus(map[string]string{}, nil))
+}
+
+func TestAggregateStatus(t *testing.T) {
+	mixed := map[string]string{
+		"ci/circleci": "pending",
+		"license/cla": "failure",
+		"lint":        "success",
+	}
+	assert.Equal(t, "failure", AggregateStatus(mixed, nil, StatusAggregationGithub))
+	assert.Equal(t, "failure", AggregateStatus(mixed, nil, StatusAggregationStrict))
+	assert.Equal(t, "pending", AggregateStatus(mixed, nil, StatusAggregationLenient))
+
+	// once everything completes, lenient fails too
+	mixed["ci/circleci"] = "success"
+	assert.Equal(t, "failure", AggregateStatus(mixed, nil, StatusAggregationLenient))
+	assert.Equal(t, "success", AggregateStatus(mixed, []string{"license/cla"}, StatusAggregationLenient))
+}
+
+func TestGetEffectiveStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/svc/pulls/7":
+			fmt.Fprint(w, `{"head": {"sha": "abc"}}`)
+		case "/repos/Clever/svc/commits/abc/status":
+			fmt.Fprint(w, `{"statuses": [{"context": "ci", "state": "success"}, {"context": "license/cla", "state": "failure"}]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	limiter := ratelimit.NewTicker(time.Millisecond)
+
+	status, err := GetEffectiveStatus(context.Background(), "Clever", "svc", 7, "", nil, StatusAggregationGithub, false, "token", server.URL, "mp", limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "failure", status)
+
+	status, err = GetEffectiveStatus(context.Background(), "Clever", "svc", 7, "", []string{"license/cla"}, StatusAggregationGithub, false, "token", server.URL, "mp", limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", status)
+}
+
+func TestStatusDetails(t *testing.T) {
+	statuses := []github.RepoStatus{
+		{Context: github.String("license/cla"), State: github.String("success")},
+		{Context: github.String("ci/circleci"), State: github.String("failure"), TargetURL: github.String("https://circleci.com/gh/Clever/svc/1?utm_source=github")},
+	}
+	assert.Equal(t, []StatusDetail{
+		{Context: "ci/circleci", State: "failure", TargetURL: "https://circleci.com/gh/Clever/svc/1"},
+		{Context: "license/cla", State: "success"},
+	}, statusDetails(statuses, HostFilter{}))
+}
+
+func TestCircleCIBuildURL(t *testing.T) {
+	statuses := []github.RepoStatus{
+		{Context: github.String("license/cla"), TargetURL: github.String("https://cla.example.com/x")},
+		{Context: github.String("ci/circleci"), TargetURL: github.String("https://circleci.com/gh/Clever/microplane/1?utm_source=github_status&utm_medium=notification")},
+	}
+	assert.Equal(t, "https://circleci.com/gh/Clever/microplane/1", circleCIBuildURL(statuses, HostFilter{}))
+	assert.Equal(t, "https://circleci.com/gh/Clever/microplane/1", circleCIBuildURL(statuses, HostFilter{Allow: []string{"CircleCI.com"}}))
+	assert.Equal(t, "", circleCIBuildURL(statuses, HostFilter{Allow: []string{"ci.example.com"}}))
+	assert.Equal(t, "", circleCIBuildURL(statuses, HostFilter{Deny: []string{"circleci.com"}}))
+}
+
+func TestCIBuildURL(t *testing.T) {
+	statuses := []github.RepoStatus{
+		{Context: github.String("ci/circleci"), TargetURL: github.String("https://circleci.com/gh/Clever/svc/1?utm_source=github_status")},
+	}
+	runs := []checkRun{
+		{Name: "build", Status: "completed", Conclusion: "success", HTMLURL: "https://github.com/Clever/svc/runs/2", DetailsURL: "https://github.com/Clever/svc/actions/runs/3"},
+		{Name: "lint", Status: "in_progress"},
+	}
+	assert.Equal(t, "https://circleci.com/gh/Clever/svc/1", ciBuildURL(statuses, runs, DefaultCIContext, HostFilter{}))
+	assert.Equal(t, "https://github.com/Clever/svc/actions/runs/3", ciBuildURL(statuses, runs, "build", HostFilter{}))
+	assert.Equal(t, "https://circleci.com/gh/Clever/svc/1", ciBuildURL(statuses, runs, "ci/*", HostFilter{}))
+	assert.Equal(t, "", ciBuildURL(statuses, runs, "build", HostFilter{Deny: []string{"github.com"}}))
+	assert.Equal(t, "", ciBuildURL(nil, nil, "build", HostFilter{}))
+}
+
+func TestWithCheckRuns(t *testing.T) {
+	runs := []checkRun{
+		{Name: "build", Status: "completed", Conclusion: "timed_out"},
+		{Name: "lint", Status: "queued"},
+		{Name: "docs", Status: "completed", Conclusion: "skipped"},
+		{Name: "ci/circleci", Status: "completed", Conclusion: "failure"},
+	}
+	states := withCheckRuns(map[string]string{"ci/circleci": "success"}, runs)
+	assert.Equal(t, map[string]string{"build": "failure", "lint": "pending", "docs": "success", "ci/circleci": "success"}, states)
+}
+
+func TestCleanBuildURL(t *testing.T) {
+	for _, tc := range []struct {
+		raw      string
+		expected string
+	}{
+		{"https://circleci.com/gh/Clever/svc/1", "https://circleci.com/gh/Clever/svc/1"},
+		{"https://circleci.com/gh/Clever/svc/1?utm_campaign=vcs-integration-link&utm_medium=referral&utm_source=github-build-link", "https://circleci.com/gh/Clever/svc/1"},
+		{"https://circleci.com/gh/Clever/svc/1?utm_content=status&utm_term=x", "https://circleci.com/gh/Clever/svc/1"},
+		{"https://app.circleci.com/pipelines/gh/Clever/svc/1/workflows/abc?UTM_Source=github", "https://app.circleci.com/pipelines/gh/Clever/svc/1/workflows/abc"},
+		{"https://ci.example.com/build?id=1&utm_source=github&tab=logs", "https://ci.example.com/build?id=1&tab=logs"},
+		{"https://ci.example.com/build?id=%zz&utm_source=github", "https://ci.example.com/build?id=%zz"},
+		{"https://ci.example.com/build?", "https://ci.example.com/build"},
+		{"https://ci.example.com/build#step-3", "https://ci.example.com/build#step-3"},
+		{" https://ci.example.com/build\n", "https://ci.example.com/build"},
+		{"", ""},
+		{"not a url", ""},
+		{"/relative/build/1", ""},
+		{"javascript:alert(1)", ""},
+		{"https://ci.example.com:bad/build", ""},
+	} {
+		assert.Equal(t, tc.expected, cleanBuildURL(tc.raw), tc.raw)
+	}
+}
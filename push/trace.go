@@ -0,0 +1,77 @@
+package push
+
+import "context"
+
+// Tracer traces a push and each of its phases, e.g. by adapting an OpenTelemetry tracer, so operators can see fleet runs
+// in their APM. Spans should be children of any span in ctx. See Input.Tracer.
+type Tracer interface {
+	// Start starts a span, returning a ctx with it for child spans
+	Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer
+type Span interface {
+	SetAttributes(attributes map[string]string)
+	// End ends the span, recording err if it isn't nil
+	End(err error)
+}
+
+// noopTracer is the Tracer when Input.Tracer isn't set
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attributes map[string]string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attributes map[string]string) {}
+func (noopSpan) End(err error)                              {}
+
+// tracer is Input.Tracer, defaulting to a no-op
+func (input Input) tracer() Tracer {
+	if input.Tracer == nil {
+		return noopTracer{}
+	}
+	return input.Tracer
+}
+
+// phaseTracer traces each phase of a push as a child of the push's span.
+// A phase's span ends when the next phase starts, or the push finishes.
+type phaseTracer struct {
+	ctx     context.Context
+	tracer  Tracer
+	repo    string
+	current Span
+}
+
+func (p *phaseTracer) start(phase string) {
+	p.end(nil)
+	_, p.current = p.tracer.Start(p.ctx, phase, map[string]string{"repo": p.repo})
+}
+
+func (p *phaseTracer) end(err error) {
+	if p.current == nil {
+		return
+	}
+	p.current.End(err)
+	p.current = nil
+}
+
+// outcome summarizes a push for its span
+func outcome(output Output, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case output.NoChanges:
+		return "no changes"
+	case output.PRDisabled:
+		return "PRs disabled"
+	case output.ReadOnly:
+		return "read only"
+	case output.ValidationFailed:
+		return "validation failed"
+	default:
+		return "success"
+	}
+}
@@ -0,0 +1,86 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// Validation runs a Github Actions workflow on the pushed branch, and waits for it to pass, before the PR is opened
+type Validation struct {
+	// Workflow is the workflow's file name, e.g. "validate.yml". It must have a workflow_dispatch trigger.
+	Workflow string
+	// Inputs are passed to the workflow as-is
+	Inputs map[string]string
+	// Timeout is how long to wait for the workflow to finish
+	Timeout time.Duration
+	// PollInterval is how often to check on the workflow, 15s if unset
+	PollInterval time.Duration
+}
+
+// workflowRun is the subset of a Github Actions workflow run we use
+type workflowRun struct {
+	HeadSHA    string    `json:"head_sha"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	HTMLURL    string    `json:"html_url"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// validate dispatches the validation workflow on branch and waits for its run of sha to finish.
+// It returns the run's conclusion, e.g. "success" or "failure", and its URL.
+func validate(ctx context.Context, client *github.Client, owner string, name string, branch string, sha string, v Validation, githubLimiter ratelimit.Limiter) (string, string, error) {
+	// allow for some clock skew between us and Github
+	dispatched := time.Now().Add(-time.Minute)
+	if err := dispatchWorkflow(ctx, client, owner, name, branch, 0, WorkflowDispatch{Workflow: v.Workflow, Inputs: v.Inputs}, githubLimiter); err != nil {
+		return "", "", err
+	}
+
+	interval := v.PollInterval
+	if interval == 0 {
+		interval = 15 * time.Second
+	}
+	timeout := time.After(v.Timeout)
+	for {
+		run, err := latestWorkflowRun(ctx, client, owner, name, branch, sha, v.Workflow, dispatched, githubLimiter)
+		if err != nil {
+			return "", "", err
+		}
+		if run != nil && run.Status == "completed" {
+			return run.Conclusion, run.HTMLURL, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		case <-timeout:
+			return "", "", fmt.Errorf("validation workflow %s didn't finish within %s", v.Workflow, v.Timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// latestWorkflowRun finds the newest dispatched run of the workflow for sha, created after since, or nil if it hasn't started yet
+func latestWorkflowRun(ctx context.Context, client *github.Client, owner string, name string, branch string, sha string, workflow string, since time.Time, githubLimiter ratelimit.Limiter) (*workflowRun, error) {
+	u := fmt.Sprintf("repos/%s/%s/actions/workflows/%s/runs?branch=%s&event=workflow_dispatch", owner, name, workflow, url.QueryEscape(branch))
+	var runs struct {
+		WorkflowRuns []workflowRun `json:"workflow_runs"`
+	}
+	githubLimiter.Wait()
+	resp, err := githubclient.Do(ctx, client, "GET", u, "", nil, &runs)
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return nil, fmt.Errorf("could not list runs of workflow %s: %s", workflow, err)
+	}
+	// runs are listed newest first
+	for _, run := range runs.WorkflowRuns {
+		if run.HeadSHA == sha && run.CreatedAt.After(since) {
+			return &run, nil
+		}
+	}
+	return nil, nil
+}
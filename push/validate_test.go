@@ -0,0 +1,47 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	polls := 0
+	client, server := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/svc/actions/workflows/validate.yml/dispatches":
+			w.WriteHeader(http.StatusNoContent)
+		case "/repos/Clever/svc/actions/workflows/validate.yml/runs":
+			assert.Equal(t, "codemod", r.URL.Query().Get("branch"))
+			polls++
+			created := time.Now().UTC().Format(time.RFC3339)
+			status := "in_progress"
+			if polls > 1 {
+				status = "completed"
+			}
+			fmt.Fprintf(w, `{"workflow_runs": [
+				{"head_sha": "abc", "status": "%s", "conclusion": "failure", "html_url": "https://github.com/Clever/svc/actions/runs/2", "created_at": "%s"},
+				{"head_sha": "old", "status": "completed", "conclusion": "success", "html_url": "https://github.com/Clever/svc/actions/runs/1", "created_at": "%s"}
+			]}`, status, created, created)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	v := Validation{Workflow: "validate.yml", Timeout: time.Second, PollInterval: time.Millisecond}
+	conclusion, runURL, err := validate(context.Background(), client, "Clever", "svc", "codemod", "abc", v, ratelimit.NewTicker(time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, "failure", conclusion)
+	assert.Equal(t, "https://github.com/Clever/svc/actions/runs/2", runURL)
+	assert.Equal(t, 2, polls, "the run is polled until it completes")
+
+	_, _, err = validate(context.Background(), client, "Clever", "svc", "codemod", "missing", Validation{Workflow: "validate.yml", Timeout: 10 * time.Millisecond, PollInterval: time.Millisecond}, ratelimit.NewTicker(time.Millisecond))
+	assert.Error(t, err, "a run that never starts times out")
+}
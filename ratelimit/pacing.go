@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Waits is how long requests were held back before being sent
+type Waits struct {
+	// Limiter is time spent waiting on the Limiter's pacing
+	Limiter time.Duration
+	// RetryAfter is time spent waiting out Retry-After responses, e.g. from Github's abuse detection
+	RetryAfter time.Duration
+}
+
+// Total is the time spent waiting for any reason
+func (w Waits) Total() time.Duration {
+	return w.Limiter + w.RetryAfter
+}
+
+func (w Waits) String() string {
+	return fmt.Sprintf("%s on the rate limiter, %s on Retry-After", w.Limiter.Round(time.Second), w.RetryAfter.Round(time.Second))
+}
+
+// Pacing tracks how long requests wait, across a whole run. When Github responds with Retry-After,
+// every request tracked by the Pacing waits it out, not only the one which got the response.
+type Pacing struct {
+	mu         sync.Mutex
+	total      Waits
+	retryUntil time.Time
+}
+
+// NewPacing returns a Pacing with nothing tracked yet
+func NewPacing() *Pacing {
+	return &Pacing{}
+}
+
+// Total is the time waited by all the Limiters from Track
+func (p *Pacing) Total() Waits {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.total
+}
+
+// Track wraps l, adding its waits to the Pacing. The returned Limiter's own waits are separate,
+// e.g. for a single repo.
+func (p *Pacing) Track(l Limiter) *Tracked {
+	return &Tracked{limiter: l, pacing: p}
+}
+
+func (p *Pacing) pause(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := time.Now().Add(d); until.After(p.retryUntil) {
+		p.retryUntil = until
+	}
+}
+
+// Tracked is a Limiter which honors Retry-After, and tracks its waits, see Pacing.Track
+type Tracked struct {
+	limiter Limiter
+	pacing  *Pacing
+
+	mu    sync.Mutex
+	waits Waits
+}
+
+// Wait waits out any Retry-After, then for the wrapped Limiter
+func (t *Tracked) Wait() {
+	var waits Waits
+	t.pacing.mu.Lock()
+	retryAfter := time.Until(t.pacing.retryUntil)
+	t.pacing.mu.Unlock()
+	if retryAfter > 0 {
+		time.Sleep(retryAfter)
+		waits.RetryAfter = retryAfter
+	}
+
+	start := time.Now()
+	t.limiter.Wait()
+	waits.Limiter = time.Since(start)
+
+	t.mu.Lock()
+	t.waits.Limiter += waits.Limiter
+	t.waits.RetryAfter += waits.RetryAfter
+	t.mu.Unlock()
+	t.pacing.mu.Lock()
+	t.pacing.total.Limiter += waits.Limiter
+	t.pacing.total.RetryAfter += waits.RetryAfter
+	t.pacing.mu.Unlock()
+}
+
+// Observe passes the response to the wrapped Limiter, and pauses all requests for its Retry-After, if any
+func (t *Tracked) Observe(resp *github.Response) {
+	t.limiter.Observe(resp)
+	if d := retryAfter(resp); d > 0 {
+		t.pacing.pause(d)
+	}
+}
+
+// Waits is the time waited by this Limiter
+func (t *Tracked) Waits() Waits {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waits
+}
+
+// retryAfter parses the Retry-After header, in seconds, of a response
+func retryAfter(resp *github.Response) time.Duration {
+	if resp == nil || resp.Response == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Limiter paces requests to the Github API
+type Limiter interface {
+	// Wait blocks until the next request may be made
+	Wait()
+	// Observe updates the limiter with the rate limit reported by a response
+	Observe(resp *github.Response)
+}
+
+// Ticker is a Limiter that waits a fixed interval between requests
+type Ticker struct {
+	*time.Ticker
+}
+
+// NewTicker returns a Limiter allowing one request per interval
+func NewTicker(interval time.Duration) Ticker {
+	return Ticker{time.NewTicker(interval)}
+}
+
+// Wait for the next tick
+func (t Ticker) Wait() {
+	<-t.C
+}
+
+// Observe is a no-op, a Ticker's interval never changes
+func (t Ticker) Observe(resp *github.Response) {}
+
+// Adaptive is a Limiter that spreads the remaining rate limit budget evenly
+// over the time left until the limit resets.
+//
+// Requests are still serialized, since concurrent requests trigger Github's abuse detection.
+type Adaptive struct {
+	mu       sync.Mutex
+	minDelay time.Duration
+	delay    time.Duration
+	next     time.Time
+}
+
+// NewAdaptive returns an Adaptive limiter that never waits less than minDelay between requests
+func NewAdaptive(minDelay time.Duration) *Adaptive {
+	return &Adaptive{minDelay: minDelay, delay: minDelay}
+}
+
+// Wait blocks until the current delay has passed since the previous request
+func (a *Adaptive) Wait() {
+	a.mu.Lock()
+	now := time.Now()
+	start := a.next
+	if start.Before(now) {
+		start = now
+	}
+	a.next = start.Add(a.delay)
+	a.mu.Unlock()
+
+	time.Sleep(start.Sub(now))
+}
+
+// Observe recomputes the delay from the response's X-RateLimit-Remaining and X-RateLimit-Reset headers.
+// The next request was scheduled with the previous delay, so it's pushed back if the new delay is longer,
+// e.g. until the reset once the budget runs out.
+func (a *Adaptive) Observe(resp *github.Response) {
+	if resp == nil || resp.Rate.Limit == 0 {
+		return
+	}
+	delay := adaptiveDelay(resp.Rate.Remaining, time.Until(resp.Rate.Reset.Time), a.minDelay)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.delay = delay
+	if next := time.Now().Add(delay); next.After(a.next) {
+		a.next = next
+	}
+}
+
+// RateFromHeaders parses the X-RateLimit-* headers of a response which didn't come through go-github,
+// e.g. a GraphQL request
+func RateFromHeaders(header http.Header) github.Rate {
+	var rate github.Rate
+	rate.Limit, _ = strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	rate.Remaining, _ = strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rate.Reset = github.Timestamp{Time: time.Unix(reset, 0)}
+	}
+	return rate
+}
+
+// adaptiveDelay is the delay that consumes the remaining requests evenly until reset
+func adaptiveDelay(remaining int, untilReset time.Duration, minDelay time.Duration) time.Duration {
+	if untilReset <= 0 {
+		return minDelay
+	}
+	if remaining <= 0 {
+		// Out of budget, wait for the reset
+		return untilReset
+	}
+	delay := untilReset / time.Duration(remaining)
+	if delay < minDelay {
+		return minDelay
+	}
+	return delay
+}
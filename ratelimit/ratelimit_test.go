@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveDelay(t *testing.T) {
+	minDelay := 10 * time.Millisecond
+
+	// budget spread evenly until reset
+	assert.Equal(t, time.Second, adaptiveDelay(60, time.Minute, minDelay))
+
+	// never faster than the minimum delay
+	assert.Equal(t, minDelay, adaptiveDelay(5000, time.Second, minDelay))
+
+	// out of budget, wait for the reset
+	assert.Equal(t, time.Minute, adaptiveDelay(0, time.Minute, minDelay))
+
+	// reset already passed
+	assert.Equal(t, minDelay, adaptiveDelay(0, -time.Second, minDelay))
+}
+
+func TestAdaptiveObserveDelaysNextRequest(t *testing.T) {
+	a := NewAdaptive(time.Millisecond)
+	a.Wait()
+	a.Observe(&github.Response{Rate: github.Rate{Limit: 5000, Remaining: 0, Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}})
+	assert.True(t, time.Until(a.next) > 59*time.Minute, "the next request waits for the reset, not the previous delay")
+}
+
+func TestTrackedRetryAfter(t *testing.T) {
+	pacing := NewPacing()
+	repo1 := pacing.Track(NewTicker(time.Millisecond))
+	repo2 := pacing.Track(NewTicker(time.Millisecond))
+
+	repo1.Wait()
+	assert.Zero(t, repo1.Waits().RetryAfter)
+
+	// Retry-After on one repo's response holds back the other repo too
+	header := http.Header{}
+	header.Set("Retry-After", "1")
+	repo1.Observe(&github.Response{Response: &http.Response{Header: header}})
+	start := time.Now()
+	repo2.Wait()
+	assert.True(t, time.Since(start) > 900*time.Millisecond)
+	assert.True(t, repo2.Waits().RetryAfter > 900*time.Millisecond)
+	assert.Zero(t, repo1.Waits().RetryAfter)
+	assert.Equal(t, repo1.Waits().Total()+repo2.Waits().Total(), pacing.Total().Total())
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Zero(t, retryAfter(nil))
+	header := http.Header{}
+	assert.Zero(t, retryAfter(&github.Response{Response: &http.Response{Header: header}}))
+	header.Set("Retry-After", "60")
+	assert.Equal(t, time.Minute, retryAfter(&github.Response{Response: &http.Response{Header: header}}))
+}
@@ -0,0 +1,61 @@
+package report
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ExportSchemaVersion is the version of Export's JSON schema. It only changes when a field is removed or changes
+// meaning, so consumers can rely on the fields of the version they were written for.
+const ExportSchemaVersion = 1
+
+// Export is a run's full state, for tools which ingest microplane's results, e.g. dashboards
+type Export struct {
+	SchemaVersion int `json:"schema_version"`
+	// Version is the microplane version which exported the run
+	Version    string       `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Repos      []ExportRepo `json:"repos"`
+}
+
+// ExportRepo is one repo's state, with the details most tools need pulled out of its step outputs
+type ExportRepo struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	// Status and Details are as shown by `mp status`
+	Status            string `json:"status"`
+	Details           string `json:"details"`
+	CommitSHA         string `json:"commit_sha,omitempty"`
+	PullRequestNumber int    `json:"pull_request_number,omitempty"`
+	PullRequestURL    string `json:"pull_request_url,omitempty"`
+	MergeCommitSHA    string `json:"merge_commit_sha,omitempty"`
+	// Steps are the steps which ran, in order
+	Steps []ExportStep `json:"steps"`
+}
+
+// ExportStep is a step's persisted output for a repo
+type ExportStep struct {
+	// Name is clone, plan, push, or merge
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// CompletedAt is when the step last wrote its output
+	CompletedAt time.Time `json:"completed_at"`
+	// Output is the step's output as persisted in the workdir, with secrets redacted
+	Output json.RawMessage `json:"output"`
+}
+
+// credentialsPattern matches credentials embedded in a URL, e.g. https://x-access-token:<token>@github.com
+var credentialsPattern = regexp.MustCompile(`://[^/@\s"]+@`)
+
+// Redact replaces the secrets, and any credentials embedded in URLs, so they can't leak into an export
+func Redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, "REDACTED", -1)
+		}
+	}
+	return credentialsPattern.ReplaceAllString(s, "://REDACTED@")
+}
@@ -0,0 +1,76 @@
+package report
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// PRStatus is a pushed PR's status as of a status run, persisted so the next run can tell what changed
+type PRStatus struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	// Status is failure, error, pending, or success
+	Status string `json:"status"`
+}
+
+// failing is whether the status is red
+func failing(status string) bool {
+	return status == "failure" || status == "error"
+}
+
+// Regression is a PR which started failing since the previous status run
+type Regression struct {
+	PRStatus
+	// Previous is the PR's status in the previous run, success or pending
+	Previous string `json:"previous"`
+}
+
+// NewlyFailing returns a regression if the PR went from success or pending to failing. A PR which was already failing,
+// or has no previous status, e.g. on the first run or since it was re-opened as a new PR, isn't a regression.
+func NewlyFailing(previous *PRStatus, current PRStatus) (Regression, bool) {
+	if previous == nil || previous.Number != current.Number || failing(previous.Status) || previous.Status == "" || !failing(current.Status) {
+		return Regression{}, false
+	}
+	return Regression{PRStatus: current, Previous: previous.Status}, true
+}
+
+// Notifier is told about each PR which started failing, e.g. by commenting on it or with a webhook
+type Notifier interface {
+	Notify(ctx context.Context, r Regression) error
+}
+
+// CommentNotifier comments on each PR which started failing
+type CommentNotifier struct {
+	client        *github.Client
+	githubLimiter ratelimit.Limiter
+}
+
+// NewCommentNotifier creates a CommentNotifier which comments with the token, on github.com or the Github Enterprise
+// API at baseURL
+func NewCommentNotifier(ctx context.Context, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) (*CommentNotifier, error) {
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return &CommentNotifier{client: client, githubLimiter: githubLimiter}, nil
+}
+
+// Notify comments on the PR that its status changed
+func (n *CommentNotifier) Notify(ctx context.Context, r Regression) error {
+	body := regressionComment(r)
+	n.githubLimiter.Wait()
+	_, resp, err := n.client.Issues.CreateComment(ctx, r.Owner, r.Repo, r.Number, &github.IssueComment{Body: &body})
+	n.githubLimiter.Observe(resp)
+	return err
+}
+
+func regressionComment(r Regression) string {
+	return fmt.Sprintf("This PR's status went from %s to %s since microplane last checked it.", r.Previous, r.Status)
+}
@@ -0,0 +1,33 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewlyFailing(t *testing.T) {
+	pr := func(number int, status string) PRStatus {
+		return PRStatus{Owner: "Clever", Repo: "svc", Number: number, Status: status}
+	}
+	for _, test := range []struct {
+		previous *PRStatus
+		current  PRStatus
+		expected bool
+	}{
+		{previous: &PRStatus{Number: 7, Status: "success"}, current: pr(7, "failure"), expected: true},
+		{previous: &PRStatus{Number: 7, Status: "pending"}, current: pr(7, "error"), expected: true},
+		{previous: &PRStatus{Number: 7, Status: "failure"}, current: pr(7, "failure"), expected: false},
+		{previous: &PRStatus{Number: 7, Status: "error"}, current: pr(7, "failure"), expected: false},
+		{previous: &PRStatus{Number: 7, Status: "success"}, current: pr(7, "pending"), expected: false},
+		{previous: &PRStatus{Number: 6, Status: "success"}, current: pr(7, "failure"), expected: false},
+		{previous: nil, current: pr(7, "failure"), expected: false},
+	} {
+		regression, ok := NewlyFailing(test.previous, test.current)
+		assert.Equal(t, test.expected, ok, "%+v -> %+v", test.previous, test.current)
+		if ok {
+			assert.Equal(t, test.previous.Status, regression.Previous)
+			assert.Equal(t, test.current, regression.PRStatus)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// Row is one repo's line in a run summary
+type Row struct {
+	Repo           string
+	Status         string
+	Details        string
+	PullRequestURL string
+	// ErrorStep is the step (clone, plan, push, or merge) which failed, if any
+	ErrorStep string
+	// ReviewComments and UnresolvedThreads are only counted on request, see push.GetReviewActivity
+	ReviewComments    int
+	UnresolvedThreads int
+}
+
+// Issue identifies a Github issue, e.g. "Clever/coordination#12"
+type Issue struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+var issuePattern = regexp.MustCompile(`^([^/\s]+)/([^#\s]+)#(\d+)$`)
+
+// ansiPattern matches terminal color codes, as added by github.com/fatih/color
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// ParseIssue parses an issue reference of the form "owner/repo#number"
+func ParseIssue(s string) (Issue, error) {
+	m := issuePattern.FindStringSubmatch(s)
+	if m == nil {
+		return Issue{}, fmt.Errorf("invalid issue %q, expected owner/repo#number", s)
+	}
+	number, err := strconv.Atoi(m[3])
+	if err != nil {
+		return Issue{}, err
+	}
+	return Issue{Owner: m[1], Repo: m[2], Number: number}, nil
+}
+
+// Markdown renders the rows as a Markdown table
+func Markdown(rows []Row) string {
+	var b strings.Builder
+	b.WriteString("| Repo | Status | Details |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for _, r := range rows {
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", cell(r.Repo), cell(r.Status), cell(r.Details))
+	}
+	return b.String()
+}
+
+// Document renders a full run report: totals by status, every repo, and the failures by step
+func Document(title string, generatedAt time.Time, rows []Row) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "Generated %s\n\n", generatedAt.UTC().Format(time.RFC3339))
+
+	b.WriteString("## Totals\n\n")
+	totals := map[string]int{}
+	statuses := []string{}
+	for _, r := range rows {
+		if _, ok := totals[r.Status]; !ok {
+			statuses = append(statuses, r.Status)
+		}
+		totals[r.Status]++
+	}
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "- %s: %d\n", status, totals[status])
+	}
+	fmt.Fprintf(&b, "- **total: %d**\n\n", len(rows))
+
+	b.WriteString("## Repos\n\n")
+	b.WriteString("| Repo | Status | Pull Request | Details |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, r := range rows {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", cell(r.Repo), cell(r.Status), cell(r.PullRequestURL), cell(r.Details))
+	}
+
+	failures := []Row{}
+	for _, r := range rows {
+		if r.ErrorStep != "" {
+			failures = append(failures, r)
+		}
+	}
+	if len(failures) > 0 {
+		b.WriteString("\n## Failures\n\n")
+		b.WriteString("| Repo | Step | Error |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, r := range failures {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", cell(r.Repo), cell(r.ErrorStep), cell(r.Details))
+		}
+	}
+	return b.String()
+}
+
+// cell flattens a value onto one line, without colors, so it fits in a table cell
+func cell(s string) string {
+	s = ansiPattern.ReplaceAllString(s, "")
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Replace(s, "|", "\\|", -1)
+}
+
+// summary is a timestamped run summary
+func summary(rows []Row) string {
+	return fmt.Sprintf("Microplane run summary (%s)\n\n%s", time.Now().UTC().Format(time.RFC3339), Markdown(rows))
+}
+
+// Comment appends a timestamped run summary to the issue
+func Comment(ctx context.Context, issue Issue, rows []Row, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) error {
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return err
+	}
+
+	body := summary(rows)
+	githubLimiter.Wait()
+	_, resp, err := client.Issues.CreateComment(ctx, issue.Owner, issue.Repo, issue.Number, &github.IssueComment{Body: &body})
+	githubLimiter.Observe(resp)
+	return err
+}
@@ -0,0 +1,118 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Clever/microplane/githubclient"
+	"github.com/Clever/microplane/ratelimit"
+	"github.com/google/go-github/github"
+)
+
+// Tracker maintains a campaign's tracking issue, with a checklist item linking each PR
+type Tracker struct {
+	Issue Issue
+	Title string
+
+	client        *github.Client
+	githubLimiter ratelimit.Limiter
+	// mu serializes edits, since each edit rewrites the whole body
+	mu sync.Mutex
+}
+
+// OpenTracker finds the campaign's tracking issue in owner/repo, or creates it. The issue is the given number,
+// if set, e.g. from a previous run, otherwise an open issue with the title.
+func OpenTracker(ctx context.Context, owner string, repo string, title string, number int, token string, baseURL string, userAgent string, githubLimiter ratelimit.Limiter) (*Tracker, error) {
+	// Create Github Client
+	client, err := githubclient.New(ctx, token, baseURL, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tracker{Issue: Issue{Owner: owner, Repo: repo, Number: number}, Title: title, client: client, githubLimiter: githubLimiter}
+	if number > 0 {
+		return t, nil
+	}
+
+	opts := &github.IssueListByRepoOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		githubLimiter.Wait()
+		issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, opts)
+		githubLimiter.Observe(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range issues {
+			if i.PullRequestLinks == nil && i.GetTitle() == title {
+				t.Issue.Number = i.GetNumber()
+				return t, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	body := "Tracking issue for a microplane campaign. Each PR is added as it's opened, and checked off once it's merged.\n"
+	githubLimiter.Wait()
+	issue, resp, err := client.Issues.Create(ctx, owner, repo, &github.IssueRequest{Title: &title, Body: &body})
+	githubLimiter.Observe(resp)
+	if err != nil {
+		return nil, err
+	}
+	t.Issue.Number = issue.GetNumber()
+	return t, nil
+}
+
+// Track adds a checklist item linking the PR to the issue, or updates the existing item's checkbox
+func (t *Tracker) Track(ctx context.Context, name string, url string, done bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.githubLimiter.Wait()
+	issue, resp, err := t.client.Issues.Get(ctx, t.Issue.Owner, t.Issue.Repo, t.Issue.Number)
+	t.githubLimiter.Observe(resp)
+	if err != nil {
+		return err
+	}
+	body, changed := checklist(issue.GetBody(), name, url, done)
+	if !changed {
+		return nil
+	}
+	t.githubLimiter.Wait()
+	_, resp, err = t.client.Issues.Edit(ctx, t.Issue.Owner, t.Issue.Repo, t.Issue.Number, &github.IssueRequest{Body: &body})
+	t.githubLimiter.Observe(resp)
+	return err
+}
+
+// Summarize comments on the issue with a summary of the run
+func (t *Tracker) Summarize(ctx context.Context, rows []Row) error {
+	body := summary(rows)
+	t.githubLimiter.Wait()
+	_, resp, err := t.client.Issues.CreateComment(ctx, t.Issue.Owner, t.Issue.Repo, t.Issue.Number, &github.IssueComment{Body: &body})
+	t.githubLimiter.Observe(resp)
+	return err
+}
+
+// checklist adds or updates the checklist item linking url in body, reporting whether the body changed
+func checklist(body string, name string, url string, done bool) (string, bool) {
+	box := "[ ]"
+	if done {
+		box = "[x]"
+	}
+	item := fmt.Sprintf("- %s [%s](%s)", box, name, url)
+
+	lines := strings.Split(strings.TrimRight(body, "\n"), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "- [") && strings.Contains(line, "("+url+")") {
+			if line == item {
+				return body, false
+			}
+			lines[i] = item
+			return strings.Join(lines, "\n") + "\n", true
+		}
+	}
+	return strings.Join(append(lines, item), "\n") + "\n", true
+}
@@ -0,0 +1,24 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecklist(t *testing.T) {
+	body := "Tracking issue.\n"
+	body, changed := checklist(body, "Clever/api#1", "https://github.com/Clever/api/pull/1", false)
+	assert.True(t, changed)
+	body, _ = checklist(body, "Clever/web#2", "https://github.com/Clever/web/pull/2", false)
+	assert.Equal(t, "Tracking issue.\n- [ ] [Clever/api#1](https://github.com/Clever/api/pull/1)\n- [ ] [Clever/web#2](https://github.com/Clever/web/pull/2)\n", body)
+
+	// a re-run doesn't add the PR again
+	_, changed = checklist(body, "Clever/api#1", "https://github.com/Clever/api/pull/1", false)
+	assert.False(t, changed)
+
+	// merging checks it off
+	body, changed = checklist(body, "Clever/api#1", "https://github.com/Clever/api/pull/1", true)
+	assert.True(t, changed)
+	assert.Equal(t, "Tracking issue.\n- [x] [Clever/api#1](https://github.com/Clever/api/pull/1)\n- [ ] [Clever/web#2](https://github.com/Clever/web/pull/2)\n", body)
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config for delivering a webhook
+type Config struct {
+	// URL to POST each payload to
+	URL string
+	// MaxAttempts is how many times to try each delivery
+	MaxAttempts int
+	// Backoff is how long to wait before the first retry, doubled before each later retry
+	Backoff time.Duration
+	// Timeout caps each attempt, so an endpoint which never responds doesn't hold up the run. Zero is DefaultTimeout.
+	Timeout time.Duration
+	// DeadLetterPath is a file which payloads are appended to, one JSON object per line,
+	// when every attempt to deliver them failed
+	DeadLetterPath string
+}
+
+// Payload is a repo's result from a step
+type Payload struct {
+	Owner   string      `json:"owner"`
+	Repo    string      `json:"repo"`
+	Step    string      `json:"step"`
+	Success bool        `json:"success"`
+	Error   string      `json:"error,omitempty"`
+	Output  interface{} `json:"output"`
+}
+
+// deadLetter is a line in the dead-letter file
+type deadLetter struct {
+	Payload  Payload `json:"payload"`
+	Error    string  `json:"error"`
+	Attempts int     `json:"attempts"`
+	Time     string  `json:"time"`
+}
+
+// DefaultTimeout caps each attempt when Config.Timeout isn't set
+const DefaultTimeout = 30 * time.Second
+
+// repos are delivered concurrently, but their dead letters mustn't interleave
+var deadLetterMu sync.Mutex
+
+// Deliver POSTs the payload as JSON, retrying failures with backoff.
+// If every attempt fails, the payload is written to the dead-letter file, and the last error returned.
+func Deliver(ctx context.Context, config Config, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	backoff := config.Backoff
+	attempts := 0
+retries:
+	for {
+		attempts++
+		err = post(ctx, client, config.URL, body)
+		if err == nil {
+			return nil
+		}
+		if attempts >= config.MaxAttempts {
+			break
+		}
+		// a cancelled run gives up on the retries, but still keeps the payload in the dead-letter file
+		select {
+		case <-ctx.Done():
+			break retries
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	if config.DeadLetterPath != "" {
+		if dlErr := writeDeadLetter(config.DeadLetterPath, deadLetter{
+			Payload:  payload,
+			Error:    err.Error(),
+			Attempts: attempts,
+			Time:     time.Now().UTC().Format(time.RFC3339),
+		}); dlErr != nil {
+			return fmt.Errorf("%s, and could not write dead letter: %s", err, dlErr)
+		}
+	}
+	return err
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+func writeDeadLetter(path string, letter deadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	deadLetterMu.Lock()
+	defer deadLetterMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliverRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	err := Deliver(context.Background(), Config{URL: server.URL, MaxAttempts: 3}, Payload{Repo: "microplane", Step: "push", Success: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, requests)
+}
+
+func TestDeliverTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	start := time.Now()
+	err := Deliver(context.Background(), Config{URL: server.URL, MaxAttempts: 1, Timeout: 10 * time.Millisecond}, Payload{Repo: "microplane", Step: "push"})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second, "took %s", time.Since(start))
+}
+
+func TestDeliverStopsRetryingWhenCancelled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := Deliver(ctx, Config{URL: server.URL, MaxAttempts: 3, Backoff: time.Hour}, Payload{Repo: "microplane", Step: "push"})
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+	assert.True(t, time.Since(start) < time.Second, "took %s", time.Since(start))
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead-letter.jsonl")
+
+	config := Config{URL: server.URL, MaxAttempts: 2, DeadLetterPath: path}
+	err = Deliver(context.Background(), config, Payload{Repo: "microplane", Step: "push"})
+	assert.Error(t, err)
+
+	bs, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	var letter deadLetter
+	assert.NoError(t, json.Unmarshal(bs, &letter))
+	assert.Equal(t, "microplane", letter.Payload.Repo)
+	assert.Equal(t, 2, letter.Attempts)
+}